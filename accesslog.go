@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// accessRecord collects what the access log reports about a request beyond
+// what gin knows: the model, the upstream status and the token usage
+type accessRecord struct {
+	Model          string
+	UpstreamStatus int
+	Usage          openai.Usage
+}
+
+type accessRecordKey struct{}
+
+// accessRecordFrom returns the access record attached to ctx, if any
+func accessRecordFrom(ctx context.Context) *accessRecord {
+	rec, _ := ctx.Value(accessRecordKey{}).(*accessRecord)
+	return rec
+}
+
+// recordAccess notes the model and usage of a request for the access log
+func recordAccess(ctx context.Context, model string, usage openai.Usage) {
+	if rec := accessRecordFrom(ctx); rec != nil {
+		rec.Model = model
+		rec.Usage = usage
+	}
+}
+
+// recordUpstreamStatus notes the status of the last upstream response
+func recordUpstreamStatus(ctx context.Context, status int) {
+	if rec := accessRecordFrom(ctx); rec != nil {
+		rec.UpstreamStatus = status
+	}
+}
+
+// accessLogMiddleware logs one structured line per request with the request
+// logger, so the line carries the request and trace IDs. It replaces gin's
+// own text logger.
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		rec := &accessRecord{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), accessRecordKey{}, rec))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"client_ip", c.ClientIP(),
+			"duration_ms", time.Since(started).Milliseconds(),
+		}
+		if rec.Model != "" {
+			attrs = append(attrs, "model", rec.Model)
+		}
+		if rec.UpstreamStatus != 0 {
+			attrs = append(attrs, "upstream_status", rec.UpstreamStatus)
+		}
+		if rec.Usage.TotalTokens > 0 {
+			attrs = append(attrs,
+				"prompt_tokens", rec.Usage.PromptTokens,
+				"completion_tokens", rec.Usage.CompletionTokens,
+			)
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		requestLogger(c).Log(c.Request.Context(), level, "Request", attrs...)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// aliases returns the current model aliases. The admin API replaces the map
+// instead of changing it, so it may be read without holding configMu.
+func (s *Server) aliases() map[string]string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.ModelAliases
+}
+
+// defaultModel returns the current default model
+func (s *Server) defaultModel() string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.DefaultModel
+}
+
+// rateLimit returns the current rate limit
+func (s *Server) rateLimit() RateLimitConfig {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.RateLimit
+}
+
+// localURL returns the URL of path on this server for clients on this
+// machine
+func (s *Server) localURL(path string) string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.localURL(path)
+}
+
+// updateConfig applies a change made through the admin API to the running
+// server and the config file, and passes it on to OnConfigChange
+func (s *Server) updateConfig(update func(*Config)) error {
+	s.configMu.Lock()
+	update(&s.config)
+	s.configMu.Unlock()
+
+	// The file is updated rather than overwritten with s.config, which
+	// holds compatibility preset defaults that were never saved
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	update(&config)
+	if err := SaveConfig(config); err != nil {
+		return err
+	}
+	if s.OnConfigChange != nil {
+		s.OnConfigChange(update)
+	}
+	return nil
+}
+
+// unknownModel returns an error for the first name that doesn't resolve to
+// a model, or nil
+func (s *Server) unknownModel(names ...string) error {
+	if _, err := s.provider.GetModels(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := s.provider.FindModel(name); !ok {
+			return fmt.Errorf("unknown model %q", name)
+		}
+	}
+	return nil
+}
+
+// setupAdminRoutes adds the admin API for changing the configuration at
+// runtime. Like everything under /admin, it is guarded by adminMiddleware.
+func (s *Server) setupAdminRoutes() {
+	s.router.GET("/admin/filter", s.handleAdminGetFilter)
+	s.router.PUT("/admin/filter", s.handleAdminSetFilter)
+	s.router.POST("/admin/filter", s.handleDashboardFilter)
+	s.router.DELETE("/admin/filter", s.handleDashboardFilter)
+	s.router.GET("/admin/aliases", s.handleAdminGetAliases)
+	s.router.PUT("/admin/aliases", s.handleAdminSetAliases)
+	s.router.GET("/admin/default-model", s.handleAdminGetDefaultModel)
+	s.router.PUT("/admin/default-model", s.handleAdminSetDefaultModel)
+	s.router.GET("/admin/rate-limit", s.handleAdminGetRateLimit)
+	s.router.PUT("/admin/rate-limit", s.handleAdminSetRateLimit)
+	s.router.POST("/admin/refresh-models", s.handleAdminRefreshModels)
+}
+
+func (s *Server) handleAdminGetFilter(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"filter": s.filterEntries()})
+}
+
+// handleAdminSetFilter replaces the model filter with {"filter": [...]}
+func (s *Server) handleAdminSetFilter(c *gin.Context) {
+	var request struct {
+		Filter []string `json:"filter"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	for _, entry := range request.Filter {
+		if _, err := path.Match(entry, ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid pattern %q", entry)})
+			return
+		}
+	}
+	if err := s.setFilter(request.Filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Model filter replaced", "entries", len(request.Filter))
+	c.JSON(http.StatusOK, gin.H{"filter": s.filterEntries()})
+}
+
+func (s *Server) handleAdminGetAliases(c *gin.Context) {
+	aliases := s.aliases()
+	if aliases == nil {
+		aliases = map[string]string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"aliases": aliases})
+}
+
+// handleAdminSetAliases replaces the model aliases with {"aliases": {...}}
+func (s *Server) handleAdminSetAliases(c *gin.Context) {
+	var request struct {
+		Aliases map[string]string `json:"aliases"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	if err := s.unknownModel(slices.Collect(maps.Values(request.Aliases))...); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	aliases := maps.Clone(request.Aliases)
+	if err := s.updateConfig(func(config *Config) { config.ModelAliases = aliases }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Model aliases replaced", "aliases", len(aliases))
+	s.handleAdminGetAliases(c)
+}
+
+func (s *Server) handleAdminGetDefaultModel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"default_model": s.defaultModel()})
+}
+
+// handleAdminSetDefaultModel sets the default model with
+// {"default_model": ...}; an empty name removes it
+func (s *Server) handleAdminSetDefaultModel(c *gin.Context) {
+	var request struct {
+		DefaultModel string `json:"default_model"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	if request.DefaultModel != "" {
+		if err := s.unknownModel(request.DefaultModel); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := s.updateConfig(func(config *Config) { config.DefaultModel = request.DefaultModel }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Default model changed", "default_model", request.DefaultModel)
+	s.handleAdminGetDefaultModel(c)
+}
+
+func (s *Server) handleAdminGetRateLimit(c *gin.Context) {
+	c.JSON(http.StatusOK, s.rateLimit())
+}
+
+// handleAdminSetRateLimit replaces the rate limit with a rate_limit object
+func (s *Server) handleAdminSetRateLimit(c *gin.Context) {
+	var limit RateLimitConfig
+	if err := c.ShouldBindJSON(&limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	if limit.RequestsPerMinute < 0 || limit.Burst < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "requests_per_minute and burst must not be negative"})
+		return
+	}
+	if limit.By != "" && limit.By != "ip" && limit.By != "token" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `by must be "ip" or "token"`})
+		return
+	}
+
+	if err := s.updateConfig(func(config *Config) { config.RateLimit = limit }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Rate limit changed", "requests_per_minute", limit.RequestsPerMinute, "burst", limit.Burst, "by", limit.By)
+	s.handleAdminGetRateLimit(c)
+}
+
+// handleAdminRefreshModels fetches the model list again
+func (s *Server) handleAdminRefreshModels(c *gin.Context) {
+	models, err := s.provider.RefreshModels()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"models": len(models)})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// modelAlias returns the model an alias from the model_aliases section
+// points to. As with Ollama, "name" and "name:latest" are the same model.
+func (s *Server) modelAlias(name string) (string, bool) {
+	aliases := s.aliases()
+	if target, ok := aliases[name]; ok {
+		return target, true
+	}
+	base := strings.TrimSuffix(name, ":latest")
+	for alias, target := range aliases {
+		if strings.TrimSuffix(alias, ":latest") == base {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// aliasNames returns the configured aliases, sorted
+func (s *Server) aliasNames() []string {
+	aliases := s.aliases()
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
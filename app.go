@@ -1,21 +1,79 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
     "log/slog"
     "os"
+    "sort"
+    "strings"
     "sync"
+    "time"
 
     "github.com/getlantern/systray"
+    "github.com/ncruces/zenity"
     "github.com/skratchdot/open-golang/open"
 )
 
+// Supervisor restart delays; the delay doubles after each quick failure
+const (
+    minRestartDelay = time.Second
+    maxRestartDelay = time.Minute
+    // stableRunTime is how long a server must run before a failure is
+    // treated as a fresh one rather than part of a crash loop
+    stableRunTime = time.Minute
+    // creditsRefreshInterval is how often the credits shown in the tray are
+    // fetched from OpenRouter
+    creditsRefreshInterval = 5 * time.Minute
+    // recentRequestsInterval is how often the Recent Requests submenu is
+    // brought up to date
+    recentRequestsInterval = 10 * time.Second
+    // trayRecentRequests is how many requests the Recent Requests submenu
+    // lists
+    trayRecentRequests = 10
+)
+
 // App represents the application state
 type App struct {
     config       Config
     server       *Server
     serverMutex  sync.Mutex
     serverActive bool
+    // restarts counts the times supervise replaced a failed server since
+    // the user started it
+    restarts int
+
+    // Tray menu items reflecting the server state
+    mStatus   *systray.MenuItem
+    mToggle   *systray.MenuItem
+    mCredits  *systray.MenuItem
+    mSpend    *systray.MenuItem
+    mRequests *systray.MenuItem
+    mModels   *systray.MenuItem
+    mRecent   *systray.MenuItem
+    mUpdate   *systray.MenuItem
+
+    // updateURL is the page of the newer release mUpdate opens
+    updateURL string
+
+    // recentItems are the entries of the Recent Requests submenu, newest
+    // first; unused ones are hidden
+    recentItems []*systray.MenuItem
+
+    // The Models submenu: one submenu per vendor with a checkbox per model,
+    // by full model name
+    modelMenuMu sync.Mutex
+    vendorItems map[string]*systray.MenuItem
+    modelItems  map[string]*systray.MenuItem
+
+    // lastTestedModel is offered first the next time a model is tested.
+    // Tests run in their own goroutines, so it is guarded by serverMutex.
+    lastTestedModel string
+
+    // lowCreditsNotified avoids repeating the low credits notification
+    // until credits are topped up
+    lowCreditsNotified bool
 }
 
 // NewApp creates a new application instance
@@ -46,33 +104,61 @@ func (a *App) onReady() {
     systray.SetTooltip("OpenRouter Proxy for Ollama")
 
     // Create menu items
-    mStatus := systray.AddMenuItem("Status: Stopped", "Server status")
-    mStatus.Disable()
+    a.mStatus = systray.AddMenuItem("Status: Stopped", "Server status")
+    a.mStatus.Disable()
+    a.mCredits = systray.AddMenuItem("Credits: -", "OpenRouter credits left")
+    a.mCredits.Disable()
+    a.mSpend = systray.AddMenuItem("Today: -", "Estimated spend today")
+    a.mSpend.Disable()
+    a.mRequests = systray.AddMenuItem("Requests: -", "Requests since the server started")
+    a.mRequests.Disable()
+    a.addRecentRequestsMenu()
     systray.AddSeparator()
 
-    mToggle := systray.AddMenuItem("Start Server", "Start/Stop the proxy server")
+    a.mToggle = systray.AddMenuItem("Start Server", "Start/Stop the proxy server")
     mAPIKey := systray.AddMenuItem("Configure API Key", "Set your OpenRouter API key")
+    a.mModels = systray.AddMenuItem("Models", "Choose the models clients see")
+    a.mModels.Disable()
+    mTestModel := systray.AddMenuItem("Test Model", "Send a short prompt to a model through the proxy")
     mModelFilter := systray.AddMenuItem("Edit Model Filter", "Edit the model filter file")
+    mRefreshModels := systray.AddMenuItem("Refresh Models", "Fetch the OpenRouter model list again")
+    mReloadConfig := systray.AddMenuItem("Reload Config", "Apply changes to config.json, the model filter and aliases")
+    mDashboard := systray.AddMenuItem("Open Dashboard", "Open the web dashboard")
+    mViewLogs := systray.AddMenuItem("View Logs", "Open the recent log messages")
+    mCopyToken := systray.AddMenuItem("Copy Access Token", "Copy the token clients use to access the proxy")
+    a.addProfileMenu()
 
     systray.AddSeparator()
+    a.mUpdate = systray.AddMenuItem("Update Available", "Open the release page of the new version")
+    a.mUpdate.Hide()
     mAbout := systray.AddMenuItem("About", "About OpenRouter Proxy")
     mQuit := systray.AddMenuItem("Quit", "Quit the application")
 
-    // Start server if enabled in config
-    if a.config.ServerEnabled {
+    // Guide first-time users through the setup, otherwise start the
+    // server if enabled in config
+    if !HasAPIKey() {
+        go a.runOnboarding()
+    } else if a.config.ServerEnabled {
         go a.startServer()
     }
 
+    go a.watchCredits()
+    go a.watchRecentRequests()
+    if a.config.CheckUpdates {
+        go a.watchUpdates()
+    }
+
     // Handle menu item clicks
     go func() {
         for {
             select {
-            case <-mToggle.ClickedCh:
+            case <-a.mToggle.ClickedCh:
                 a.serverMutex.Lock()
-                if a.serverActive {
+                active := a.serverActive
+                a.serverMutex.Unlock()
+
+                if active {
                     a.stopServer()
-                    mToggle.SetTitle("Start Server")
-                    mStatus.SetTitle("Status: Stopped")
                 } else {
                     if !HasAPIKey() {
                         a.showAPIKeyDialog()
@@ -80,18 +166,36 @@ func (a *App) onReady() {
 
                     if HasAPIKey() {
                         a.startServer()
-                        mToggle.SetTitle("Stop Server")
-                        mStatus.SetTitle("Status: Running")
                     }
                 }
-                a.serverMutex.Unlock()
 
             case <-mAPIKey.ClickedCh:
                 a.showAPIKeyDialog()
 
+            case <-mTestModel.ClickedCh:
+                go a.testModel()
+
             case <-mModelFilter.ClickedCh:
                 a.openModelFilter()
 
+            case <-mRefreshModels.ClickedCh:
+                go a.refreshModels()
+
+            case <-mReloadConfig.ClickedCh:
+                go a.reloadConfig()
+
+            case <-mDashboard.ClickedCh:
+                a.openDashboard()
+
+            case <-mViewLogs.ClickedCh:
+                a.viewLogs()
+
+            case <-mCopyToken.ClickedCh:
+                a.copyAccessToken()
+
+            case <-a.mUpdate.ClickedCh:
+                a.openUpdatePage()
+
             case <-mAbout.ClickedCh:
                 a.showAbout()
 
@@ -114,7 +218,7 @@ func (a *App) onExit() {
     }
 }
 
-// startServer starts the proxy server
+// startServer starts the proxy server under supervision
 func (a *App) startServer() {
     a.serverMutex.Lock()
     defer a.serverMutex.Unlock()
@@ -123,22 +227,69 @@ func (a *App) startServer() {
         return
     }
 
-    apiKey, err := GetAPIKey()
+    apiKey, err := resolveAPIKey()
     if err != nil {
         slog.Error("Failed to get API key", "error", err)
         return
     }
 
     // Create and start the server
-    a.server = NewServer(apiKey, a.config.LastUsedModelFilter)
-    go a.server.Start()
+    a.restarts = 0
+    a.server = a.newServer(apiKey)
+    go a.supervise(a.server, apiKey)
 
     a.serverActive = true
     a.config.ServerEnabled = true
     SaveConfig(a.config)
 
-    // Update icon to indicate server is running
-    systray.SetIcon(getActiveIcon())
+    // The server reports when it is actually listening
+    a.setStatus("Starting", "")
+}
+
+// newServer creates a server for the current configuration that keeps the
+// app's copy of it in sync with changes made through the admin API
+func (a *App) newServer(apiKey string) *Server {
+    server := NewServer(apiKey, a.config)
+    server.OnConfigChange = func(update func(*Config)) {
+        // Not waited for: stopping the server holds serverMutex while
+        // requests drain
+        go func() {
+            a.serverMutex.Lock()
+            update(&a.config)
+            a.serverMutex.Unlock()
+        }()
+    }
+    server.OnStateChange = func(state ServerState, detail string) {
+        // Not waited for, like OnConfigChange: stopped is reported while
+        // serverMutex is held
+        go a.serverStateChanged(server, state, detail)
+    }
+    server.OnNotice = func(title, message string) {
+        if err := notify(title, message); err != nil {
+            slog.Error("Failed to show notification", "error", err)
+        }
+    }
+    return server
+}
+
+// serverStateChanged reflects what a server reports about its health in the
+// tray. Failures are left to supervise, which restarts the server, and
+// reports from servers that were replaced are ignored.
+func (a *App) serverStateChanged(server *Server, state ServerState, detail string) {
+    a.serverMutex.Lock()
+    defer a.serverMutex.Unlock()
+
+    if a.server != server {
+        return
+    }
+    switch state {
+    case ServerStarted:
+        a.setStatus("Running", "")
+        go a.refreshModelMenu()
+    case ServerDegraded:
+        slog.Warn("Upstream requests keep failing", "error", detail)
+        a.setStatus("Degraded", detail)
+    }
 }
 
 // stopServer stops the proxy server
@@ -153,37 +304,691 @@ func (a *App) stopServer() {
     a.server.Stop()
     a.server = nil
     a.serverActive = false
+    a.restarts = 0
     a.config.ServerEnabled = false
     SaveConfig(a.config)
 
-    // Update icon to indicate server is stopped
-    systray.SetIcon(getIcon())
+    a.setStatus("Stopped", "")
+    a.mModels.Disable()
 }
 
-// showAPIKeyDialog shows a dialog to configure the API key
+// supervise runs server and replaces it with a fresh one whenever it fails
+// or panics, backing off while it keeps failing. It returns once the server
+// was stopped on purpose, i.e. is no longer a.server.
+func (a *App) supervise(server *Server, apiKey string) {
+    delay := minRestartDelay
+    for {
+        started := time.Now()
+        err := runServer(server)
+
+        a.serverMutex.Lock()
+        if a.server != server {
+            a.serverMutex.Unlock()
+            return
+        }
+        if err == nil {
+            err = fmt.Errorf("server exited unexpectedly")
+        }
+
+        // Restarting won't free the port; the user has to decide
+        var conflict *portInUseError
+        if errors.As(err, &conflict) {
+            a.server = nil
+            a.serverActive = false
+            a.setStatus("Port in use", err.Error())
+            a.serverMutex.Unlock()
+            server.Stop()
+            go a.resolvePortConflict(conflict)
+            return
+        }
+
+        if time.Since(started) > stableRunTime {
+            delay = minRestartDelay
+        }
+        slog.Error("Server failed, restarting", "error", err, "delay", delay)
+        a.setStatus("Restarting", err.Error())
+        a.serverMutex.Unlock()
+
+        // Only the first failure of a crash loop is worth a notification
+        if delay == minRestartDelay {
+            if err := notify("OpenRouter Proxy", "The server failed and is restarting: "+err.Error()); err != nil {
+                slog.Error("Failed to show notification", "error", err)
+            }
+        }
+
+        // Release whatever the failed server still holds
+        server.Stop()
+        time.Sleep(delay)
+        delay = min(delay*2, maxRestartDelay)
+
+        a.serverMutex.Lock()
+        if a.server != server {
+            // Stopped by the user while waiting
+            a.serverMutex.Unlock()
+            return
+        }
+        a.restarts++
+        server = a.newServer(apiKey)
+        server.restarts = restartStats{
+            Restarts:    a.restarts,
+            LastFailure: err.Error(),
+            LastRestart: time.Now().Format(time.RFC3339),
+        }
+        a.server = server
+        a.setStatus("Starting", "")
+        a.serverMutex.Unlock()
+    }
+}
+
+// resolvePortConflict tells the user the port is taken and offers to start
+// on a free port instead, or to quit Ollama when it holds the port
+func (a *App) resolvePortConflict(conflict *portInUseError) {
+    if err := notify("OpenRouter Proxy", "Could not start: "+conflict.Error()); err != nil {
+        slog.Error("Failed to show notification", "error", err)
+    }
+
+    owner := conflict.Owner
+    if owner == "" {
+        owner = "another program"
+    }
+    text := fmt.Sprintf("Port %d is already in use by %s, so the proxy could not start.", conflict.Port, owner)
+    options := []zenity.Option{zenity.Title("Port in Use"), zenity.CancelLabel("Stay Stopped")}
+    port := freePort(conflict.Port)
+    if port != 0 {
+        text += fmt.Sprintf("\n\nClients that expect Ollama's port need to be pointed at the new one if you start on port %d.", port)
+        options = append(options, zenity.OKLabel(fmt.Sprintf("Use Port %d", port)))
+    } else {
+        options = append(options, zenity.OKLabel("Retry"))
+    }
+    if conflict.Owner == portOwnerOllama && canQuitOllama() {
+        options = append(options, zenity.ExtraButton("Quit Ollama"))
+    }
+
+    err := zenity.Question(text, options...)
+    switch {
+    case errors.Is(err, zenity.ErrExtraButton):
+        if err := quitOllama(); err != nil {
+            slog.Error("Failed to quit Ollama", "error", err)
+            zenity.Error("Failed to quit Ollama: "+err.Error(), zenity.Title("Port in Use"))
+            return
+        }
+        // Give Ollama a moment to release the port
+        time.Sleep(2 * time.Second)
+    case err != nil:
+        return
+    case port != 0:
+        a.serverMutex.Lock()
+        a.config.Port = port
+        if err := SaveConfig(a.config); err != nil {
+            slog.Error("Failed to save config", "error", err)
+        }
+        a.serverMutex.Unlock()
+        slog.Info("Switched to a free port", "port", port)
+    }
+    a.startServer()
+}
+
+// runServer runs the server until it stops, turning a panic into an error
+func runServer(server *Server) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("server panicked: %v", r)
+        }
+    }()
+    return server.Start()
+}
+
+// setStatus reflects the server state in the tray icon and menu. detail,
+// if set, is shown in the tooltip so failures are visible without logs.
+func (a *App) setStatus(status, detail string) {
+    if a.mStatus != nil {
+        title := "Status: " + status
+        if a.restarts == 1 {
+            title += " (restarted once)"
+        } else if a.restarts > 1 {
+            title += fmt.Sprintf(" (restarted %d times)", a.restarts)
+        }
+        a.mStatus.SetTitle(title)
+    }
+    if a.mToggle != nil {
+        if !a.serverActive {
+            a.mToggle.SetTitle("Start Server")
+        } else {
+            a.mToggle.SetTitle("Stop Server")
+        }
+    }
+
+    tooltip := "OpenRouter Proxy for Ollama"
+    if detail != "" {
+        tooltip += " - " + status + ": " + detail
+    }
+    systray.SetTooltip(tooltip)
+
+    switch status {
+    case "Running":
+        systray.SetIcon(getActiveIcon())
+    case "Degraded":
+        systray.SetIcon(getDegradedIcon())
+    default:
+        systray.SetIcon(getIcon())
+    }
+}
+
+// watchCredits keeps the credits and spend menu items up to date
+func (a *App) watchCredits() {
+    ticker := time.NewTicker(creditsRefreshInterval)
+    defer ticker.Stop()
+    for {
+        a.refreshCredits()
+        <-ticker.C
+    }
+}
+
+// refreshCredits fetches the remaining credits and today's spend, and warns
+// once when credits drop below the configured threshold
+func (a *App) refreshCredits() {
+    a.serverMutex.Lock()
+    server := a.server
+    threshold := a.config.CreditsWarningUSD
+    a.serverMutex.Unlock()
+
+    if server != nil {
+        if spent, ok := server.SpentToday(); ok {
+            a.mSpend.SetTitle(fmt.Sprintf("Today: $%.2f", spent))
+        }
+        stats := server.Stats()
+        a.mRequests.SetTitle(fmt.Sprintf("Requests: %d (%d errors)", stats.Requests, stats.Errors))
+    }
+
+    apiKey, err := resolveAPIKey()
+    if err != nil {
+        return
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    credits, err := NewOpenrouterProvider(apiKey, nil, nil, RetryConfig{}, TimeoutConfig{}, nil).Credits(ctx)
+    if err != nil {
+        slog.Error("Failed to fetch credits", "error", err)
+        return
+    }
+    a.mCredits.SetTitle(fmt.Sprintf("Credits: $%.2f", credits))
+
+    if threshold <= 0 || credits >= threshold {
+        a.lowCreditsNotified = false
+        return
+    }
+    if !a.lowCreditsNotified {
+        a.lowCreditsNotified = true
+        message := fmt.Sprintf("Only $%.2f of OpenRouter credits left", credits)
+        if err := notify("OpenRouter Proxy", message); err != nil {
+            slog.Error("Failed to show notification", "error", err)
+        }
+    }
+}
+
+// addRecentRequestsMenu adds the Recent Requests submenu. Clicking a request
+// opens the dashboard, which has the details.
+func (a *App) addRecentRequestsMenu() {
+    a.mRecent = systray.AddMenuItem("Recent Requests", "The last requests made through the proxy")
+    a.mRecent.Disable()
+    for i := 0; i < trayRecentRequests; i++ {
+        item := a.mRecent.AddSubMenuItem("", "")
+        item.Hide()
+        a.recentItems = append(a.recentItems, item)
+        go func() {
+            for range item.ClickedCh {
+                a.openDashboard()
+            }
+        }()
+    }
+}
+
+// watchRecentRequests keeps the Recent Requests submenu up to date
+func (a *App) watchRecentRequests() {
+    ticker := time.NewTicker(recentRequestsInterval)
+    defer ticker.Stop()
+    for {
+        a.refreshRecentRequests()
+        <-ticker.C
+    }
+}
+
+// refreshRecentRequests lists the last requests recorded by the usage store
+// in the Recent Requests submenu
+func (a *App) refreshRecentRequests() {
+    a.serverMutex.Lock()
+    server := a.server
+    a.serverMutex.Unlock()
+
+    if server == nil {
+        return
+    }
+    requests := server.RecentRequests(trayRecentRequests)
+    for i, item := range a.recentItems {
+        if i >= len(requests) {
+            item.Hide()
+            continue
+        }
+        item.SetTitle(recentRequestTitle(requests[i]))
+        item.SetTooltip(requests[i].UpstreamModel)
+        item.Show()
+    }
+    if len(requests) > 0 {
+        a.mRecent.Enable()
+    }
+}
+
+// recentRequestTitle describes a request in one line of the menu
+func recentRequestTitle(r recentRequest) string {
+    title := fmt.Sprintf("%s  %s  %d tokens  $%.4f  %.1fs", r.Time.Local().Format("15:04"), r.Model, r.Tokens, r.Cost, float64(r.DurationMs)/1000)
+    if r.Status != OutcomeSuccess {
+        title += "  " + r.Status
+    }
+    return title
+}
+
+// watchUpdates looks for a newer release once a day and shows the Update
+// Available item when there is one, notifying once per release
+func (a *App) watchUpdates() {
+    notified := ""
+    ticker := time.NewTicker(updateCheckInterval)
+    defer ticker.Stop()
+    for {
+        ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+        latest, newer, err := CheckForUpdate(ctx)
+        cancel()
+        if err != nil {
+            slog.Warn("Failed to check for updates", "error", err)
+        } else if newer {
+            a.serverMutex.Lock()
+            a.updateURL = latest.HTMLURL
+            a.serverMutex.Unlock()
+            a.mUpdate.SetTitle("Update Available: " + latest.TagName)
+            a.mUpdate.Show()
+            if notified != latest.TagName {
+                notified = latest.TagName
+                slog.Info("Update available", "version", latest.TagName, "current", version)
+                if err := notify("OpenRouter Proxy", "Version "+latest.TagName+" is available. Choose Update Available in the menu to get it."); err != nil {
+                    slog.Error("Failed to show notification", "error", err)
+                }
+            }
+        }
+        <-ticker.C
+    }
+}
+
+// openUpdatePage opens the page of the newer release in the browser
+func (a *App) openUpdatePage() {
+    a.serverMutex.Lock()
+    url := a.updateURL
+    a.serverMutex.Unlock()
+
+    if url == "" {
+        return
+    }
+    if err := open.Run(url); err != nil {
+        slog.Error("Failed to open release page", "error", err)
+    }
+}
+
+// refreshModels makes the running server fetch the model list again instead
+// of waiting for its cache to expire
+func (a *App) refreshModels() {
+    a.serverMutex.Lock()
+    server := a.server
+    a.serverMutex.Unlock()
+
+    if server == nil {
+        return
+    }
+    if err := server.RefreshModels(); err != nil {
+        slog.Error("Failed to refresh models", "error", err)
+        return
+    }
+    slog.Info("Model list refreshed")
+    a.refreshModelMenu()
+}
+
+// reloadConfig reads config.json again and applies it to the running server
+// without stopping it
+func (a *App) reloadConfig() {
+    config, err := LoadConfig()
+    if err != nil {
+        slog.Error("Failed to reload config", "error", err)
+        zenity.Error("Failed to reload the configuration: "+err.Error(), zenity.Title("Reload Config"))
+        return
+    }
+
+    a.serverMutex.Lock()
+    a.config = config
+    server := a.server
+    a.serverMutex.Unlock()
+
+    if server == nil {
+        return
+    }
+    if err := server.Reload(config); err != nil {
+        slog.Error("Failed to reload config", "error", err)
+        zenity.Error("Failed to apply the configuration: "+err.Error(), zenity.Title("Reload Config"))
+        return
+    }
+    a.refreshModelMenu()
+}
+
+// addProfileMenu adds a submenu switching between the configuration
+// profiles, if there are any
+func (a *App) addProfileMenu() {
+    names := a.config.profileNames()
+    if len(names) == 0 {
+        return
+    }
+
+    mProfile := systray.AddMenuItem("Profile", "Switch the configuration profile")
+    items := map[string]*systray.MenuItem{}
+    for _, name := range append([]string{""}, names...) {
+        title := name
+        if name == "" {
+            title = "None"
+        }
+        item := mProfile.AddSubMenuItemCheckbox(title, "Use the settings of this profile", name == a.config.ActiveProfile)
+        items[name] = item
+        go func() {
+            for range item.ClickedCh {
+                if !a.switchProfile(name) {
+                    continue
+                }
+                for other, otherItem := range items {
+                    if other == name {
+                        otherItem.Check()
+                    } else {
+                        otherItem.Uncheck()
+                    }
+                }
+            }
+        }()
+    }
+}
+
+// switchProfile makes a profile active, saves the choice and applies it to
+// the running server. It reports whether the profile was switched.
+func (a *App) switchProfile(name string) bool {
+    config, err := LoadConfig()
+    if err != nil {
+        slog.Error("Failed to switch profile", "profile", name, "error", err)
+        zenity.Error("Failed to read the configuration: "+err.Error(), zenity.Title("Profile"))
+        return false
+    }
+    config.ActiveProfile = name
+    if err := SaveConfig(config); err != nil {
+        slog.Error("Failed to switch profile", "profile", name, "error", err)
+        return false
+    }
+
+    a.serverMutex.Lock()
+    a.config = config
+    server := a.server
+    a.serverMutex.Unlock()
+
+    if server != nil {
+        if err := server.Reload(config); err != nil {
+            slog.Error("Failed to apply profile", "profile", name, "error", err)
+            zenity.Error("Failed to apply the profile: "+err.Error(), zenity.Title("Profile"))
+            return false
+        }
+        go a.refreshModelMenu()
+    }
+    slog.Info("Profile switched", "profile", name)
+    return true
+}
+
+// refreshModelMenu fills the Models submenu with the models of the running
+// server, grouped by vendor, and checks those the model filter lets through.
+// Items of models no longer listed are hidden, since systray can't remove
+// them.
+func (a *App) refreshModelMenu() {
+    a.serverMutex.Lock()
+    server := a.server
+    a.serverMutex.Unlock()
+
+    a.modelMenuMu.Lock()
+    defer a.modelMenuMu.Unlock()
+
+    var gen *Server
+    if server != nil {
+        gen = server.running()
+    }
+    if gen == nil {
+        a.mModels.Disable()
+        return
+    }
+    models, err := gen.provider.GetModels()
+    if err != nil {
+        slog.Error("Failed to list models for the menu", "error", err)
+        return
+    }
+    if a.modelItems == nil {
+        a.vendorItems = map[string]*systray.MenuItem{}
+        a.modelItems = map[string]*systray.MenuItem{}
+    }
+
+    sort.Slice(models, func(i, j int) bool { return models[i].fullName < models[j].fullName })
+    listed := map[string]bool{}
+    shown, total := map[string]int{}, map[string]int{}
+    for _, model := range models {
+        vendor, _, found := strings.Cut(model.fullName, "/")
+        if !found || model.fullName == "" {
+            // Local aliases and personas have no vendor and aren't filtered
+            continue
+        }
+        vendorItem, ok := a.vendorItems[vendor]
+        if !ok {
+            vendorItem = a.mModels.AddSubMenuItem(vendor, "Models by "+vendor)
+            a.vendorItems[vendor] = vendorItem
+        }
+        allowed := gen.allowedByFilter(model.fullName)
+        item, ok := a.modelItems[model.fullName]
+        if !ok {
+            item = vendorItem.AddSubMenuItemCheckbox(model.Model, model.fullName, allowed)
+            a.modelItems[model.fullName] = item
+            go a.handleModelItem(model.fullName, item)
+        }
+        if allowed {
+            item.Check()
+            shown[vendor]++
+        } else {
+            item.Uncheck()
+        }
+        item.Show()
+        total[vendor]++
+        listed[model.fullName] = true
+    }
+
+    for name, item := range a.modelItems {
+        if !listed[name] {
+            item.Hide()
+        }
+    }
+    for vendor, item := range a.vendorItems {
+        if total[vendor] == 0 {
+            item.Hide()
+            continue
+        }
+        item.SetTitle(fmt.Sprintf("%s (%d/%d)", vendor, shown[vendor], total[vendor]))
+        item.Show()
+    }
+    a.mModels.Enable()
+}
+
+// handleModelItem shows or hides a model when its item in the Models
+// submenu is clicked, by adding it to or removing it from the model filter
+// file. The filter is asked rather than the checkbox, which may be out of
+// date after edits in the dashboard or the admin API.
+func (a *App) handleModelItem(model string, item *systray.MenuItem) {
+    for range item.ClickedCh {
+        a.serverMutex.Lock()
+        server := a.server
+        a.serverMutex.Unlock()
+
+        var gen *Server
+        if server != nil {
+            gen = server.running()
+        }
+        if gen == nil {
+            continue
+        }
+
+        var err error
+        if !gen.allowedByFilter(model) {
+            err = gen.addToFilter(model)
+        } else {
+            var models []Model
+            var removed bool
+            if models, err = gen.provider.GetModels(); err == nil {
+                removed, err = gen.removeFromFilter(model, models)
+            }
+            if err == nil && !removed {
+                zenity.Info(shortModelName(model)+" is shown because a pattern in the model filter matches it. Edit the model filter to hide it.", zenity.Title("Models"))
+            }
+        }
+        if err != nil {
+            slog.Error("Failed to update the model filter", "model", model, "error", err)
+            zenity.Error("Failed to update the model filter: "+err.Error(), zenity.Title("Models"))
+        }
+        a.refreshModelMenu()
+    }
+}
+
+// testModel lets the user choose a model and sends it a short prompt
+// through the running proxy, then notifies with the round-trip time and the
+// start of the answer
+func (a *App) testModel() {
+    a.serverMutex.Lock()
+    server := a.server
+    lastTested := a.lastTestedModel
+    a.serverMutex.Unlock()
+
+    if server == nil {
+        zenity.Info("Start the server to test a model.", zenity.Title("Test Model"))
+        return
+    }
+    models, err := server.ListedModels()
+    if err != nil {
+        slog.Error("Failed to list models", "error", err)
+        zenity.Error("Failed to list the models: "+err.Error(), zenity.Title("Test Model"))
+        return
+    }
+    if len(models) == 0 {
+        zenity.Info("No models are listed. Check the model filter.", zenity.Title("Test Model"))
+        return
+    }
+
+    options := []zenity.Option{zenity.Title("Test Model")}
+    if lastTested != "" {
+        options = append(options, zenity.DefaultItems(lastTested))
+    }
+    model, err := zenity.List("Choose a model to send a short test prompt to:", models, options...)
+    if err != nil || model == "" {
+        return
+    }
+    a.serverMutex.Lock()
+    a.lastTestedModel = model
+    a.serverMutex.Unlock()
+
+    result, err := server.TestModel(model)
+    title, message := "Test Model", ""
+    if err != nil {
+        slog.Error("Model test failed", "model", model, "error", err)
+        title, message = "Test Model Failed", model+": "+err.Error()
+    } else {
+        slog.Info("Model test succeeded", "model", model, "latency", result.Latency)
+        answer := snippet(result.Answer, 120)
+        if answer == "" {
+            answer = "(empty answer)"
+        }
+        message = fmt.Sprintf("%s answered in %s: %s", model, result.Latency.Round(10*time.Millisecond), answer)
+    }
+    if err := notify(title, message); err != nil {
+        slog.Error("Failed to show notification", "error", err)
+    }
+}
+
+// showAPIKeyDialog asks for the API key in a native dialog with masked
+// input, until a valid key is entered or the dialog is cancelled
 func (a *App) showAPIKeyDialog() {
-    // For simplicity, we'll use a command-line prompt for now
-    // In a real application, you would use a proper GUI dialog
-    fmt.Println("Please enter your OpenRouter API key:")
-    var apiKey string
-    fmt.Scanln(&apiKey)
-
-    if apiKey != "" {
-        err := SetAPIKey(apiKey)
+    for {
+        apiKey, err := zenity.Entry("Enter your OpenRouter API key:",
+            zenity.Title("Configure API Key"),
+            zenity.HideText())
+        if errors.Is(err, zenity.ErrCanceled) {
+            return
+        }
         if err != nil {
+            slog.Error("Failed to show API key dialog", "error", err)
+            return
+        }
+
+        apiKey = strings.TrimSpace(apiKey)
+        if apiKey == "" {
+            zenity.Error("Please enter an API key.", zenity.Title("Invalid API Key"))
+            continue
+        }
+        if err := VerifyAPIKey(apiKey); errors.Is(err, ErrInvalidAPIKey) {
+            zenity.Error("OpenRouter did not accept this API key.", zenity.Title("Invalid API Key"))
+            continue
+        } else if err != nil {
+            // Offline: keep the key, requests will tell if it is wrong
+            slog.Warn("Could not verify API key", "error", err)
+        }
+
+        if err := SetAPIKey(apiKey); err != nil {
             slog.Error("Failed to save API key", "error", err)
-        } else {
-            fmt.Println("API key saved successfully!")
+            zenity.Error("The API key could not be saved: "+err.Error(), zenity.Title("Configure API Key"))
+            return
         }
+        zenity.Info("API key saved successfully.", zenity.Title("Configure API Key"))
+        return
+    }
+}
+
+// copyAccessToken copies the first access token to the clipboard. Without
+// one, a token is generated and saved, which turns on client
+// authentication; a running server is restarted to enforce it.
+func (a *App) copyAccessToken() {
+    a.serverMutex.Lock()
+    created := len(a.config.AccessTokens) == 0
+    if created {
+        a.config.AccessTokens = []string{randomHex(24)}
+        if err := SaveConfig(a.config); err != nil {
+            slog.Error("Failed to save config", "error", err)
+        }
+    }
+    token := a.config.AccessTokens[0]
+    restart := created && a.serverActive
+    a.serverMutex.Unlock()
+
+    if restart {
+        a.stopServer()
+        a.startServer()
+    }
+
+    if err := copyToClipboard(token); err != nil {
+        slog.Error("Failed to copy access token", "error", err)
+        zenity.Info("Access token:\n\n"+token, zenity.Title("Access Token"))
+        return
+    }
+    if created {
+        zenity.Info("Client authentication is now on. A new access token was copied to the clipboard; configure it in your clients as the API key.", zenity.Title("Access Token"))
     }
 }
 
 // openModelFilter opens the model filter file in the default text editor
 func (a *App) openModelFilter() {
+    path := a.config.modelFilterPath()
+
     // Ensure the model filter file exists
-    if _, err := os.Stat(a.config.LastUsedModelFilter); os.IsNotExist(err) {
+    if _, err := os.Stat(path); os.IsNotExist(err) {
         // Create an empty file if it doesn't exist
-        file, err := os.Create(a.config.LastUsedModelFilter)
+        file, err := os.Create(path)
         if err != nil {
             slog.Error("Failed to create model filter file", "error", err)
             return
@@ -192,15 +997,50 @@ func (a *App) openModelFilter() {
     }
 
     // Open the file in the default text editor
-    err := open.Run(a.config.LastUsedModelFilter)
+    err := open.Run(path)
     if err != nil {
         slog.Error("Failed to open model filter file", "error", err)
     }
 }
 
+// viewLogs opens the recent log messages in the default editor
+func (a *App) viewLogs() {
+    path, err := recentLogs.dumpToTempFile()
+    if err != nil {
+        slog.Error("Failed to write logs", "error", err)
+        return
+    }
+    if err := open.Run(path); err != nil {
+        slog.Error("Failed to open logs", "error", err)
+    }
+}
+
+// openDashboard opens the web dashboard in the browser. The running server
+// knows its address best; otherwise the overrides and the active profile
+// are applied to the config, as they would be when it starts.
+func (a *App) openDashboard() {
+    a.serverMutex.Lock()
+    server := a.server
+    config := a.config
+    a.serverMutex.Unlock()
+
+    var url string
+    if server != nil {
+        url = server.localURL("/dashboard")
+    } else {
+        if err := effectiveConfig(&config); err != nil {
+            slog.Warn("Some settings could not be applied", "error", err)
+        }
+        url = config.localURL("/dashboard")
+    }
+    if err := open.Run(url); err != nil {
+        slog.Error("Failed to open dashboard", "error", err)
+    }
+}
+
 // showAbout shows information about the application
 func (a *App) showAbout() {
-    message := `OpenRouter Proxy for Ollama
+    message := `OpenRouter Proxy for Ollama ` + version + `
 
 This application provides a proxy server that emulates Ollama's REST API
 but forwards requests to OpenRouter.
@@ -236,4 +1076,11 @@ func getIcon() []byte {
 func getActiveIcon() []byte {
     // TODO: Replace with a proper .icns file for macOS
     return getIcon() // Using the same icon for now
+}
+
+// getDegradedIcon returns the icon for when the server runs but upstream
+// requests fail
+func getDegradedIcon() []byte {
+    // TODO: Replace with a warning variant of the icon
+    return getIcon() // Using the same icon for now
 }
\ No newline at end of file
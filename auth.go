@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientToken extracts the access token a client sent. Clients differ in
+// how they pass API keys to Ollama servers, so besides "Bearer <token>" we
+// accept a bare token, HTTP basic auth (the password, or the user name when
+// the password is empty) and an X-API-Key header.
+func clientToken(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if auth == "" {
+		return ""
+	}
+
+	scheme, rest, found := strings.Cut(auth, " ")
+	if !found {
+		return auth
+	}
+	rest = strings.TrimSpace(rest)
+
+	switch strings.ToLower(scheme) {
+	case "bearer", "token":
+		return rest
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(rest)
+		if err != nil {
+			return ""
+		}
+		user, password, _ := strings.Cut(string(decoded), ":")
+		if password != "" {
+			return password
+		}
+		return user
+	}
+
+	return ""
+}
+
+// isAccessToken reports whether token is one of the configured access tokens
+// or client keys
+func (s *Server) isAccessToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range s.config.AccessTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	_, ok := s.clientKey(token)
+	return ok
+}
+
+// authRequired reports whether clients must present a token
+func (s *Server) authRequired() bool {
+	return len(s.config.AccessTokens) > 0 || len(s.config.ClientKeys) > 0
+}
+
+// adminPathPrefixes are the operator-facing surfaces guarded by the admin
+// token instead of the client access tokens
+var adminPathPrefixes = []string{"/metrics", "/debug", "/admin", "/dashboard"}
+
+// isAdminPath reports whether path belongs to an admin surface
+func isAdminPath(path string) bool {
+	for _, prefix := range adminPathPrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback reports whether the request comes from the local machine.
+// Forwarding headers are ignored since any client can set them.
+func isLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// crossSiteReason returns why an admin request may come from a web page
+// the user visited rather than from the user, or "" if it can't. Browsers
+// send the Origin of cross-site requests, and a page can only send JSON to
+// another site after a CORS preflight, which is only answered for allowed
+// origins.
+func (s *Server) crossSiteReason(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && !s.allowedOrigin(origin) && !sameOrigin(origin, r) {
+		return "origin " + origin + " is not allowed to use admin endpoints"
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.ContentLength != 0 && mediaType != "application/json" {
+			return "admin requests must be sent as application/json"
+		}
+	}
+	return ""
+}
+
+// sameOrigin reports whether origin is the host the request was sent to,
+// e.g. the dashboard opened on a LAN address
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// adminMiddleware guards the admin surfaces. With an admin token configured
+// it must be presented (in any form clientToken accepts); without one, only
+// loopback clients are let in, so a LAN-facing listener doesn't expose them.
+// Either way, requests a foreign web page may have sent are rejected.
+func (s *Server) adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdminPath(c.Request.URL.Path) || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		if reason := s.crossSiteReason(c.Request); reason != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+
+		if s.config.AdminToken == "" {
+			if !isLoopback(c.Request) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are only available from localhost"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		token := clientToken(c.Request)
+		if subtle.ConstantTimeCompare([]byte(s.config.AdminToken), []byte(token)) != 1 {
+			// Browsers only prompt for credentials on a Basic challenge
+			if strings.HasPrefix(c.Request.URL.Path, "/dashboard") {
+				c.Header("WWW-Authenticate", `Basic realm="admin"`)
+			} else {
+				c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authMiddleware requires a valid access token on every request once access
+// tokens or client keys are configured. The root health check and CORS preflights stay
+// open because clients call them before sending credentials; admin surfaces
+// are left to adminMiddleware.
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !s.authRequired() || path == "/" || isAdminPath(path) || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		if !s.isAccessToken(clientToken(c.Request)) {
+			c.Header("WWW-Authenticate", `Bearer realm="ollama"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
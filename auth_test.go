@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminRejectsCrossSiteRequests(t *testing.T) {
+	s := newTestServer(t, newStubUpstream(t, nil), DefaultConfig())
+
+	tests := []struct {
+		name        string
+		origin      string
+		contentType string
+		want        int
+	}{
+		{name: "json without origin", contentType: "application/json", want: http.StatusOK},
+		{name: "json from localhost page", origin: "http://localhost:11434", contentType: "application/json", want: http.StatusOK},
+		{name: "json from same host", origin: "http://example.com", contentType: "application/json; charset=utf-8", want: http.StatusOK},
+		{name: "json from foreign page", origin: "https://evil.example", contentType: "application/json", want: http.StatusForbidden},
+		{name: "text from foreign page", origin: "https://evil.example", contentType: "text/plain", want: http.StatusForbidden},
+		{name: "text without origin", contentType: "text/plain", want: http.StatusForbidden},
+		{name: "form", contentType: "application/x-www-form-urlencoded", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com/dashboard/api/filter", strings.NewReader(`{"model": "openai/gpt-4o"}`))
+			req.RemoteAddr = "127.0.0.1:50000"
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if w := serveRequest(s, req); w.Code != tt.want {
+				t.Errorf("status %d: %s, want %d", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
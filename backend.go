@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// BackendConfig configures an upstream API used next to OpenRouter. Models
+// whose name starts with the backend's prefix are sent to it, with the
+// prefix removed.
+type BackendConfig struct {
+	// Name identifies the backend and its API key in the keychain
+	Name string `json:"name"`
+	// Type is "openai", "anthropic", "groq", "mistral" or "custom"
+	Type string `json:"type"`
+	// BaseURL is the OpenAI-compatible endpoint; required for "custom"
+	BaseURL string `json:"base_url,omitempty"`
+	// Prefix selects the backend by model name; defaults to "<name>/"
+	Prefix string `json:"prefix,omitempty"`
+	// APIKeyEnv names an environment variable holding the API key, for
+	// hosts without a keychain
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+}
+
+// backendBaseURLs are the OpenAI-compatible endpoints of the known backend
+// types
+var backendBaseURLs = map[string]string{
+	"openai":    "https://api.openai.com/v1/",
+	"anthropic": "https://api.anthropic.com/v1/",
+	"groq":      "https://api.groq.com/openai/v1/",
+	"mistral":   "https://api.mistral.ai/v1/",
+}
+
+// backendKeyName is the keychain entry holding the API key of a backend
+func backendKeyName(name string) string {
+	return "backend-" + name
+}
+
+// GetBackendAPIKey retrieves the API key of a backend from the keyring
+func GetBackendAPIKey(name string) (string, error) {
+	return getSecret(backendKeyName(name))
+}
+
+// SetBackendAPIKey stores the API key of a backend in the keyring
+func SetBackendAPIKey(name, apiKey string) error {
+	return setSecret(backendKeyName(name), apiKey)
+}
+
+// backend is a configured upstream together with its model prefix
+type backend struct {
+	name     string
+	prefix   string
+	provider *OpenrouterProvider
+}
+
+// newBackend creates the provider for a backend configuration
+func newBackend(config BackendConfig, retry RetryConfig, timeouts TimeoutConfig) (*backend, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("backend without a name")
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = backendBaseURLs[config.Type]
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("backend %s: base_url is required for type %q", config.Name, config.Type)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	apiKey := ""
+	if config.APIKeyEnv != "" {
+		apiKey = os.Getenv(config.APIKeyEnv)
+	}
+	if apiKey == "" {
+		var err error
+		if apiKey, err = GetBackendAPIKey(config.Name); err != nil {
+			return nil, fmt.Errorf("backend %s: no API key: %w", config.Name, err)
+		}
+	}
+
+	// Anthropic's model listing only accepts its own authentication headers
+	headers := map[string]string{}
+	if config.Type == "anthropic" {
+		headers["x-api-key"] = apiKey
+		headers["anthropic-version"] = "2023-06-01"
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = config.Name + "/"
+	}
+
+	return &backend{
+		name:   config.Name,
+		prefix: prefix,
+		provider: newCompatibleProvider(baseURL, apiKey, &upstreamTransport{
+			base:       upstreamBaseTransport(timeouts),
+			headers:    headers,
+			retry:      retry,
+			thirdParty: true,
+		}),
+	}, nil
+}
+
+// providerRouter sends each request to the backend selected by the model's
+// prefix, and everything else to OpenRouter
+type providerRouter struct {
+	primary  *OpenrouterProvider
+	backends []*backend
+}
+
+// newProvider creates the upstream provider for a configuration: OpenRouter
+// alone, or a router over OpenRouter and the configured backends
+func newProvider(apiKey string, config Config) (Provider, error) {
+	if err := config.Retry.validate(); err != nil {
+		return nil, err
+	}
+	primary := NewOpenrouterProvider(apiKey, config.APIKeys, config.openrouterHeaders(), config.Retry, config.Timeouts, newRequestLimiter(config.Limits))
+	primary.modelsTTL = modelCacheTTL(config.ModelCacheTTLSeconds)
+	if len(config.Backends) == 0 {
+		return primary, nil
+	}
+
+	router := &providerRouter{primary: primary}
+	for _, bc := range config.Backends {
+		b, err := newBackend(bc, config.Retry, config.Timeouts)
+		if err != nil {
+			return nil, err
+		}
+		b.provider.modelsTTL = primary.modelsTTL
+		router.backends = append(router.backends, b)
+		slog.Info("Using backend", "name", b.name, "prefix", b.prefix)
+	}
+	return router, nil
+}
+
+// route returns the backend for a model name and the name without the
+// backend prefix, or nil if the model belongs to OpenRouter
+func (r *providerRouter) route(model string) (*backend, string) {
+	for _, b := range r.backends {
+		if rest, ok := strings.CutPrefix(model, b.prefix); ok {
+			return b, rest
+		}
+	}
+	return nil, model
+}
+
+// providerFor returns the provider serving a model and the model name it
+// knows the model by
+func (r *providerRouter) providerFor(model string) (*OpenrouterProvider, string) {
+	if b, rest := r.route(model); b != nil {
+		return b.provider, rest
+	}
+	return r.primary, model
+}
+
+func (r *providerRouter) Chat(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p, model := r.providerFor(req.Model)
+	req.Model = model
+	return p.Chat(ctx, req)
+}
+
+func (r *providerRouter) ChatStream(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
+	p, model := r.providerFor(req.Model)
+	req.Model = model
+	return p.ChatStream(ctx, req)
+}
+
+func (r *providerRouter) Complete(ctx context.Context, req openai.CompletionRequest) (openai.CompletionResponse, error) {
+	p, model := r.providerFor(req.Model)
+	req.Model = model
+	return p.Complete(ctx, req)
+}
+
+func (r *providerRouter) CompleteStream(ctx context.Context, req openai.CompletionRequest) (*openai.CompletionStream, error) {
+	p, model := r.providerFor(req.Model)
+	req.Model = model
+	return p.CompleteStream(ctx, req)
+}
+
+func (r *providerRouter) Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, openai.Usage, error) {
+	p, model := r.providerFor(model)
+	return p.Embed(ctx, model, inputs, dimensions)
+}
+
+// GetModels lists the OpenRouter models followed by the models of every
+// backend, named with the backend prefix. A failing backend is logged and
+// left out rather than failing the whole list.
+func (r *providerRouter) GetModels() ([]Model, error) {
+	return r.collectModels((*OpenrouterProvider).GetModels)
+}
+
+// RefreshModels is GetModels bypassing the model list caches
+func (r *providerRouter) RefreshModels() ([]Model, error) {
+	return r.collectModels((*OpenrouterProvider).RefreshModels)
+}
+
+// collectModels lists the models of OpenRouter and every backend with list
+func (r *providerRouter) collectModels(list func(*OpenrouterProvider) ([]Model, error)) ([]Model, error) {
+	models, err := list(r.primary)
+	if err != nil {
+		return nil, err
+	}
+	// The cached list of the primary provider must not be appended to
+	models = append([]Model(nil), models...)
+
+	for _, b := range r.backends {
+		backendModels, err := list(b.provider)
+		if err != nil {
+			slog.Error("Failed to list backend models", "backend", b.name, "error", err)
+			continue
+		}
+		for _, m := range backendModels {
+			m.Name = b.prefix + m.Name
+			m.Model = b.prefix + m.Model
+			m.fullName = b.prefix + m.fullName
+			models = append(models, m)
+		}
+	}
+	return models, nil
+}
+
+func (r *providerRouter) GetModelDetails(modelName string) (map[string]interface{}, error) {
+	p, model := r.providerFor(modelName)
+	return p.GetModelDetails(model)
+}
+
+// GetFullModelName resolves an alias on the backend its prefix selects.
+// Without a prefix OpenRouter is tried first, then the backends.
+func (r *providerRouter) GetFullModelName(alias string) (string, error) {
+	if b, rest := r.route(alias); b != nil {
+		fullName, err := b.provider.GetFullModelName(rest)
+		if err != nil {
+			return "", err
+		}
+		return b.prefix + fullName, nil
+	}
+
+	fullName, err := r.primary.GetFullModelName(alias)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := r.primary.FindModel(alias); ok {
+		return fullName, nil
+	}
+	for _, b := range r.backends {
+		if name, ok := b.provider.FindModel(alias); ok {
+			return b.prefix + name, nil
+		}
+	}
+	return alias, nil
+}
+
+func (r *providerRouter) FindModel(alias string) (string, bool) {
+	if b, rest := r.route(alias); b != nil {
+		if fullName, ok := b.provider.FindModel(rest); ok {
+			return b.prefix + fullName, true
+		}
+		return "", false
+	}
+
+	if fullName, ok := r.primary.FindModel(alias); ok {
+		return fullName, true
+	}
+	for _, b := range r.backends {
+		if fullName, ok := b.provider.FindModel(alias); ok {
+			return b.prefix + fullName, true
+		}
+	}
+	return "", false
+}
+
+func (r *providerRouter) ContextLength(fullName string, fallback int) int {
+	p, model := r.providerFor(fullName)
+	return p.ContextLength(model, fallback)
+}
+
+func (r *providerRouter) Cost(fullName string, usage openai.Usage) float64 {
+	p, model := r.providerFor(fullName)
+	return p.Cost(model, usage)
+}
+
+func (r *providerRouter) Do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	return r.primary.Do(ctx, method, path, body)
+}
+
+func (r *providerRouter) listModels(ctx context.Context) ([]openrouterModel, error) {
+	return r.primary.listModels(ctx)
+}
+
+func (r *providerRouter) preferModels(prefer func(fullName string) bool) {
+	r.primary.preferModels(prefer)
+	for _, b := range r.backends {
+		b.provider.preferModels(func(fullName string) bool {
+			return prefer(b.prefix + fullName)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Entries of a configuration bundle
+const (
+	bundleConfigFile = "config.json"
+	bundleFilterFile = "models-filter"
+	bundleModelsFile = "models.json"
+	bundlePluginDir  = "plugins/"
+)
+
+// withoutSecrets returns a copy of config with keys, tokens, headers and
+// proxy credentials that may carry secrets removed, from the profiles too
+func withoutSecrets(config Config) Config {
+	config.APIKeys = nil
+	config.AccessTokens = nil
+	config.ClientKeys = nil
+	config.AdminToken = ""
+	config.UpstreamHeaders = nil
+	config.Webhooks.Headers = nil
+	config.Outbound.ProxyURL = withoutUserinfo(config.Outbound.ProxyURL)
+
+	if config.Profiles != nil {
+		profiles := make(map[string]json.RawMessage, len(config.Profiles))
+		for name, settings := range config.Profiles {
+			// A profile that can't be read can't be cleaned, so it is
+			// left out
+			if cleaned, err := editProfile(settings, removeProfileSecrets); err == nil {
+				profiles[name] = cleaned
+			}
+		}
+		config.Profiles = profiles
+	}
+	return config
+}
+
+// keepSecrets copies the secrets of local into imported, which carries none.
+// Profiles get those of the local profile with the same name.
+func keepSecrets(imported, local Config) Config {
+	imported.APIKeys = local.APIKeys
+	imported.AccessTokens = local.AccessTokens
+	imported.ClientKeys = local.ClientKeys
+	imported.AdminToken = local.AdminToken
+	imported.UpstreamHeaders = local.UpstreamHeaders
+	imported.Webhooks.Headers = local.Webhooks.Headers
+	imported.Outbound.ProxyURL = withUserinfo(imported.Outbound.ProxyURL, local.Outbound.ProxyURL)
+
+	for name, settings := range imported.Profiles {
+		localSettings, ok := local.Profiles[name]
+		if !ok {
+			continue
+		}
+		var localProfile map[string]json.RawMessage
+		if err := json.Unmarshal(localSettings, &localProfile); err != nil {
+			continue
+		}
+		restored, err := editProfile(settings, func(profile map[string]json.RawMessage) {
+			restoreProfileSecrets(profile, localProfile)
+		})
+		if err == nil {
+			imported.Profiles[name] = restored
+		}
+	}
+	return imported
+}
+
+// profileSecretKeys are the settings of a profile that may carry secrets
+// outright; webhooks.headers and the credentials of outbound.proxy_url are
+// handled separately
+var profileSecretKeys = []string{"api_keys", "access_tokens", "client_keys", "admin_token", "upstream_headers"}
+
+// editProfile applies edit to the settings of a profile, decoded as a map of
+// setting names to values
+func editProfile(settings json.RawMessage, edit func(map[string]json.RawMessage)) (json.RawMessage, error) {
+	var profile map[string]json.RawMessage
+	if err := json.Unmarshal(settings, &profile); err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return settings, nil
+	}
+	edit(profile)
+	return json.Marshal(profile)
+}
+
+// removeProfileSecrets drops the settings of a profile that may carry
+// secrets
+func removeProfileSecrets(profile map[string]json.RawMessage) {
+	for _, key := range profileSecretKeys {
+		delete(profile, key)
+	}
+	editSection(profile, "webhooks", func(webhooks map[string]json.RawMessage) {
+		delete(webhooks, "headers")
+	})
+	editSection(profile, "outbound", func(outbound map[string]json.RawMessage) {
+		var proxyURL string
+		if json.Unmarshal(outbound["proxy_url"], &proxyURL) == nil && proxyURL != "" {
+			outbound["proxy_url"], _ = json.Marshal(withoutUserinfo(proxyURL))
+		}
+	})
+}
+
+// restoreProfileSecrets copies the secrets of a local profile into the
+// imported profile of the same name
+func restoreProfileSecrets(profile, local map[string]json.RawMessage) {
+	for _, key := range profileSecretKeys {
+		if value, ok := local[key]; ok {
+			profile[key] = value
+		}
+	}
+	var localWebhooks struct {
+		Headers json.RawMessage `json:"headers"`
+	}
+	if json.Unmarshal(local["webhooks"], &localWebhooks) == nil && localWebhooks.Headers != nil {
+		if _, ok := profile["webhooks"]; !ok {
+			profile["webhooks"] = json.RawMessage("{}")
+		}
+		editSection(profile, "webhooks", func(webhooks map[string]json.RawMessage) {
+			webhooks["headers"] = localWebhooks.Headers
+		})
+	}
+	var localOutbound struct {
+		ProxyURL string `json:"proxy_url"`
+	}
+	if json.Unmarshal(local["outbound"], &localOutbound) == nil && localOutbound.ProxyURL != "" {
+		editSection(profile, "outbound", func(outbound map[string]json.RawMessage) {
+			var proxyURL string
+			if json.Unmarshal(outbound["proxy_url"], &proxyURL) == nil && proxyURL != "" {
+				outbound["proxy_url"], _ = json.Marshal(withUserinfo(proxyURL, localOutbound.ProxyURL))
+			}
+		})
+	}
+}
+
+// editSection applies edit to a section of a profile, such as "webhooks",
+// if the profile sets it
+func editSection(profile map[string]json.RawMessage, name string, edit func(map[string]json.RawMessage)) {
+	var section map[string]json.RawMessage
+	if err := json.Unmarshal(profile[name], &section); err != nil || section == nil {
+		return
+	}
+	edit(section)
+	if data, err := json.Marshal(section); err == nil {
+		profile[name] = data
+	}
+}
+
+// withoutUserinfo drops the user name and password from a proxy URL
+func withoutUserinfo(proxyURL string) string {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || parsed.User == nil {
+		return proxyURL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// withUserinfo gives an imported proxy URL the credentials of the local
+// one, if both name the same proxy
+func withUserinfo(imported, local string) string {
+	if imported == "" || withoutUserinfo(local) != imported {
+		return imported
+	}
+	return local
+}
+
+// ExportBundle writes a zip archive with the configuration (minus secrets),
+// the model filter, the virtual models and the WASM plugins to w
+func ExportBundle(w io.Writer, config Config) error {
+	zw := zip.NewWriter(w)
+
+	data, err := json.MarshalIndent(withoutSecrets(config), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeBundleEntry(zw, bundleConfigFile, data); err != nil {
+		return err
+	}
+
+	if filter, err := os.ReadFile(config.modelFilterPath()); err == nil {
+		if err := writeBundleEntry(zw, bundleFilterFile, filter); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	modelsPath, err := virtualModelsPath()
+	if err != nil {
+		return err
+	}
+	if models, err := os.ReadFile(modelsPath); err == nil {
+		if err := writeBundleEntry(zw, bundleModelsFile, models); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, path := range config.Plugins {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read plugin %s: %w", path, err)
+		}
+		if err := writeBundleEntry(zw, bundlePluginDir+filepath.Base(path), code); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeBundleEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// ImportBundle reads a bundle written by ExportBundle and installs it: the
+// model filter goes to the path named in the imported config, plugins to
+// the plugins directory next to config.json. Secrets of the current
+// configuration are kept. The new configuration is saved and returned.
+func ImportBundle(path string) (Config, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer zr.Close()
+
+	local, err := LoadConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	configEntry, ok := files[bundleConfigFile]
+	if !ok {
+		return Config{}, errors.New("not a configuration bundle: config.json missing")
+	}
+	data, err := readBundleEntry(configEntry)
+	if err != nil {
+		return Config{}, err
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("invalid config.json in bundle: %w", err)
+	}
+	config = keepSecrets(config, local)
+
+	if f, ok := files[bundleFilterFile]; ok {
+		filter, err := readBundleEntry(f)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := os.WriteFile(config.modelFilterPath(), filter, 0644); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if f, ok := files[bundleModelsFile]; ok {
+		models, err := readBundleEntry(f)
+		if err != nil {
+			return Config{}, err
+		}
+		modelsPath, err := virtualModelsPath()
+		if err != nil {
+			return Config{}, err
+		}
+		if err := os.WriteFile(modelsPath, models, 0644); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if len(config.Plugins) > 0 {
+		configPath, err := GetConfigPath()
+		if err != nil {
+			return Config{}, err
+		}
+		pluginDir := filepath.Join(filepath.Dir(configPath), "plugins")
+		if err := os.MkdirAll(pluginDir, 0755); err != nil {
+			return Config{}, err
+		}
+
+		for i, p := range config.Plugins {
+			name := filepath.Base(p)
+			f, ok := files[bundlePluginDir+name]
+			if !ok {
+				return Config{}, fmt.Errorf("plugin %s missing from bundle", name)
+			}
+			code, err := readBundleEntry(f)
+			if err != nil {
+				return Config{}, err
+			}
+			dest := filepath.Join(pluginDir, name)
+			if err := os.WriteFile(dest, code, 0644); err != nil {
+				return Config{}, err
+			}
+			config.Plugins[i] = dest
+		}
+	}
+
+	if err := SaveConfig(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func readBundleEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// handleExport serves /admin/export, a configuration bundle download. Like
+// the export command it bundles the saved configuration, not the running
+// one with the active profile and environment overrides merged in, so an
+// import keeps the profiles apart.
+func (s *Server) handleExport(c *gin.Context) {
+	config, err := LoadConfig()
+	if err != nil {
+		requestLogger(c).Error("Failed to load configuration", "Error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var buf bytes.Buffer
+	if err := ExportBundle(&buf, config); err != nil {
+		requestLogger(c).Error("Failed to export configuration", "Error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="openrouter-proxy-config.zip"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportBundlesSavedConfig(t *testing.T) {
+	upstream := newStubUpstream(t, nil)
+	config := DefaultConfig()
+	config.Profiles = map[string]json.RawMessage{"work": json.RawMessage(`{"budget": {"daily_usd": 5}}`)}
+	config.ActiveProfile = "work"
+	s := newTestServer(t, upstream, config)
+	if s.config.Budget.DailyUSD != 5 {
+		t.Fatalf("running budget = %v, want the profile's 5", s.config.Budget.DailyUSD)
+	}
+	if err := SaveConfig(config); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	req := newJSONRequest(t, http.MethodGet, "/admin/export", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	w := serveRequest(s, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := os.WriteFile(path, w.Body.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportBundle(path)
+	if err != nil {
+		t.Fatalf("ImportBundle: %v", err)
+	}
+	// The profile stays a profile instead of being merged into the base
+	if imported.Budget.DailyUSD != 0 || imported.ActiveProfile != "work" || imported.Profiles["work"] == nil {
+		t.Errorf("imported budget %v, active profile %q, profiles %v; want the saved config", imported.Budget.DailyUSD, imported.ActiveProfile, imported.Profiles)
+	}
+}
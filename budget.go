@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// BudgetConfig caps what the proxy spends on OpenRouter. Caps are in USD;
+// a zero cap is not enforced.
+type BudgetConfig struct {
+	DailyUSD   float64 `json:"daily_usd,omitempty"`
+	MonthlyUSD float64 `json:"monthly_usd,omitempty"`
+	// AllowFreeModels keeps free models usable once a cap is reached
+	AllowFreeModels bool `json:"allow_free_models,omitempty"`
+	// WarnPercent is the share of a cap, 80 by default, at which a
+	// notification warns that it is almost reached
+	WarnPercent float64 `json:"warn_percent,omitempty"`
+}
+
+// defaultBudgetWarnPercent is the default of BudgetConfig.WarnPercent
+const defaultBudgetWarnPercent = 80
+
+// warnAt returns the spending at which a cap of limit is almost reached
+func (b BudgetConfig) warnAt(limit float64) float64 {
+	percent := b.WarnPercent
+	if percent <= 0 {
+		percent = defaultBudgetWarnPercent
+	}
+	return limit * percent / 100
+}
+
+// budgetError rejects a request because a spending cap was reached
+type budgetError struct {
+	period string
+	limit  float64
+	spent  float64
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("%s budget of $%.2f exceeded ($%.2f spent)", e.period, e.limit, e.spent)
+}
+
+// rejectionStatus returns the HTTP status for a request rejected by an
+// interceptor
+func rejectionStatus(err error) int {
+	var be *budgetError
+	if errors.As(err, &be) {
+		return http.StatusPaymentRequired
+	}
+	return http.StatusBadRequest
+}
+
+// isFreeModel reports whether a model costs nothing, by OpenRouter's ":free"
+// naming or by its pricing
+func isFreeModel(p Provider, fullName string) bool {
+	if strings.HasSuffix(fullName, ":free") {
+		return true
+	}
+	if _, known := p.FindModel(fullName); !known {
+		return false
+	}
+	return p.Cost(fullName, openai.Usage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}) == 0
+}
+
+// budgetInterceptor rejects requests once a spending cap is reached
+type budgetInterceptor struct {
+	config   BudgetConfig
+	store    *usageStore
+	ledger   *usageLedger
+	provider Provider
+	notices  *notices
+}
+
+func newBudgetInterceptor(s *Server) Interceptor {
+	if s.config.Budget.DailyUSD <= 0 && s.config.Budget.MonthlyUSD <= 0 {
+		return nil
+	}
+	return &budgetInterceptor{config: s.config.Budget, store: s.usageDB, ledger: s.usage, provider: s.provider, notices: s.notices}
+}
+
+// spentSince returns the spending since the given time. Without the usage
+// database only spending since the server started is known.
+func (b *budgetInterceptor) spentSince(since time.Time) (float64, error) {
+	if b.store == nil {
+		return b.ledger.TotalCost(), nil
+	}
+	return b.store.Spent(since)
+}
+
+func (b *budgetInterceptor) InterceptRequest(ex *Exchange) error {
+	if b.config.AllowFreeModels && isFreeModel(b.provider, ex.Request.Model) {
+		return nil
+	}
+
+	now := time.Now()
+	caps := []struct {
+		period string
+		limit  float64
+		since  time.Time
+	}{
+		{"daily", b.config.DailyUSD, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
+		{"monthly", b.config.MonthlyUSD, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())},
+	}
+	for _, c := range caps {
+		if c.limit <= 0 {
+			continue
+		}
+		spent, err := b.spentSince(c.since)
+		if err != nil {
+			return fmt.Errorf("checking budget: %w", err)
+		}
+		// Notified once per period and threshold
+		key := fmt.Sprintf("budget-%s-%s", c.period, c.since.Format(time.DateOnly))
+		if spent >= c.limit {
+			err := &budgetError{period: c.period, limit: c.limit, spent: spent}
+			b.notices.Send(key+"-reached", "Budget reached", "Requests are rejected: "+err.Error())
+			return err
+		}
+		if spent >= b.config.warnAt(c.limit) {
+			b.notices.Send(key+"-warn", "Budget almost reached",
+				fmt.Sprintf("$%.2f of the %s budget of $%.2f spent", spent, c.period, c.limit))
+		}
+	}
+	return nil
+}
+
+func (b *budgetInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (b *budgetInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
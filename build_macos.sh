@@ -9,9 +9,12 @@ echo "Building OpenRouter Proxy for macOS..."
 echo "Updating dependencies..."
 go mod tidy
 
+# The version is reported in the bundle and used to check for updates
+VERSION="${VERSION:-1.0.0}"
+
 # Build the application with macOS-specific tags
 echo "Building application..."
-go build -tags "darwin" -o OpenRouterProxy app.go || {
+go build -tags "darwin" -ldflags "-X main.version=$VERSION" -o OpenRouterProxy app.go || {
     echo "Build failed!"
     exit 1
 }
@@ -71,7 +74,7 @@ cat > "$CONTENTS_DIR/Info.plist" << EOF
     <key>CFBundlePackageType</key>
     <string>APPL</string>
     <key>CFBundleShortVersionString</key>
-    <string>1.0.0</string>
+    <string>$VERSION</string>
     <key>CFBundleVersion</key>
     <string>1</string>
     <key>LSMinimumSystemVersion</key>
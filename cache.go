@@ -0,0 +1,289 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultCacheEntries is the in-memory cache size when the configuration
+// doesn't say
+const defaultCacheEntries = 1000
+
+// CacheConfig enables caching answers to deterministic (temperature 0)
+// requests, so identical prompts from test suites or RAG pipelines are
+// answered without another upstream call
+type CacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxEntries is how many answers are kept in memory, least recently
+	// used first out; 1000 by default
+	MaxEntries int `json:"max_entries,omitempty"`
+	// TTLSeconds is how long an answer stays valid; 0 keeps it forever
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+	// Dir keeps answers on disk as well, so they survive restarts
+	Dir string `json:"dir,omitempty"`
+}
+
+// cachedAnswer is an upstream answer as the interceptors received it
+type cachedAnswer struct {
+	Content      string       `json:"content"`
+	FinishReason string       `json:"finish_reason"`
+	Usage        openai.Usage `json:"usage"`
+	Created      time.Time    `json:"created"`
+}
+
+type cacheEntry struct {
+	key    string
+	answer cachedAnswer
+}
+
+// responseCache is an LRU of answers by request key, optionally backed by
+// one file per answer
+type responseCache struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	max     int
+	ttl     time.Duration
+	dir     string
+}
+
+// newResponseCache creates the cache for a configuration, or nil if caching
+// is disabled
+func newResponseCache(cfg CacheConfig) (*responseCache, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	max := cfg.MaxEntries
+	if max <= 0 {
+		max = defaultCacheEntries
+	}
+	return &responseCache{
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		max:     max,
+		ttl:     time.Duration(cfg.TTLSeconds) * time.Second,
+		dir:     cfg.Dir,
+	}, nil
+}
+
+// cacheKey returns the key of a request, or "" if its answer must not be
+// cached: sampled answers differ every time, and tool calls aren't kept
+func cacheKey(ex *Exchange) string {
+	req := *ex.Request
+	if req.Temperature != math.SmallestNonzeroFloat32 || len(req.Tools) > 0 || len(req.Functions) > 0 || req.N > 1 {
+		return ""
+	}
+	// How the answer is delivered and who asked don't change it
+	req.Stream = false
+	req.StreamOptions = nil
+	req.User = ""
+
+	data, err := json.Marshal(struct {
+		Request openai.ChatCompletionRequest `json:"request"`
+		Fields  map[string]interface{}       `json:"fields"`
+	}{req, ex.UpstreamFields})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup prepares an exchange for caching. It sets ex.cached when the
+// answer is cached, and otherwise ex.cacheKey so the answer is stored once
+// it arrives.
+func (rc *responseCache) Lookup(ex *Exchange) {
+	if rc == nil {
+		return
+	}
+	key := cacheKey(ex)
+	if key == "" {
+		return
+	}
+	if answer, ok := rc.get(key); ok {
+		ex.cached = &answer
+		return
+	}
+	ex.cacheKey = key
+}
+
+func (rc *responseCache) get(key string) (cachedAnswer, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if el, ok := rc.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if rc.expired(entry.answer) {
+			rc.order.Remove(el)
+			delete(rc.entries, key)
+			return cachedAnswer{}, false
+		}
+		rc.order.MoveToFront(el)
+		return entry.answer, true
+	}
+
+	if rc.dir == "" {
+		return cachedAnswer{}, false
+	}
+	data, err := os.ReadFile(rc.path(key))
+	if err != nil {
+		return cachedAnswer{}, false
+	}
+	var answer cachedAnswer
+	if err := json.Unmarshal(data, &answer); err != nil || rc.expired(answer) {
+		os.Remove(rc.path(key))
+		return cachedAnswer{}, false
+	}
+	rc.add(key, answer)
+	return answer, true
+}
+
+// Put stores an answer
+func (rc *responseCache) Put(key string, answer cachedAnswer) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.add(key, answer)
+	if rc.dir == "" {
+		return
+	}
+	data, err := json.Marshal(answer)
+	if err == nil {
+		err = os.WriteFile(rc.path(key), data, 0600)
+	}
+	if err != nil {
+		slog.Error("Failed to write cached answer", "error", err)
+	}
+}
+
+// add puts an answer in memory, evicting the least recently used one when
+// full. The caller holds rc.mu.
+func (rc *responseCache) add(key string, answer cachedAnswer) {
+	if el, ok := rc.entries[key]; ok {
+		el.Value.(*cacheEntry).answer = answer
+		rc.order.MoveToFront(el)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(&cacheEntry{key: key, answer: answer})
+	if rc.order.Len() > rc.max {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Close drops the answers kept in memory. Those on disk stay for the
+// caches that come after this one.
+func (rc *responseCache) Close() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.order.Init()
+	clear(rc.entries)
+}
+
+func (rc *responseCache) expired(answer cachedAnswer) bool {
+	return rc.ttl > 0 && time.Since(answer.Created) > rc.ttl
+}
+
+func (rc *responseCache) path(key string) string {
+	return filepath.Join(rc.dir, key+".json")
+}
+
+// cacheInterceptor records answers to cacheable requests as upstream sent
+// them
+type cacheInterceptor struct {
+	cache   *responseCache
+	content strings.Builder
+}
+
+func newCacheInterceptor(s *Server) Interceptor {
+	if s.cache == nil {
+		return nil
+	}
+	return &cacheInterceptor{cache: s.cache}
+}
+
+func (ci *cacheInterceptor) InterceptRequest(ex *Exchange) error {
+	return nil
+}
+
+func (ci *cacheInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	ci.content.WriteString(content)
+	return content, nil
+}
+
+func (ci *cacheInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
+
+func (ci *cacheInterceptor) Complete(ex *Exchange, outcome Outcome) {
+	if ex.cacheKey == "" || ex.cached != nil || outcome.Status != OutcomeSuccess {
+		return
+	}
+	ci.cache.Put(ex.cacheKey, cachedAnswer{
+		Content:      ci.content.String(),
+		FinishReason: outcome.FinishReason,
+		Usage:        outcome.Usage,
+		Created:      time.Now(),
+	})
+}
+
+// serveCached answers an exchange from the cache. The cached content still
+// passes through the response interceptors; body builds the format-specific
+// fields of the response from it. The request costs nothing, so no usage is
+// reported.
+func (s *Server) serveCached(c *gin.Context, chain *interceptorChain, stream bool, body func(content string) gin.H) {
+	ex := chain.ex
+	answer := ex.cached
+	c.Header("X-Proxy-Cache", "hit")
+
+	content, err := chain.Response(answer.Content)
+	if err == nil {
+		var tail string
+		tail, err = chain.Flush()
+		content += tail
+	}
+	if err != nil {
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	chain.Complete(Outcome{Status: OutcomeSuccess, FinishReason: answer.FinishReason})
+
+	response := body(content)
+	response["created_at"] = time.Now().Format(time.RFC3339)
+	response["done"] = true
+	response["done_reason"] = ollamaDoneReason(answer.FinishReason)
+	ex.addTimings(response, answer.Usage)
+
+	if !stream {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	sw, ok := newStreamWriter(c, s.wantsSSE(c))
+	if !ok {
+		requestLogger(c).Error("Expected http.ResponseWriter to be an http.Flusher")
+		return
+	}
+	if err := sw.Write(response); err != nil {
+		requestLogger(c).Error("Error writing cached response", "Error", err)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chatRequest is the body of an Ollama /api/chat request
+type chatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []openai.Tool   `json:"tools"`
+	Format    json.RawMessage `json:"format"`
+	Stream    *bool           `json:"stream"`
+	Options   *ollamaOptions  `json:"options"`
+	Think     *thinkOption    `json:"think"`
+	KeepAlive *keepAlive      `json:"keep_alive"`
+	// Provider overrides the configured OpenRouter provider preferences
+	Provider *ProviderPreferences `json:"provider"`
+}
+
+// handleChat serves /api/chat
+func (s *Server) handleChat(c *gin.Context) {
+	log := requestLogger(c)
+	var request chatRequest
+
+	// Parse the JSON request
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	if err := request.Provider.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Determine if streaming is requested (default true for /api/chat)
+	streamRequested := true
+	if request.Stream != nil {
+		streamRequested = *request.Stream
+	}
+
+	log.Info("Requested model", "model", request.Model)
+	fullModelName, err := s.resolveModel(request.Model)
+	if err != nil {
+		log.Error("Error getting full model name", "Error", err, "model", request.Model)
+		// Ollama returns 404 for invalid model names
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	log.Info("Using model", "fullModelName", fullModelName)
+	s.models.Touch(request.Model, fullModelName, keepAliveDuration(request.KeepAlive))
+
+	// Without messages the client only loads or unloads the model, which
+	// takes nothing here
+	if len(request.Messages) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"model":       request.Model,
+			"created_at":  time.Now().Format(time.RFC3339),
+			"message":     gin.H{"role": "assistant", "content": ""},
+			"done":        true,
+			"done_reason": loadDoneReason(request.KeepAlive),
+		})
+		return
+	}
+
+	messages, err := toOpenAIMessages(request.Messages)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Virtual models bring their own system prompt and default options,
+	// then the model's profile fills in what is still unset
+	options := request.Options
+	if vm, ok := s.virtual.Get(request.Model); ok {
+		messages = vm.withSystem(messages)
+		options = options.withDefaults(vm.Parameters)
+	}
+	profile, hasProfile := s.modelProfile(request.Model, fullModelName)
+	if hasProfile {
+		messages = withSystemPrompt(messages, profile.System)
+		options = options.withDefaults(profile.Options)
+	}
+
+	format, err := responseFormat(request.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ex := s.newExchange(c, request.Model, &openai.ChatCompletionRequest{
+		Model:          fullModelName,
+		Messages:       withFormatInstruction(messages, format),
+		Stream:         streamRequested,
+		Tools:          request.Tools,
+		ResponseFormat: format,
+	})
+	options.applyChat(ex)
+	s.applyProviderPreferences(ex, request.Provider, profile)
+	if request.Think != nil {
+		ex.setUpstreamField("reasoning", request.Think.upstreamReasoning())
+		if request.Think.Enabled {
+			ex.reasoning = &reasoningCollector{}
+		}
+	}
+
+	// Run request interceptors (secret detection, PII masking, ...)
+	chain := s.newInterceptorChain(ex)
+	if err := chain.Request(); err != nil {
+		log.Warn("Request rejected by interceptor", "Error", err)
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		c.JSON(rejectionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deterministic requests asked before are answered from the cache
+	if s.cache.Lookup(ex); ex.cached != nil {
+		s.serveCached(c, chain, streamRequested, func(content string) gin.H {
+			return gin.H{
+				"model":         ex.Request.Model,
+				"message":       gin.H{"role": "assistant", "content": content},
+				"finish_reason": ex.cached.FinishReason,
+			}
+		})
+		return
+	}
+
+	defer chain.ex.startTimeouts(s.config.Timeouts, streamRequested)()
+	if !streamRequested {
+		s.chatOnce(c, chain)
+		return
+	}
+	s.chatStream(c, chain)
+}
+
+// chatOnce handles a non-streaming chat request
+func (s *Server) chatOnce(c *gin.Context, chain *interceptorChain) {
+	log := requestLogger(c)
+	ex := chain.ex
+
+	// Call Chat to get the complete response
+	ctx := ex.upstreamContext()
+	ex.markSent()
+	var response openai.ChatCompletionResponse
+	err := s.withFallbacks(c, ex, func() (err error) {
+		response, err = s.provider.Chat(ctx, *ex.Request)
+		return err
+	})
+	if err == nil && !hasToolCalls(response) && s.retryRefusal(c, ex, chatContent(response), chatFinishReason(response)) {
+		response, err = s.provider.Chat(ctx, *ex.Request)
+	}
+	if err != nil {
+		err = ex.timedOut(err)
+		log.Error("Failed to get chat response", "Error", err)
+		chain.Complete(failedOutcome(err))
+		status, message := upstreamError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	// Format the response according to Ollama's format
+	if len(response.Choices) == 0 {
+		chain.Complete(Outcome{Status: OutcomeError, Error: "No response from model", Usage: response.Usage})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No response from model"})
+		return
+	}
+
+	// Run the content through the response interceptors
+	content, err := chain.Response(response.Choices[0].Message.Content)
+	if err == nil {
+		var tail string
+		tail, err = chain.Flush()
+		content += tail
+	}
+	if err != nil {
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error(), Usage: response.Usage})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get finish reason, default to "stop" if not provided
+	finishReason := "stop"
+	if response.Choices[0].FinishReason != "" {
+		finishReason = string(response.Choices[0].FinishReason)
+	}
+	chain.Complete(Outcome{Status: OutcomeSuccess, FinishReason: finishReason, Usage: response.Usage})
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": content,
+	}
+	if thinking := ex.reasoning.Take(); thinking != "" {
+		message["thinking"] = thinking
+	}
+	if calls := messageToolCalls(response.Choices[0].Message); len(calls) > 0 {
+		message["tool_calls"] = toOllamaToolCalls(calls)
+	}
+
+	// Create Ollama-compatible response
+	ollamaResponse := map[string]interface{}{
+		"model":         ex.Request.Model,
+		"created_at":    time.Now().Format(time.RFC3339),
+		"message":       message,
+		"done":          true,
+		"done_reason":   ollamaDoneReason(finishReason),
+		"finish_reason": finishReason,
+	}
+	ex.addTimings(ollamaResponse, response.Usage)
+
+	c.JSON(http.StatusOK, ollamaResponse)
+}
+
+// chatContent returns the text of the first choice of a chat response, or ""
+// if there is none
+func chatContent(response openai.ChatCompletionResponse) string {
+	if len(response.Choices) == 0 {
+		return ""
+	}
+	return response.Choices[0].Message.Content
+}
+
+// hasToolCalls reports whether the first choice of a chat response calls tools
+func hasToolCalls(response openai.ChatCompletionResponse) bool {
+	return len(response.Choices) > 0 && len(messageToolCalls(response.Choices[0].Message)) > 0
+}
+
+// chatFinishReason returns the finish reason of the first choice, or ""
+func chatFinishReason(response openai.ChatCompletionResponse) string {
+	if len(response.Choices) == 0 {
+		return ""
+	}
+	return string(response.Choices[0].FinishReason)
+}
+
+// streamDelta is the part of a streamed chunk sent on to the client
+type streamDelta struct {
+	content  string
+	thinking string
+}
+
+// chatStream handles a streaming chat request, writing NDJSON (or SSE) chunks
+func (s *Server) chatStream(c *gin.Context, chain *interceptorChain) {
+	log := requestLogger(c)
+	ex := chain.ex
+
+	// Call ChatStream to get the stream
+	ctx := ex.upstreamContext()
+	ex.markSent()
+	var stream *openai.ChatCompletionStream
+	err := s.withFallbacks(c, ex, func() (err error) {
+		stream, err = s.provider.ChatStream(ctx, *ex.Request)
+		return err
+	})
+	if err != nil {
+		err = ex.timedOut(err)
+		log.Error("Failed to create stream", "Error", err)
+		chain.Complete(failedOutcome(err))
+		status, message := upstreamError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	defer stream.Close() // Ensure stream closure
+	fullModelName := ex.Request.Model
+
+	sw, ok := newStreamWriter(c, s.wantsSSE(c))
+	if !ok {
+		log.Error("Expected http.ResponseWriter to be an http.Flusher")
+		return
+	}
+
+	var lastFinishReason string
+	var toolCalls toolCallAccumulator
+	var usage openai.Usage
+
+	// While a refused answer could still be retried on the fallback model,
+	// chunks are held back: refusals are short, so once the answer is longer
+	// than that, or thinking or tool calls arrive, it is sent on as usual
+	holding := s.mayRetryRefusal(ex)
+	var held []streamDelta
+	var answer strings.Builder
+
+	// send passes a delta through the interceptors and writes it to the
+	// client; it returns false if the stream was ended
+	send := func(delta streamDelta) bool {
+		content, err := chain.Response(delta.content)
+		if err != nil {
+			chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+			sw.Error(err.Error())
+			return false
+		}
+
+		// Build JSON response structure for intermediate chunks
+		message := map[string]interface{}{
+			"role":    "assistant",
+			"content": content,
+		}
+		if delta.thinking != "" {
+			message["thinking"] = delta.thinking
+		}
+		responseJSON := map[string]interface{}{
+			"model":      fullModelName,
+			"created_at": time.Now().Format(time.RFC3339),
+			"message":    message,
+			"done":       false,
+		}
+		if err := sw.Write(responseJSON); err != nil {
+			log.Error("Error marshaling intermediate response JSON", "Error", err)
+			return false
+		}
+		return true
+	}
+	// release sends the chunks held back so far and stops holding
+	release := func() bool {
+		holding = false
+		for _, delta := range held {
+			if !send(delta) {
+				return false
+			}
+		}
+		held = nil
+		return true
+	}
+
+	// Stream responses back to the client
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			// End of stream from the backend provider
+			break
+		}
+		if err != nil && ex.ctx.Err() != nil {
+			// The client went away; the upstream request is cancelled with it
+			log.Info("Client disconnected, stream aborted")
+			chain.Complete(Outcome{Status: OutcomeError, Error: errClientDisconnected})
+			return
+		}
+		if err != nil {
+			err = ex.timedOut(err)
+			log.Error("Backend stream error", "Error", err)
+			chain.Complete(failedOutcome(err))
+			// Try to send error in the stream's format
+			_, message := upstreamError(err)
+			sw.Error(message)
+			return
+		}
+
+		// The usage chunk comes last and carries no choices
+		if response.Usage != nil {
+			usage = *response.Usage
+		}
+		if len(response.Choices) == 0 {
+			continue
+		}
+
+		// Save finish reason if present in chunk
+		if response.Choices[0].FinishReason != "" {
+			lastFinishReason = string(response.Choices[0].FinishReason)
+		}
+
+		delta := response.Choices[0].Delta
+		toolCalls.Add(delta.ToolCalls)
+		toolCalls.AddFunctionCall(delta.FunctionCall)
+		hasToolDelta := len(delta.ToolCalls) > 0 || delta.FunctionCall != nil
+		thinking := ex.reasoning.Take()
+		if delta.Content != "" || hasToolDelta || thinking != "" {
+			ex.markToken()
+		}
+
+		// Tool call fragments are sent once complete, not as empty chunks
+		chunk := streamDelta{content: delta.Content, thinking: thinking}
+		skip := delta.Content == "" && thinking == "" && hasToolDelta
+
+		if holding {
+			if !skip {
+				held = append(held, chunk)
+			}
+			answer.WriteString(delta.Content)
+			if answer.Len() <= maxRefusalLength && thinking == "" && toolCalls.Len() == 0 {
+				continue
+			}
+			if !release() {
+				return
+			}
+			continue
+		}
+		if !skip && !send(chunk) {
+			return
+		}
+	}
+
+	// Nothing has reached the client while holding, so a refused or empty
+	// stream can still be replaced by one from the fallback model
+	if holding && toolCalls.Len() == 0 && s.retryRefusal(c, ex, answer.String(), lastFinishReason) {
+		stream.Close()
+		s.chatStream(c, chain)
+		return
+	}
+	if holding && !release() {
+		return
+	}
+
+	// Send the reassembled tool calls as their own chunk, like Ollama does
+	if toolCalls.Len() > 0 {
+		if err := sw.Write(map[string]interface{}{
+			"model":      fullModelName,
+			"created_at": time.Now().Format(time.RFC3339),
+			"message": map[string]interface{}{
+				"role":       "assistant",
+				"content":    "",
+				"tool_calls": toOllamaToolCalls(toolCalls.Take()),
+			},
+			"done": false,
+		}); err != nil {
+			log.Error("Error marshaling tool call JSON", "Error", err)
+			return
+		}
+	}
+
+	// Set finish reason (default to 'stop')
+	if lastFinishReason == "" {
+		lastFinishReason = "stop"
+	}
+
+	// Anything held back or appended by interceptors goes out with the final message
+	finalContent, err := chain.Flush()
+	if err != nil {
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		sw.Error(err.Error())
+		return
+	}
+	chain.Complete(Outcome{Status: OutcomeSuccess, FinishReason: lastFinishReason, Usage: usage})
+
+	// Send final message with done=true
+	finalResponse := map[string]interface{}{
+		"model":      fullModelName,
+		"created_at": time.Now().Format(time.RFC3339),
+		"message": map[string]string{
+			"role":    "assistant",
+			"content": finalContent,
+		},
+		"done":          true,
+		"done_reason":   ollamaDoneReason(lastFinishReason),
+		"finish_reason": lastFinishReason,
+	}
+	ex.addTimings(finalResponse, usage)
+
+	if err := sw.Write(finalResponse); err != nil {
+		log.Error("Error marshaling final response JSON", "Error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// toolCallChunk is a streamed chunk carrying a fragment of a tool call
+func toolCallChunk(index int, id, name, arguments string) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{
+		Delta: openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+			Index:    &index,
+			ID:       id,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: arguments},
+		}}},
+	}}}
+}
+
+func TestChatStreamToolCalls(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		// Providers split the arguments over several chunks
+		streamChunks(w,
+			toolCallChunk(0, "call_abc", "get_weather", ""),
+			toolCallChunk(0, "", "", `{"city":`),
+			toolCallChunk(0, "", "", ` "Paris"}`),
+			finishChunk(openai.FinishReasonToolCalls),
+		)
+	})
+	s := newTestServer(t, upstream, DefaultConfig())
+
+	w := serve(t, s, http.MethodPost, "/api/chat", map[string]any{
+		"model":    "gpt-4o",
+		"stream":   true,
+		"messages": []map[string]string{{"role": "user", "content": "Weather in Paris?"}},
+		"tools": []map[string]any{{
+			"type": "function",
+			"function": map[string]any{
+				"name":       "get_weather",
+				"parameters": map[string]any{"type": "object", "properties": map[string]any{"city": map[string]string{"type": "string"}}},
+			},
+		}},
+		"format": map[string]any{"type": "object", "properties": map[string]any{"summary": map[string]string{"type": "string"}}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("upstream got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if !req.Stream {
+		t.Error("upstream request is not streamed")
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function == nil || req.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("upstream tools = %+v, want get_weather", req.Tools)
+	}
+	if req.ResponseFormat == nil || req.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeJSONSchema {
+		t.Errorf("upstream response_format = %+v, want a JSON schema", req.ResponseFormat)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != openai.ChatMessageRoleSystem || !strings.Contains(req.Messages[0].Content, "summary") {
+		t.Errorf("upstream messages = %+v, want the schema instruction first", req.Messages)
+	}
+
+	lines := decodeNDJSON(t, w)
+	var calls []any
+	for _, line := range lines {
+		if message, ok := line["message"].(map[string]any); ok && message["tool_calls"] != nil {
+			if calls != nil {
+				t.Error("tool calls sent more than once")
+			}
+			calls = message["tool_calls"].([]any)
+		}
+	}
+	if len(calls) != 1 {
+		t.Fatalf("got tool calls %v, want one\n%s", calls, w.Body.String())
+	}
+	function := calls[0].(map[string]any)["function"].(map[string]any)
+	if function["name"] != "get_weather" {
+		t.Errorf("tool call name = %v, want get_weather", function["name"])
+	}
+	// Ollama clients expect the arguments as an object, not a string
+	if args, ok := function["arguments"].(map[string]any); !ok || args["city"] != "Paris" {
+		t.Errorf("tool call arguments = %#v, want {city: Paris}", function["arguments"])
+	}
+
+	last := lines[len(lines)-1]
+	if last["done"] != true || last["done_reason"] != "stop" {
+		t.Errorf("last line = %v, want done with done_reason stop", last)
+	}
+}
+
+func TestChatStreamRefusalRetry(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		if req.Model == "anthropic/claude-3.5-sonnet" {
+			streamChunks(w, contentChunk("Paris is "), contentChunk("the capital."), finishChunk(openai.FinishReasonStop))
+			return
+		}
+		streamChunks(w, contentChunk("I can't help "), contentChunk("with that."), finishChunk(openai.FinishReasonStop))
+	})
+	config := DefaultConfig()
+	config.RefusalRetry.FallbackModel = "anthropic/claude-3.5-sonnet"
+	s := newTestServer(t, upstream, config)
+
+	w := serve(t, s, http.MethodPost, "/api/chat", map[string]any{
+		"model":    "gpt-4o",
+		"stream":   true,
+		"messages": []map[string]string{{"role": "user", "content": "Capital of France?"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 2 || requests[1].Model != config.RefusalRetry.FallbackModel {
+		t.Fatalf("upstream got %d requests, want the refused one and a retry on the fallback", len(requests))
+	}
+
+	// The refusal was held back, so the client only sees the retried answer
+	var content strings.Builder
+	lines := decodeNDJSON(t, w)
+	for _, line := range lines {
+		if message, ok := line["message"].(map[string]any); ok {
+			content.WriteString(message["content"].(string))
+		}
+	}
+	if content.String() != "Paris is the capital." {
+		t.Errorf("streamed content = %q, want only the fallback's answer", content.String())
+	}
+	if done := lines[len(lines)-1]; done["done"] != true {
+		t.Errorf("last line = %v, want done", done)
+	}
+}
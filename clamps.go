@@ -0,0 +1,71 @@
+package main
+
+// SamplingClamp limits the sampling parameters clients may use for a model.
+// Unset bounds are not enforced.
+type SamplingClamp struct {
+	MinTemperature *float32 `json:"min_temperature,omitempty"`
+	MaxTemperature *float32 `json:"max_temperature,omitempty"`
+	MinTopP        *float32 `json:"min_top_p,omitempty"`
+	MaxTopP        *float32 `json:"max_top_p,omitempty"`
+}
+
+// Upstream defaults assumed when a client does not send a value
+const (
+	defaultTemperature = 1.0
+	defaultTopP        = 1.0
+)
+
+// clamp limits v to [lo, hi]; value 0 means "not sent" and is treated as def
+func clamp(v float32, def float32, lo, hi *float32) float32 {
+	if v == 0 {
+		v = def
+	}
+	if lo != nil && v < *lo {
+		v = *lo
+	}
+	if hi != nil && v > *hi {
+		v = *hi
+	}
+	return v
+}
+
+// clampInterceptor forces sampling parameters into the configured range for
+// the requested model
+type clampInterceptor struct {
+	clamps map[string]SamplingClamp
+}
+
+func newClampInterceptor(s *Server) Interceptor {
+	if len(s.config.SamplingClamps) == 0 {
+		return nil
+	}
+	return &clampInterceptor{clamps: s.config.SamplingClamps}
+}
+
+func (ci *clampInterceptor) InterceptRequest(ex *Exchange) error {
+	// Clamps can target the name the client used or the upstream model
+	cl, ok := ci.clamps[ex.Model]
+	if !ok {
+		cl, ok = ci.clamps[ex.Request.Model]
+	}
+	if !ok {
+		return nil
+	}
+
+	req := ex.Request
+	if cl.MinTemperature != nil || cl.MaxTemperature != nil {
+		req.Temperature = openaiTemperature(clamp(req.Temperature, defaultTemperature, cl.MinTemperature, cl.MaxTemperature))
+	}
+	if cl.MinTopP != nil || cl.MaxTopP != nil {
+		req.TopP = clamp(req.TopP, defaultTopP, cl.MinTopP, cl.MaxTopP)
+	}
+	return nil
+}
+
+func (ci *clampInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (ci *clampInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
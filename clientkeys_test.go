@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestClientQuotaCountsPassthroughAndEmbeddings(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		answerChat(w, req, "Hi")
+	})
+	config := DefaultConfig()
+	// A passthrough chat uses 17 tokens and an embedding 7
+	config.ClientKeys = []ClientKey{{Name: "ci", Token: "ck-test", MonthlyTokens: 20}}
+	s := newTestServer(t, upstream, config)
+	store, err := openUsageStore(filepath.Join(t.TempDir(), "usage.db"))
+	if err != nil {
+		t.Fatalf("opening usage database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s.usageDB = store
+
+	requests := []struct {
+		path string
+		body map[string]any
+		want int
+	}{
+		{"/v1/chat/completions", map[string]any{"model": "gpt-4o", "messages": []map[string]string{{"role": "user", "content": "Hi"}}}, http.StatusOK},
+		{"/api/embed", map[string]any{"model": "gpt-4o", "input": "Hi"}, http.StatusOK},
+		{"/api/embed", map[string]any{"model": "gpt-4o", "input": "Hi"}, http.StatusTooManyRequests},
+	}
+	for i, r := range requests {
+		req := newJSONRequest(t, http.MethodPost, r.path, r.body)
+		req.Header.Set("Authorization", "Bearer ck-test")
+		if w := serveRequest(s, req); w.Code != r.want {
+			t.Fatalf("request %d to %s: status %d: %s, want %d", i+1, r.path, w.Code, w.Body.String(), r.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ollamaVersion is the Ollama release whose API the proxy emulates. Clients
+// such as Open WebUI gate features on the reported version.
+const ollamaVersion = "0.5.7"
+
+// Compatibility presets
+const (
+	CompatibilityNone      = ""
+	CompatibilityOpenWebUI = "openwebui"
+)
+
+// applyCompatibilityPreset adjusts the config so the selected client works
+// out of the box, overriding settings known to confuse it
+func applyCompatibilityPreset(config *Config) {
+	switch config.Compatibility {
+	case CompatibilityNone:
+	case CompatibilityOpenWebUI:
+		// Open WebUI parses NDJSON even when its browser asks for SSE
+		config.SSEOutput = false
+	default:
+		slog.Warn("Unknown compatibility preset, ignoring", "preset", config.Compatibility)
+	}
+}
+
+// handleVersion serves /api/version
+func (s *Server) handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"version": ollamaVersion})
+}
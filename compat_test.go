@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// The requests below are the ones Open WebUI sends: it polls /api/tags and
+// /api/version, reads capabilities from /api/show to enable tool and image
+// toggles, generates titles and tags with non-streaming chats and shows
+// the token counts and durations of the final message.
+
+func newOpenWebUIServer(t *testing.T, chat func(http.ResponseWriter, openai.ChatCompletionRequest)) (*Server, *stubUpstream) {
+	t.Helper()
+	upstream := newStubUpstream(t, chat)
+	config := DefaultConfig()
+	config.Compatibility = CompatibilityOpenWebUI
+	config.SSEOutput = true
+	return newTestServer(t, upstream, config), upstream
+}
+
+func TestOpenWebUITagsPolling(t *testing.T) {
+	s, _ := newOpenWebUIServer(t, nil)
+
+	var digests []string
+	for range 2 {
+		w := serve(t, s, http.MethodGet, "/api/tags", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/tags: status %d: %s", w.Code, w.Body.String())
+		}
+		models, _ := decodeJSON(t, w)["models"].([]any)
+		if len(models) != 3 {
+			t.Fatalf("got %d models, want 3", len(models))
+		}
+		model := models[0].(map[string]any)
+		for _, field := range []string{"name", "model", "modified_at", "size", "digest", "details"} {
+			if _, ok := model[field]; !ok {
+				t.Errorf("model lacks %q: %v", field, model)
+			}
+		}
+		details := model["details"].(map[string]any)
+		if details["format"] != "gguf" || details["family"] == "" {
+			t.Errorf("details = %v, want format gguf and a family", details)
+		}
+		digests = append(digests, model["digest"].(string))
+	}
+	if digests[0] != digests[1] {
+		t.Errorf("digest changed between polls: %s, %s", digests[0], digests[1])
+	}
+}
+
+func TestOpenWebUIVersion(t *testing.T) {
+	s, _ := newOpenWebUIServer(t, nil)
+
+	w := serve(t, s, http.MethodGet, "/api/version", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/version: status %d", w.Code)
+	}
+	if version := decodeJSON(t, w)["version"]; version != ollamaVersion {
+		t.Errorf("version = %v, want %s", version, ollamaVersion)
+	}
+}
+
+func TestOpenWebUIShowCapabilities(t *testing.T) {
+	s, _ := newOpenWebUIServer(t, nil)
+
+	tests := []struct {
+		model string
+		want  []string
+	}{
+		{"gpt-4o", []string{"completion", "tools", "vision"}},
+		{"deepseek-r1:latest", []string{"completion", "thinking"}},
+		{"llama-3.1-70b-instruct", []string{"completion", "tools"}},
+	}
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodPost, "/api/show", map[string]string{"model": tt.model})
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /api/show %s: status %d: %s", tt.model, w.Code, w.Body.String())
+		}
+		var got []string
+		for _, capability := range decodeJSON(t, w)["capabilities"].([]any) {
+			got = append(got, capability.(string))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("capabilities of %s = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestOpenWebUITitleGeneration(t *testing.T) {
+	s, upstream := newOpenWebUIServer(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		answerChat(w, req, `{"title": "📉 Stock Market Trends"}`)
+	})
+
+	w := serve(t, s, http.MethodPost, "/api/chat", map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]string{{
+			"role":    "user",
+			"content": "### Task:\nGenerate a concise, 3-5 word title with an emoji summarizing the chat history.\n### Output:\nJSON format: { \"title\": \"your concise title here\" }\n### Chat History:\n<chat_history>\nUSER: How is the stock market doing?\n</chat_history>",
+		}},
+		"stream": false,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/chat: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decodeJSON(t, w)
+	message := body["message"].(map[string]any)
+	if message["role"] != "assistant" || !strings.Contains(message["content"].(string), "Stock Market Trends") {
+		t.Errorf("message = %v", message)
+	}
+	if body["done"] != true || body["done_reason"] != "stop" {
+		t.Errorf("done = %v, done_reason = %v, want true and stop", body["done"], body["done_reason"])
+	}
+	checkUsageFields(t, body)
+
+	requests := upstream.Requests()
+	if len(requests) != 1 || requests[0].Model != "openai/gpt-4o" || requests[0].Stream {
+		t.Errorf("upstream requests = %+v, want one non-streaming request for openai/gpt-4o", requests)
+	}
+}
+
+func TestOpenWebUIStreamUsage(t *testing.T) {
+	s, _ := newOpenWebUIServer(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		streamChunks(w, contentChunk("Hello"), contentChunk(" there"), finishChunk(openai.FinishReasonStop))
+	})
+
+	// Open WebUI's browser asks for SSE but parses NDJSON
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	w := serveRequest(s, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/chat: status %d: %s", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s, want application/x-ndjson", contentType)
+	}
+
+	lines := decodeNDJSON(t, w)
+	var content string
+	for _, line := range lines {
+		content += line["message"].(map[string]any)["content"].(string)
+	}
+	if content != "Hello there" {
+		t.Errorf("content = %q, want %q", content, "Hello there")
+	}
+	final := lines[len(lines)-1]
+	if final["done"] != true || final["done_reason"] != "stop" {
+		t.Errorf("final chunk = %v, want done with reason stop", final)
+	}
+	checkUsageFields(t, final)
+}
+
+// checkUsageFields checks the token counts and durations of a final
+// message, which Open WebUI shows under each answer
+func checkUsageFields(t *testing.T, final map[string]any) {
+	t.Helper()
+	if final["prompt_eval_count"] != float64(12) || final["eval_count"] != float64(5) {
+		t.Errorf("prompt_eval_count = %v, eval_count = %v, want 12 and 5", final["prompt_eval_count"], final["eval_count"])
+	}
+	for _, field := range []string{"total_duration", "load_duration", "prompt_eval_duration", "eval_duration"} {
+		if _, ok := final[field].(float64); !ok {
+			t.Errorf("final message lacks %s", field)
+		}
+	}
+}
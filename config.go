@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
-
-	"github.com/zalando/go-keyring"
+	"time"
 )
 
 const (
@@ -15,37 +18,229 @@ const (
 	userName = "openrouter-proxy-user"
 	// Key for API key in keyring
 	apiKeyName = "openrouter-api-key"
+	// App attribution shown in the OpenRouter dashboard and rankings
+	defaultAppURL   = "https://github.com/abhi-wan-kenobi/ollama-openrouter-proxy"
+	defaultAppTitle = "Ollama OpenRouter Proxy"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// ServerEnabled indicates if the proxy server is running
 	ServerEnabled bool `json:"server_enabled"`
+	// CheckUpdates makes the tray app look for new releases once a day
+	CheckUpdates bool `json:"check_updates"`
+	// Port is the port the API listens on, Ollama's 11434 by default
+	Port int `json:"port,omitempty"`
 	// LastUsedModelFilter is the path to the last used model filter file
 	LastUsedModelFilter string `json:"last_used_model_filter"`
+	// ModelRules hide models by price, context length or capability
+	ModelRules ModelRules `json:"model_rules,omitempty"`
+	// SecretDetection controls what happens when a prompt contains credentials:
+	// "off", "block" (reject the request) or "mask" (redact before forwarding)
+	SecretDetection string `json:"secret_detection"`
+	// PIIMasking replaces emails, phone numbers and PIINames with placeholders
+	// before forwarding and restores them in the response
+	PIIMasking bool `json:"pii_masking"`
+	// PIINames is a list of names that should be masked when PIIMasking is on
+	PIINames []string `json:"pii_names,omitempty"`
+	// OutputFilter post-processes model output before it reaches the client
+	OutputFilter OutputFilterConfig `json:"output_filter"`
+	// Log adds a rotating log file next to stderr
+	Log LogConfig `json:"log,omitempty"`
+	// Transcripts logs every conversation to JSONL files for auditing
+	Transcripts TranscriptConfig `json:"transcripts,omitempty"`
+	// Webhooks are external HTTP hooks called before and after each request
+	Webhooks WebhookConfig `json:"webhooks"`
+	// Plugins are paths to WASM modules implementing custom transforms
+	Plugins []string `json:"plugins,omitempty"`
+	// ForwardHeaders lists client request headers passed on to OpenRouter.
+	// Authorization, cookies and hop-by-hop headers are never forwarded.
+	ForwardHeaders []string `json:"forward_headers,omitempty"`
+	// UpstreamHeaders are static headers added to every upstream request
+	UpstreamHeaders map[string]string `json:"upstream_headers,omitempty"`
+	// AppURL and AppTitle are sent as OpenRouter's HTTP-Referer and X-Title
+	// app attribution headers; empty values are not sent
+	AppURL   string `json:"app_url"`
+	AppTitle string `json:"app_title"`
+	// BYOK forwards the client's "Authorization: Bearer" header upstream so
+	// clients can use their own OpenRouter key
+	BYOK bool `json:"byok"`
+	// UserHeader names a client header whose value is sent as the upstream
+	// "user" field for per-user abuse detection and analytics
+	UserHeader string `json:"user_header,omitempty"`
+	// UserFromToken derives the upstream "user" field from a hash of the
+	// client's bearer token when UserHeader is not present
+	UserFromToken bool `json:"user_from_token"`
+	// SSEOutput lets clients sending "Accept: text/event-stream" receive
+	// /api/chat streams as server-sent events instead of NDJSON
+	SSEOutput bool `json:"sse_output"`
+	// Compatibility selects a client preset ("openwebui") that overrides
+	// settings the client is known not to handle
+	Compatibility string `json:"compatibility,omitempty"`
+	// TLS serves the API over HTTPS with a certificate pair or a generated
+	// self-signed certificate
+	TLS TLSConfig `json:"tls,omitempty"`
+	// AccessTokens, when set, must be presented by clients (e.g. as
+	// "Authorization: Bearer <token>") to use the proxy
+	AccessTokens []string `json:"access_tokens,omitempty"`
+	// RateLimit limits requests per client IP or access token
+	RateLimit RateLimitConfig `json:"rate_limit,omitempty"`
+	// ClientKeys are named access tokens with per-client rate limits and
+	// monthly token quotas
+	ClientKeys []ClientKey `json:"client_keys,omitempty"`
+	// AdminToken guards /metrics, /debug and /admin. Without it those are
+	// only served to loopback clients.
+	AdminToken string `json:"admin_token,omitempty"`
+	// AllowedOrigins lists browser origins allowed to call the proxy, with
+	// "*" wildcards (e.g. "chrome-extension://*")
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// ContextOverflow handles prompts longer than the model's context
+	// window: "off", "middle-out" (OpenRouter compresses the middle of the
+	// prompt) or "truncate" (the oldest messages are dropped locally)
+	ContextOverflow string `json:"context_overflow,omitempty"`
+	// SamplingClamps limits temperature/top_p per model name
+	SamplingClamps map[string]SamplingClamp `json:"sampling_clamps,omitempty"`
+	// RefusalRetry retries refused or empty answers on a fallback model
+	RefusalRetry RefusalRetryConfig `json:"refusal_retry,omitempty"`
+	// APIKeys are additional OpenRouter keys; requests are spread over them
+	// and the key from the keychain by weight
+	APIKeys []APIKey `json:"api_keys,omitempty"`
+	// CreditsWarningUSD triggers a desktop notification when the OpenRouter
+	// credits left drop below it; 0 disables the warning
+	CreditsWarningUSD float64 `json:"credits_warning_usd,omitempty"`
+	// KeyStorage selects where API keys are stored: "keyring", "file" (an
+	// encrypted file in the config directory) or "auto" (the keyring,
+	// falling back to the file when no keyring is available)
+	KeyStorage string `json:"key_storage,omitempty"`
+	// Budget caps daily and monthly spending
+	Budget BudgetConfig `json:"budget,omitempty"`
+	// Limits caps simultaneous OpenRouter requests, queueing the rest
+	Limits LimitConfig `json:"limits,omitempty"`
+	// Retry controls retries of upstream calls failing with 429/502/503/504
+	Retry RetryConfig `json:"retry"`
+	// Timeouts bound connecting upstream, the wait for the first token and
+	// whole requests, streaming or not
+	Timeouts TimeoutConfig `json:"timeouts,omitempty"`
+	// Cache answers deterministic requests from memory or disk
+	Cache CacheConfig `json:"cache,omitempty"`
+	// Shadow mirrors requests to a second model and logs both answers
+	Shadow ShadowConfig `json:"shadow,omitempty"`
+	// Outbound sets an HTTP proxy and extra CA certificates for outgoing
+	// calls, for corporate networks
+	Outbound OutboundConfig `json:"outbound,omitempty"`
+	// Provider holds OpenRouter provider routing preferences sent with every
+	// request, e.g. to pin providers or exclude ones that collect data
+	Provider ProviderPreferences `json:"provider,omitempty"`
+	// DrainTimeoutSeconds is how long stopping the server waits for requests
+	// in flight, such as streams, to finish; 0 means 30 seconds, negative
+	// stops right away
+	DrainTimeoutSeconds int `json:"drain_timeout_seconds,omitempty"`
+	// ModelCacheTTLSeconds is how many seconds the model list is reused before
+	// it is fetched again; 0 means 5 minutes, negative disables the cache
+	ModelCacheTTLSeconds int `json:"model_cache_ttl_seconds,omitempty"`
+	// ModelProfiles are per-model request defaults (system prompt, options,
+	// provider preferences), keyed by model name
+	ModelProfiles map[string]ModelProfile `json:"model_profiles,omitempty"`
+	// Fallbacks lists, per model, the models tried in order when it fails,
+	// e.g. {"claude-3.5-sonnet": ["gpt-4o-mini", "llama-3.1-8b-instruct"]}
+	Fallbacks map[string][]string `json:"fallbacks,omitempty"`
+	// DefaultModel replaces models clients ask for that OpenRouter doesn't
+	// have, e.g. a hardcoded "llama3", instead of failing the request
+	DefaultModel string `json:"default_model,omitempty"`
+	// ModelAliases maps Ollama-style model names (e.g. "llama3:latest") to
+	// OpenRouter models so existing client configurations keep working
+	ModelAliases map[string]string `json:"model_aliases,omitempty"`
+	// ModelSplits sends requests for a model name to several models by
+	// weight, e.g. {"assistant": [{"model": "gpt-4o-mini", "weight": 9},
+	// {"model": "claude-3-haiku", "weight": 1}]}
+	ModelSplits map[string][]SplitArm `json:"model_splits,omitempty"`
+	// Models gathers aliases, profile, fallbacks and sampling clamp per
+	// model, keyed by full model name; see ModelSection
+	Models map[string]ModelSection `json:"models,omitempty"`
+	// Profiles are named sets of settings applied over the rest when
+	// selected with ActiveProfile, e.g. a model filter, budget and limits
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+	// ActiveProfile names the profile in use; empty uses none
+	ActiveProfile string `json:"active_profile,omitempty"`
+	// Backends are other OpenAI-compatible APIs (OpenAI, Anthropic, Groq,
+	// Mistral, ...) selected by model prefix, e.g. "groq/llama-3.3-70b"
+	Backends []BackendConfig `json:"backends,omitempty"`
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() Config {
 	return Config{
 		ServerEnabled:       false,
+		CheckUpdates:        true,
 		LastUsedModelFilter: "models-filter",
+		SecretDetection:     SecretActionOff,
+		Retry:               RetryConfig{MaxRetries: 2},
+		AppURL:              defaultAppURL,
+		AppTitle:            defaultAppTitle,
 	}
 }
 
-// GetConfigPath returns the path to the config file
-func GetConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+// defaultPort is Ollama's port, which clients try by default
+const defaultPort = 11434
+
+// listenPort returns the configured port or the default one
+func (c Config) listenPort() int {
+	if c.Port <= 0 || c.Port > 65535 {
+		return defaultPort
+	}
+	return c.Port
+}
+
+// localURL returns the URL of path on the server this config runs, as
+// reached from the same machine
+func (c Config) localURL(path string) string {
+	scheme := "http"
+	if c.TLS.Enabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d%s", scheme, c.listenPort(), path)
+}
+
+// openrouterHeaders returns the static headers of OpenRouter requests: the
+// app attribution headers, overridden by the configured upstream headers
+func (c Config) openrouterHeaders() map[string]string {
+	headers := map[string]string{}
+	if c.AppURL != "" {
+		headers["HTTP-Referer"] = c.AppURL
+	}
+	if c.AppTitle != "" {
+		headers["X-Title"] = c.AppTitle
+	}
+	for k, v := range c.UpstreamHeaders {
+		headers[k] = v
 	}
+	return headers
+}
 
-	// Create .openrouter-proxy directory if it doesn't exist
-	configDir := filepath.Join(homeDir, ".openrouter-proxy")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return "", err
+// GetConfigPath returns the path to the config file: config.yaml or
+// config.yml if there is one, config.json otherwise. It lies next to the
+// executable in portable mode.
+func GetConfigPath() (string, error) {
+	configDir := portableDir
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		// Create .openrouter-proxy directory if it doesn't exist
+		configDir = filepath.Join(homeDir, ".openrouter-proxy")
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return "", err
+		}
 	}
 
+	for _, name := range configFileNames {
+		path := filepath.Join(configDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
 	return filepath.Join(configDir, "config.json"), nil
 }
 
@@ -67,13 +262,8 @@ func LoadConfig() (Config, error) {
 		return DefaultConfig(), err
 	}
 
-	// Parse config
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return DefaultConfig(), err
-	}
-
-	return config, nil
+	// Parse config on top of the defaults so new fields get sane values
+	return parseConfig(configPath, data)
 }
 
 // SaveConfig saves the configuration to disk
@@ -83,8 +273,8 @@ func SaveConfig(config Config) error {
 		return err
 	}
 
-	// Marshal config to JSON
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Marshal config in the format of the file
+	data, err := marshalConfig(configPath, config)
 	if err != nil {
 		return err
 	}
@@ -93,18 +283,61 @@ func SaveConfig(config Config) error {
 	return os.WriteFile(configPath, data, 0644)
 }
 
-// GetAPIKey retrieves the API key from the keyring
+// GetAPIKey retrieves the API key from the keyring or the encrypted file
 func GetAPIKey() (string, error) {
-	return keyring.Get(appName, userName)
+	return getSecret(userName)
 }
 
-// SetAPIKey stores the API key in the keyring
+// SetAPIKey stores the API key in the keyring or the encrypted file
 func SetAPIKey(apiKey string) error {
-	return keyring.Set(appName, userName, apiKey)
+	return setSecret(userName, apiKey)
 }
 
-// HasAPIKey checks if an API key is stored
+// ErrInvalidAPIKey is returned by VerifyAPIKey when OpenRouter rejects a key
+var ErrInvalidAPIKey = errors.New("OpenRouter rejected the API key")
+
+// VerifyAPIKey checks a key with an authenticated call to OpenRouter. Errors
+// other than ErrInvalidAPIKey mean the key could not be checked.
+func VerifyAPIKey(apiKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := NewOpenrouterProvider(apiKey, nil, nil, RetryConfig{}, TimeoutConfig{}, nil).Do(ctx, http.MethodGet, "key", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrInvalidAPIKey
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("verifying API key failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// resolveAPIKey returns the OpenRouter key the server runs with, with or
+// without the tray. The --api-key flag and the environment come first since
+// containers usually have no keychain.
+func resolveAPIKey() (string, error) {
+	if key, ok := overrideValue(apiKeyOverride); ok && key != "" {
+		return key, nil
+	}
+	for _, name := range []string{"OPENROUTER_API_KEY", "OPENAI_API_KEY"} {
+		if key := os.Getenv(name); key != "" {
+			return key, nil
+		}
+	}
+	key, err := GetAPIKey()
+	if err != nil {
+		return "", errors.New("no API key: set OPENROUTER_API_KEY or store one in the keychain")
+	}
+	return key, nil
+}
+
+// HasAPIKey checks if an API key is given or stored
 func HasAPIKey() bool {
-	_, err := GetAPIKey()
+	_, err := resolveAPIKey()
 	return err == nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the names the config file may have, by preference.
+// YAML allows comments and is easier to edit by hand; config.json is what
+// older versions wrote and is still read.
+var configFileNames = []string{"config.yaml", "config.yml", "config.json"}
+
+// configWarnings holds the warnings about the config file already logged;
+// it is read often, and each is only worth logging once
+var configWarnings sync.Map
+
+// isYAMLConfig reports whether the config file at path is YAML
+func isYAMLConfig(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parseConfig parses a config file on top of the defaults. The file is
+// checked against Config first so mistakes are reported with their line:
+// wrong types always, unknown settings as errors in YAML and as warnings in
+// JSON, where older versions ignored them.
+func parseConfig(path string, data []byte) (Config, error) {
+	config := DefaultConfig()
+	name := filepath.Base(path)
+
+	// JSON is YAML, so both are checked the same way
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if isYAMLConfig(path) {
+			return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+		}
+		// Some valid JSON, e.g. indented with tabs, is not valid YAML
+		if err := json.Unmarshal(data, &config); err != nil {
+			return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+		}
+		return config, errors.Join(config.checkModelSections(), config.checkProfiles())
+	}
+	if len(doc.Content) == 0 {
+		return config, nil
+	}
+
+	check := &configChecker{file: name, strict: isYAMLConfig(path)}
+	check.node(doc.Content[0], reflect.TypeOf(Config{}), "")
+	for _, warning := range check.warnings {
+		if _, logged := configWarnings.LoadOrStore(warning, true); !logged {
+			slog.Warn("Ignoring config setting", "problem", warning)
+		}
+	}
+	if len(check.errors) > 0 {
+		return DefaultConfig(), errors.New(strings.Join(check.errors, "\n"))
+	}
+
+	if isYAMLConfig(path) {
+		var value any
+		if err := doc.Decode(&value); err != nil {
+			return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+		}
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+	}
+	if err := errors.Join(config.checkModelSections(), config.checkProfiles()); err != nil {
+		return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+	}
+	return config, nil
+}
+
+// marshalConfig encodes the config for the file at path. YAML keeps the
+// order of the settings in Config; comments in the file are lost.
+func marshalConfig(path string, config Config) ([]byte, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil || !isYAMLConfig(path) {
+		return data, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// blockStyle drops the JSON styling of a YAML tree: flow mappings and
+// sequences and quotes the values don't need
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// configChecker checks a parsed config file against the Config type
+type configChecker struct {
+	file     string
+	strict   bool
+	errors   []string
+	warnings []string
+}
+
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func (c *configChecker) report(node *yaml.Node, path, format string, args ...any) {
+	c.errors = append(c.errors, fmt.Sprintf("%s line %d: %s: %s", c.file, node.Line, path, fmt.Sprintf(format, args...)))
+}
+
+// node checks that node holds a value of type t; path names it in messages
+func (c *configChecker) node(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	// Types with their own JSON decoding accept whatever it accepts
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		c.node(node, t.Elem(), path)
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			c.report(node, path, "expected a section of settings")
+			return
+		}
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("%s line %d: unknown setting %q", c.file, key.Line, joinPath(path, key.Value))
+				if suggestion := closestName(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				if c.strict {
+					c.errors = append(c.errors, message)
+				} else {
+					c.warnings = append(c.warnings, message)
+				}
+				continue
+			}
+			c.node(value, field, joinPath(path, key.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.report(node, path, "expected a mapping of names to values")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.node(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			c.report(node, path, "expected a list")
+			return
+		}
+		for i, item := range node.Content {
+			c.node(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			c.report(node, path, "expected text; quote it if it looks like a number or boolean")
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			c.report(node, path, "expected true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			c.report(node, path, "expected a whole number")
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			c.report(node, path, "expected a number")
+		}
+	}
+}
+
+// structFields returns the fields of a struct by JSON name, including those
+// of embedded structs
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, typ := range structFields(field.Type) {
+				fields[embedded] = typ
+			}
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// closestName returns the known name a mistyped one most likely meant, or
+// "" if none is close
+func closestName(name string, known map[string]reflect.Type) string {
+	best, bestDistance := "", len(name)/3+1
+	for candidate := range known {
+		if d := editDistance(name, candidate); d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
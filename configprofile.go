@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// A configuration profile is a named set of settings applied over the rest
+// of the config when it is active, e.g. "work" with a filter of approved
+// models and a budget, and "personal" with free models only. A profile may
+// also have its own OpenRouter key, stored with set-profile-key.
+
+// profileKeyName is the keychain entry holding the API key of a profile
+func profileKeyName(name string) string {
+	return "profile-" + name
+}
+
+// GetProfileAPIKey retrieves the API key of a profile from the keyring
+func GetProfileAPIKey(name string) (string, error) {
+	return getSecret(profileKeyName(name))
+}
+
+// SetProfileAPIKey stores the API key of a profile in the keyring
+func SetProfileAPIKey(name, apiKey string) error {
+	return setSecret(profileKeyName(name), apiKey)
+}
+
+// upstreamAPIKey returns the OpenRouter key of the server: the active
+// profile's own key if it has one, the one it was created with otherwise
+func (s *Server) upstreamAPIKey() string {
+	if s.config.ActiveProfile != "" {
+		if key, err := GetProfileAPIKey(s.config.ActiveProfile); err == nil && key != "" {
+			return key
+		}
+	}
+	return s.apiKey
+}
+
+// profileNames returns the names of the configured profiles, sorted
+func (c Config) profileNames() []string {
+	names := slices.Collect(maps.Keys(c.Profiles))
+	sort.Strings(names)
+	return names
+}
+
+// checkProfiles reports profiles with unknown settings and an active
+// profile that doesn't exist
+func (c Config) checkProfiles() error {
+	for _, name := range c.profileNames() {
+		dec := json.NewDecoder(bytes.NewReader(c.Profiles[name]))
+		dec.DisallowUnknownFields()
+		var overlay Config
+		if err := dec.Decode(&overlay); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+		if overlay.Profiles != nil || overlay.ActiveProfile != "" {
+			return fmt.Errorf("profiles.%s: a profile can't contain profiles", name)
+		}
+	}
+	if _, ok := c.Profiles[c.ActiveProfile]; c.ActiveProfile != "" && !ok {
+		return fmt.Errorf("active_profile: unknown profile %q", c.ActiveProfile)
+	}
+	return nil
+}
+
+// applyProfile applies the settings of the active profile over the config.
+// Sections and maps are merged, everything else is replaced.
+func applyProfile(config *Config) error {
+	if config.ActiveProfile == "" {
+		return nil
+	}
+	settings, ok := config.Profiles[config.ActiveProfile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", config.ActiveProfile)
+	}
+
+	// The profile is applied to a copy, since the maps of config may be
+	// shared with the caller's
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var profiled Config
+	if err := json.Unmarshal(data, &profiled); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(settings, &profiled); err != nil {
+		return fmt.Errorf("profile %s: %w", config.ActiveProfile, err)
+	}
+	*config = profiled
+	return nil
+}
+
+// effectiveConfig turns the config as saved into the one the server runs
+// with: the active profile, which an override may choose, is applied, and
+// then the overrides
+func effectiveConfig(config *Config) error {
+	if name, ok := overrideValue("active_profile"); ok {
+		config.ActiveProfile = name
+	}
+	return errors.Join(applyProfile(config), applyOverrides(config))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log/slog"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Context overflow modes, for prompts longer than the model's context window
+const (
+	// ContextOverflowOff sends prompts as they are and lets upstream fail
+	ContextOverflowOff = "off"
+	// ContextOverflowMiddleOut asks OpenRouter to compress the middle of the
+	// prompt with its "middle-out" transform
+	ContextOverflowMiddleOut = "middle-out"
+	// ContextOverflowTruncate drops the oldest messages locally
+	ContextOverflowTruncate = "truncate"
+)
+
+// messageOverheadTokens approximates the tokens each message costs beyond
+// its content (role, separators)
+const messageOverheadTokens = 4
+
+// messageTokens roughly estimates the tokens a message takes up
+func messageTokens(m openai.ChatCompletionMessage) int {
+	tokens := messageOverheadTokens + estimateTokens(m.Content)
+	for _, part := range m.MultiContent {
+		tokens += estimateTokens(part.Text)
+	}
+	for _, call := range m.ToolCalls {
+		tokens += estimateTokens(call.Function.Name) + estimateTokens(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// truncateMessages drops the oldest messages until the conversation fits in
+// limit tokens. System messages and the last message are always kept, and
+// tool results go together with the call they answer. It returns the
+// messages and how many were dropped.
+func truncateMessages(messages []openai.ChatCompletionMessage, limit int) ([]openai.ChatCompletionMessage, int) {
+	total := 0
+	for _, m := range messages {
+		total += messageTokens(m)
+	}
+	if total <= limit {
+		return messages, 0
+	}
+
+	drop := make([]bool, len(messages))
+	dropped := 0
+	for i := 0; i < len(messages)-1 && total > limit; i++ {
+		if messages[i].Role == openai.ChatMessageRoleSystem || drop[i] {
+			continue
+		}
+		drop[i] = true
+		total -= messageTokens(messages[i])
+		dropped++
+		for j := i + 1; j < len(messages)-1 && messages[j].Role == openai.ChatMessageRoleTool; j++ {
+			drop[j] = true
+			total -= messageTokens(messages[j])
+			dropped++
+		}
+	}
+
+	kept := make([]openai.ChatCompletionMessage, 0, len(messages)-dropped)
+	for i, m := range messages {
+		if !drop[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept, dropped
+}
+
+// contextWindowInterceptor keeps prompts within the model's context window
+// so clients don't get an upstream error for overlong conversations
+type contextWindowInterceptor struct {
+	mode     string
+	provider Provider
+}
+
+func newContextWindowInterceptor(s *Server) Interceptor {
+	mode := s.config.ContextOverflow
+	if mode == "" || mode == ContextOverflowOff {
+		return nil
+	}
+	return &contextWindowInterceptor{mode: mode, provider: s.provider}
+}
+
+func (ci *contextWindowInterceptor) InterceptRequest(ex *Exchange) error {
+	// OpenRouter only compresses prompts that don't fit, so the transform
+	// can be requested unconditionally
+	if ci.mode == ContextOverflowMiddleOut {
+		ex.setUpstreamField("transforms", []string{"middle-out"})
+		return nil
+	}
+	if ci.mode != ContextOverflowTruncate {
+		return nil
+	}
+
+	contextLength := ci.provider.ContextLength(ex.Request.Model, 0)
+	if contextLength == 0 {
+		return nil
+	}
+	// Leave room for the answer
+	limit := contextLength - ex.Request.MaxTokens
+	if limit <= 0 {
+		return nil
+	}
+
+	messages, dropped := truncateMessages(ex.Request.Messages, limit)
+	if dropped > 0 {
+		slog.Info("Truncated conversation to fit the context window",
+			"request_id", ex.RequestID, "model", ex.Request.Model, "dropped_messages", dropped, "context_length", contextLength)
+		ex.Request.Messages = messages
+	}
+	return nil
+}
+
+func (ci *contextWindowInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (ci *contextWindowInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
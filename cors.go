@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultOrigins are always allowed, as by Ollama itself: local pages and
+// desktop app webviews
+var defaultOrigins = []string{
+	"http://localhost", "https://localhost", "http://localhost:*", "https://localhost:*",
+	"http://127.0.0.1", "https://127.0.0.1", "http://127.0.0.1:*", "https://127.0.0.1:*",
+	"http://0.0.0.0", "https://0.0.0.0", "http://0.0.0.0:*", "https://0.0.0.0:*",
+	"app://*", "file://*", "tauri://*", "vscode-webview://*", "vscode-file://*",
+}
+
+// corsOrigins returns the allowed origin patterns: the defaults, the
+// configured ones and those in OLLAMA_ORIGINS (comma separated), so
+// existing Ollama setups carry over
+func (s *Server) corsOrigins() []string {
+	origins := append([]string{}, defaultOrigins...)
+	origins = append(origins, s.config.AllowedOrigins...)
+	for _, origin := range strings.Split(os.Getenv("OLLAMA_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// allowedOrigin reports whether origin matches one of the allowed
+// patterns. Patterns may use "*" wildcards, e.g. "chrome-extension://*".
+func (s *Server) allowedOrigin(origin string) bool {
+	for _, pattern := range s.origins {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware answers CORS preflights for allowed origins, including
+// Chrome's Private Network Access preflight, which browser extensions and
+// web apps hit when calling a proxy on localhost or the LAN
+func (s *Server) corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !s.allowedOrigin(origin) {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Expose-Headers", strings.Join([]string{requestIDHeader, fallbackHeader}, ", "))
+
+		if c.Request.Method != http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, HEAD, OPTIONS")
+		if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		} else {
+			h.Set("Access-Control-Allow-Headers", strings.Join([]string{"Authorization", "Content-Type", "User-Agent", "Accept", "X-Requested-With"}, ", "))
+		}
+		if c.GetHeader("Access-Control-Request-Private-Network") == "true" {
+			h.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		h.Set("Access-Control-Max-Age", "86400")
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
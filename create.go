@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createRequest is the body of an Ollama /api/create request. Older clients
+// send a Modelfile, newer ones the same instructions as fields.
+type createRequest struct {
+	Model      string                 `json:"model"`
+	Name       string                 `json:"name"`
+	Modelfile  string                 `json:"modelfile"`
+	From       string                 `json:"from"`
+	System     string                 `json:"system"`
+	Parameters map[string]interface{} `json:"parameters"`
+	Stream     *bool                  `json:"stream"`
+}
+
+// modelfile holds the instructions of a Modelfile the proxy understands
+type modelfile struct {
+	From       string
+	System     string
+	Parameters map[string]interface{}
+}
+
+// parseModelfile reads FROM, SYSTEM and PARAMETER instructions. Other
+// instructions (TEMPLATE, ADAPTER, ...) only make sense for local models and
+// are ignored. Values may be quoted, and triple quotes span lines.
+func parseModelfile(text string) (modelfile, error) {
+	mf := modelfile{Parameters: map[string]interface{}{}}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		instruction, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+
+		// Collect a triple-quoted value up to the closing quotes
+		if strings.HasPrefix(value, `"""`) {
+			value = strings.TrimPrefix(value, `"""`)
+			for !strings.HasSuffix(value, `"""`) {
+				i++
+				if i == len(lines) {
+					return mf, fmt.Errorf("unterminated \"\"\" in %s", instruction)
+				}
+				value += "\n" + lines[i]
+			}
+			value = strings.TrimSuffix(value, `"""`)
+		} else if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+
+		switch strings.ToUpper(instruction) {
+		case "FROM":
+			mf.From = value
+		case "SYSTEM":
+			mf.System = value
+		case "PARAMETER":
+			name, raw, ok := strings.Cut(value, " ")
+			if !ok {
+				return mf, fmt.Errorf("PARAMETER %s has no value", name)
+			}
+			addParameter(mf.Parameters, name, strings.Trim(strings.TrimSpace(raw), `"`))
+		}
+	}
+
+	if mf.From == "" {
+		return mf, fmt.Errorf("no FROM line")
+	}
+	return mf, nil
+}
+
+// addParameter stores a Modelfile parameter with the JSON type Ollama's
+// options use. stop may be given several times.
+func addParameter(params map[string]interface{}, name, value string) {
+	if name == "stop" {
+		stops, _ := params[name].([]string)
+		params[name] = append(stops, value)
+		return
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		params[name] = n
+		return
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		params[name] = f
+		return
+	}
+	params[name] = value
+}
+
+// handleCreate serves /api/create, storing the model as a virtual model that
+// applies its system prompt and parameters on every request
+func (s *Server) handleCreate(c *gin.Context) {
+	var request createRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	name := request.Model
+	if name == "" {
+		name = request.Name
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		return
+	}
+
+	mf := modelfile{From: request.From, System: request.System, Parameters: request.Parameters}
+	if request.Modelfile != "" {
+		var err error
+		if mf, err = parseModelfile(request.Modelfile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid modelfile: " + err.Error()})
+			return
+		}
+	}
+	if mf.From == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neither 'from' nor a modelfile with FROM was given"})
+		return
+	}
+
+	// Build on a virtual model, or on an OpenRouter model
+	vm, ok := s.virtual.Get(mf.From)
+	if !ok {
+		if _, err := s.provider.GetModels(); err != nil {
+			requestLogger(c).Error("Error getting models", "Error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		fullName, found := s.provider.FindModel(strings.TrimSuffix(mf.From, ":latest"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "model '" + mf.From + "' not found"})
+			return
+		}
+		vm = VirtualModel{From: fullName}
+	}
+
+	if mf.System != "" {
+		vm.System = mf.System
+	}
+	if len(mf.Parameters) > 0 {
+		data, err := json.Marshal(mf.Parameters)
+		if err == nil {
+			var params ollamaOptions
+			if err = json.Unmarshal(data, &params); err == nil {
+				vm.Parameters = params.withDefaults(vm.Parameters)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parameters: " + err.Error()})
+			return
+		}
+	}
+
+	if err := s.virtual.Set(name, vm); err != nil {
+		requestLogger(c).Error("Error saving virtual model", "Error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	requestLogger(c).Info("Created model", "model", name, "from", vm.From)
+
+	if request.Stream != nil && !*request.Stream {
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		return
+	}
+	sw, ok := newStreamWriter(c, s.wantsSSE(c))
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		return
+	}
+	for _, status := range []string{"using existing layer", "creating new layer", "writing manifest", "success"} {
+		if err := sw.Write(gin.H{"status": status}); err != nil {
+			return
+		}
+	}
+}
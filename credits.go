@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credits returns the credits left on the OpenRouter account, in USD
+func (o *OpenrouterProvider) Credits(ctx context.Context) (float64, error) {
+	resp, err := o.Do(ctx, http.MethodGet, "credits", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching credits failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			TotalCredits float64 `json:"total_credits"`
+			TotalUsage   float64 `json:"total_usage"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	return body.Data.TotalCredits - body.Data.TotalUsage, nil
+}
+
+// SpentToday returns today's spending from the usage database, if the
+// server has one
+func (s *Server) SpentToday() (float64, bool) {
+	if s.usageDB == nil {
+		return 0, false
+	}
+	spent, err := s.usageDB.Spent(time.Now())
+	if err != nil {
+		return 0, false
+	}
+	return spent, true
+}
+
+// notify shows a desktop notification using the tools each platform ships
+// with
+func notify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, '%s', '%s', 'Warning')
+Start-Sleep -Seconds 10
+$n.Dispose()`, psQuote(title), psQuote(message))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		cmd = exec.Command("notify-send", title, message)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// psQuote escapes s for a single-quoted PowerShell string
+func psQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
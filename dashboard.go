@@ -0,0 +1,188 @@
+package main
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// Sizes of what the dashboard shows
+const (
+	recentRequestsSize = 100
+	dashboardLogLines  = 200
+	dashboardDays      = 14
+)
+
+// recentRequest is a finished request as listed on the dashboard
+type recentRequest struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id"`
+	Client        string    `json:"client,omitempty"`
+	Model         string    `json:"model"`
+	UpstreamModel string    `json:"upstream_model"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Tokens        int       `json:"tokens"`
+	Cost          float64   `json:"cost"`
+	DurationMs    int64     `json:"duration_ms"`
+}
+
+// recentRequests keeps the last finished requests, newest first
+type recentRequests struct {
+	mu       sync.Mutex
+	requests []recentRequest
+}
+
+func newRecentRequests() *recentRequests {
+	return &recentRequests{}
+}
+
+// Add records a finished request
+func (r *recentRequests) Add(ex *Exchange, outcome Outcome, cost float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append([]recentRequest{{
+		Time:          ex.Started,
+		RequestID:     ex.RequestID,
+		Client:        ex.Client,
+		Model:         ex.Model,
+		UpstreamModel: ex.Request.Model,
+		Status:        outcome.Status,
+		Error:         outcome.Error,
+		Tokens:        outcome.Usage.PromptTokens + outcome.Usage.CompletionTokens,
+		Cost:          cost,
+		DurationMs:    outcome.DurationMs,
+	}}, r.requests...)
+	if len(r.requests) > recentRequestsSize {
+		r.requests = r.requests[:recentRequestsSize]
+	}
+}
+
+// List returns the recorded requests, newest first
+func (r *recentRequests) List() []recentRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recentRequest{}, r.requests...)
+}
+
+// RecentRequests returns the last limit finished requests, newest first.
+// They come from the usage database, so requests made before a restart are
+// included, or from memory without one.
+func (s *Server) RecentRequests(limit int) []recentRequest {
+	if s.usageDB != nil {
+		requests, err := s.usageDB.Recent(limit)
+		if err == nil {
+			return requests
+		}
+		slog.Error("Failed to read usage database", "error", err)
+	}
+	requests := s.recent.List()
+	return requests[:min(limit, len(requests))]
+}
+
+// filterEntries returns the entries of the model filter, sorted
+func (s *Server) filterEntries() []string {
+	s.filterMu.RLock()
+	defer s.filterMu.RUnlock()
+
+	entries := make([]string, 0, len(s.filterMap))
+	for entry := range s.filterMap {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// handleDashboard serves the dashboard page
+func (s *Server) handleDashboard(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", dashboardPage)
+}
+
+// handleDashboardState serves everything the dashboard shows in one call,
+// which the page polls
+func (s *Server) handleDashboardState(c *gin.Context) {
+	logs := recentLogs.Lines()
+	if len(logs) > dashboardLogLines {
+		logs = logs[len(logs)-dashboardLogLines:]
+	}
+
+	state := gin.H{
+		"version":  ollamaVersion,
+		"port":     s.config.listenPort(),
+		"tls":      s.config.TLS.Enabled(),
+		"stats":    s.Stats(),
+		"requests": s.recent.List(),
+		"filter":   s.filterEntries(),
+		"logs":     logs,
+	}
+	if s.usageDB != nil {
+		daily, err := s.usageDB.Daily(time.Now().AddDate(0, 0, 1-dashboardDays))
+		if err != nil {
+			requestLogger(c).Error("Failed to read usage database", "Error", err)
+		} else {
+			state["daily"] = daily
+		}
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// handleDashboardFilter adds (POST) or removes (DELETE) a model filter
+// entry given as {"model": ...}
+func (s *Server) handleDashboardFilter(c *gin.Context) {
+	var request struct {
+		Model string `json:"model"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Model) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		return
+	}
+	model := strings.TrimSpace(request.Model)
+
+	if c.Request.Method == http.MethodPost {
+		// Patterns are kept as typed, model names as the filter file has them
+		add := s.addToFilter
+		if strings.ContainsAny(model, "*?[") {
+			if _, err := path.Match(model, ""); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pattern: " + err.Error()})
+				return
+			}
+			add = s.addFilterEntry
+		}
+		if err := add(model); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"filter": s.filterEntries()})
+		return
+	}
+
+	// Entries are removed as listed; a model name hides that model
+	removed, err := s.removeFilterEntry(model)
+	if err == nil && !removed {
+		var models []Model
+		if models, err = s.provider.GetModels(); err == nil {
+			removed, err = s.removeFromFilter(model, models)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model has no filter entry of its own"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"filter": s.filterEntries()})
+}
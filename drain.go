@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDrainTimeout is how long Stop waits for requests in flight when the
+// configuration doesn't say
+const defaultDrainTimeout = 30 * time.Second
+
+// drainTimeout returns how long Stop waits for requests in flight for the
+// configured seconds: 0 is the default and negative doesn't wait
+func drainTimeout(seconds int) time.Duration {
+	if seconds == 0 {
+		return defaultDrainTimeout
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// drainer counts the requests in flight so that stopping the server can let
+// streams finish instead of cutting them off
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	active   int
+	// idle is closed once draining has started and no request is left
+	idle chan struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{idle: make(chan struct{})}
+}
+
+// enter registers a new request. It returns false once draining has started.
+func (d *drainer) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+// leave unregisters a request registered by enter
+func (d *drainer) leave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active--
+	if d.draining && d.active == 0 {
+		close(d.idle)
+	}
+}
+
+// drain stops accepting requests and waits up to timeout for those in flight.
+// It returns the number of requests still running.
+func (d *drainer) drain(timeout time.Duration) int {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		if d.active == 0 {
+			close(d.idle)
+		}
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.idle:
+	case <-time.After(timeout):
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// drainMiddleware tracks requests in flight and answers new ones with 503
+// while the server is stopping
+func (s *Server) drainMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.drain.enter() {
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+			return
+		}
+		defer s.drain.leave()
+		c.Next()
+	}
+}
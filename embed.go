@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// embedBatchSize is the maximum number of inputs sent upstream per call
+	embedBatchSize = 256
+	// defaultEmbeddingContext is assumed when a model's context length is unknown
+	defaultEmbeddingContext = 8192
+	// charsPerToken is a rough estimate used where no tokenizer is available
+	charsPerToken = 4
+)
+
+// embedRequest is the body of an Ollama /api/embed request
+type embedRequest struct {
+	Model      string          `json:"model"`
+	Input      json.RawMessage `json:"input"`
+	Truncate   *bool           `json:"truncate"`
+	Dimensions int             `json:"dimensions"`
+}
+
+// legacyEmbedRequest is the body of the older /api/embeddings request
+type legacyEmbedRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// estimateTokens roughly estimates the number of tokens in text
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// parseEmbedInput accepts either a single string or an array of strings
+func parseEmbedInput(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array of strings")
+	}
+	return many, nil
+}
+
+// fitEmbedInputs checks every input against the model's context length,
+// truncating overlong inputs when truncate is set
+func fitEmbedInputs(inputs []string, contextLength int, truncate bool) error {
+	maxChars := contextLength * charsPerToken
+	for i, input := range inputs {
+		if estimateTokens(input) <= contextLength {
+			continue
+		}
+		if !truncate {
+			return fmt.Errorf("input %d exceeds maximum context length of %d tokens", i, contextLength)
+		}
+		inputs[i] = input[:maxChars]
+	}
+	return nil
+}
+
+// Embed creates embeddings for all inputs, batching large requests and
+// returning the vectors in input order
+func (o *OpenrouterProvider) Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, openai.Usage, error) {
+	embeddings := make([][]float32, 0, len(inputs))
+	var usage openai.Usage
+
+	for start := 0; start < len(inputs); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(inputs))
+		resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input:      inputs[start:end],
+			Model:      openai.EmbeddingModel(model),
+			Dimensions: dimensions,
+		})
+		if err != nil {
+			return nil, usage, err
+		}
+		if len(resp.Data) != end-start {
+			return nil, usage, fmt.Errorf("expected %d embeddings, got %d", end-start, len(resp.Data))
+		}
+
+		// The API reports each vector's index; don't rely on response order
+		sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+		for _, e := range resp.Data {
+			embeddings = append(embeddings, e.Embedding)
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+	}
+
+	return embeddings, usage, nil
+}
+
+// embed creates the embeddings for a request. It runs the accounting
+// interceptors, so budgets apply and the usage is recorded like a chat's.
+// On failure it answers the client itself and returns false.
+func (s *Server) embed(c *gin.Context, model, fullModelName string, inputs []string, dimensions int) ([][]float32, openai.Usage, bool) {
+	log := requestLogger(c)
+	ex := s.newExchange(c, model, &openai.ChatCompletionRequest{Model: fullModelName})
+	chain := s.newAccountingChain(ex)
+	if err := chain.Request(); err != nil {
+		log.Warn("Request rejected by interceptor", "Error", err)
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		c.JSON(rejectionStatus(err), gin.H{"error": err.Error()})
+		return nil, openai.Usage{}, false
+	}
+
+	embeddings, usage, err := s.provider.Embed(c.Request.Context(), fullModelName, inputs, dimensions)
+	if err != nil {
+		log.Error("Failed to create embeddings", "Error", err)
+		chain.Complete(failedOutcome(err))
+		status, message := upstreamError(err)
+		c.JSON(status, gin.H{"error": message})
+		return nil, openai.Usage{}, false
+	}
+	chain.Complete(Outcome{Status: OutcomeSuccess, Usage: usage})
+	return embeddings, usage, true
+}
+
+// handleEmbed serves /api/embed
+func (s *Server) handleEmbed(c *gin.Context) {
+	start := time.Now()
+
+	var request embedRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+
+	inputs, err := parseEmbedInput(request.Input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fullModelName, err := s.resolveModel(request.Model)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ollama truncates by default
+	truncate := request.Truncate == nil || *request.Truncate
+	if err := fitEmbedInputs(inputs, s.provider.ContextLength(fullModelName, defaultEmbeddingContext), truncate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	embeddings, usage, ok := s.embed(c, request.Model, fullModelName, inputs, request.Dimensions)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"model":             request.Model,
+		"embeddings":        embeddings,
+		"total_duration":    time.Since(start).Nanoseconds(),
+		"load_duration":     0,
+		"prompt_eval_count": usage.PromptTokens,
+	})
+}
+
+// handleLegacyEmbeddings serves the deprecated /api/embeddings endpoint
+func (s *Server) handleLegacyEmbeddings(c *gin.Context) {
+	var request legacyEmbedRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+
+	fullModelName, err := s.resolveModel(request.Model)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	inputs := []string{request.Prompt}
+	fitEmbedInputs(inputs, s.provider.ContextLength(fullModelName, defaultEmbeddingContext), true)
+
+	embeddings, _, ok := s.embed(c, request.Model, fullModelName, inputs, 0)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"embedding": embeddings[0]})
+}
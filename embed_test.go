@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEmbedUsageAndBudget(t *testing.T) {
+	upstream := newStubUpstream(t, nil)
+	config := DefaultConfig()
+	config.Budget.DailyUSD = 0.00001
+	s := newTestServer(t, upstream, config)
+
+	w := serve(t, s, http.MethodPost, "/api/embed", map[string]any{"model": "gpt-4o", "input": []string{"a", "b"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got := decodeJSON(t, w)["prompt_eval_count"]; got != float64(14) {
+		t.Errorf("prompt_eval_count = %v, want 14", got)
+	}
+
+	report := s.usage.Report()
+	if len(report) != 1 || report[0].Requests != 1 || report[0].PromptTokens != 14 || report[0].Cost <= 0 {
+		t.Fatalf("usage report = %+v, want one gpt-4o request with 14 prompt tokens and a cost", report)
+	}
+
+	// The first embedding cost more than the daily cap
+	for _, path := range []string{"/api/embed", "/api/embeddings"} {
+		w := serve(t, s, http.MethodPost, path, map[string]any{"model": "gpt-4o", "input": "c", "prompt": "c"})
+		if w.Code != http.StatusPaymentRequired {
+			t.Errorf("%s: status %d: %s, want 402", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackHeader names the model that answered when it isn't the requested
+// one
+const fallbackHeader = "X-Fallback-Model"
+
+// fallbackChain returns the configured fallbacks for the exchange's model,
+// looked up by the name the client used, the full model name or the name
+// without the vendor prefix
+func (s *Server) fallbackChain(ex *Exchange) []string {
+	for _, name := range []string{ex.Model, ex.Request.Model, shortModelName(ex.Request.Model)} {
+		if chain, ok := s.config.Fallbacks[name]; ok {
+			return chain
+		}
+	}
+	return nil
+}
+
+// withFallbacks runs call, which sends ex.Request upstream, and on failure
+// switches the request to each fallback model in turn until a call
+// succeeds. The model that answered is reported in the X-Fallback-Model
+// header; the last error is returned if all of them fail.
+func (s *Server) withFallbacks(c *gin.Context, ex *Exchange, call func() error) error {
+	err := call()
+	for _, name := range s.fallbackChain(ex) {
+		if err == nil || ex.ctx.Err() != nil {
+			break
+		}
+		fallback, resolveErr := s.resolveModel(name)
+		if resolveErr != nil {
+			continue
+		}
+
+		requestLogger(c).Warn("Model failed, trying fallback", "model", ex.Request.Model, "fallback", fallback, "error", err)
+		ex.Request.Model = fallback
+		c.Header(fallbackHeader, fallback)
+		err = call()
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// shortModelName strips the vendor prefix from a model name, which is the
+// form used in the models-filter file
+func shortModelName(model string) string {
+	parts := strings.Split(model, "/")
+	return parts[len(parts)-1]
+}
+
+// filterLineEntry returns the entry on a models-filter line, without
+// surrounding space and "#" comments
+func filterLineEntry(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// filterEntryMatches reports whether a filter entry allows a model. Entries
+// are glob patterns ("anthropic/*", "*-free"); those containing a "/" are
+// matched against the full model ID, the others against the name without
+// the vendor prefix.
+func filterEntryMatches(entry, model string) bool {
+	target := shortModelName(model)
+	if strings.Contains(entry, "/") {
+		target = model
+	}
+	ok, _ := path.Match(entry, target)
+	return ok
+}
+
+// allowedByFilter reports whether a model, given by its full ID, passes
+// the models-filter file
+func (s *Server) allowedByFilter(model string) bool {
+	s.filterMu.RLock()
+	defer s.filterMu.RUnlock()
+
+	if len(s.filterMap) == 0 {
+		return true
+	}
+	if _, ok := s.filterMap[shortModelName(model)]; ok {
+		return true
+	}
+	for entry := range s.filterMap {
+		if filterEntryMatches(entry, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterActive reports whether the model filter restricts the model list
+func (s *Server) filterActive() bool {
+	s.filterMu.RLock()
+	defer s.filterMu.RUnlock()
+	return len(s.filterMap) > 0
+}
+
+// addToFilter adds a model to the filter and appends it to the filter file
+func (s *Server) addToFilter(model string) error {
+	return s.addFilterEntry(shortModelName(model))
+}
+
+// addFilterEntry adds an entry, a model name or pattern, to the filter and
+// appends it to the filter file
+func (s *Server) addFilterEntry(name string) error {
+	s.filterMu.Lock()
+	defer s.filterMu.Unlock()
+
+	if _, ok := s.filterMap[name]; ok {
+		return nil
+	}
+	s.filterMap[name] = struct{}{}
+
+	file, err := os.OpenFile(s.modelFilter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(name + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// removeFromFilter hides a model. An inactive filter is first filled with
+// every model in models, since an empty filter shows them all. Only plain
+// entries can be removed; a model allowed by a pattern stays visible. It
+// returns false if the model had no entry of its own.
+func (s *Server) removeFromFilter(model string, models []Model) (bool, error) {
+	s.filterMu.Lock()
+	defer s.filterMu.Unlock()
+
+	name := shortModelName(model)
+	if len(s.filterMap) == 0 {
+		found := false
+		names := make([]string, 0, len(models))
+		for _, m := range models {
+			if m.Model == name {
+				found = true
+				continue
+			}
+			s.filterMap[m.Model] = struct{}{}
+			names = append(names, m.Model)
+		}
+		if !found {
+			clear(s.filterMap)
+			return false, nil
+		}
+		sort.Strings(names)
+		return true, os.WriteFile(s.modelFilter, []byte(strings.Join(names, "\n")+"\n"), 0644)
+	}
+
+	if _, ok := s.filterMap[name]; !ok {
+		return false, nil
+	}
+	delete(s.filterMap, name)
+	return true, s.removeFilterLine(name)
+}
+
+// setFilter replaces the filter and the filter file with entries; none
+// lifts the filter
+func (s *Server) setFilter(entries []string) error {
+	s.filterMu.Lock()
+	defer s.filterMu.Unlock()
+
+	filter := make(map[string]struct{}, len(entries))
+	var data strings.Builder
+	for _, entry := range entries {
+		entry = filterLineEntry(entry)
+		if _, seen := filter[entry]; entry == "" || seen {
+			continue
+		}
+		filter[entry] = struct{}{}
+		data.WriteString(entry + "\n")
+	}
+	if err := os.WriteFile(s.modelFilter, []byte(data.String()), 0644); err != nil {
+		return err
+	}
+	s.filterMap = filter
+	return nil
+}
+
+// removeFilterEntry drops a filter entry, pattern or not, as listed in the
+// filter. It returns false if there is no such entry.
+func (s *Server) removeFilterEntry(entry string) (bool, error) {
+	s.filterMu.Lock()
+	defer s.filterMu.Unlock()
+
+	if _, ok := s.filterMap[entry]; !ok {
+		return false, nil
+	}
+	delete(s.filterMap, entry)
+	return true, s.removeFilterLine(entry)
+}
+
+// removeFilterLine drops the lines holding entry from the filter file,
+// keeping comments and all other lines as they are. The caller must hold
+// filterMu.
+func (s *Server) removeFilterLine(entry string) error {
+	data, err := os.ReadFile(s.modelFilter)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if filterLineEntry(line) != entry {
+			kept = append(kept, line)
+		}
+	}
+	return os.WriteFile(s.modelFilter, []byte(strings.Join(kept, "")), 0644)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// responseFormat maps Ollama's "format" field, either "json" or a JSON
+// schema object, to an OpenAI response_format
+func responseFormat(raw json.RawMessage) (*openai.ChatCompletionResponseFormat, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" || string(raw) == `""` {
+		return nil, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		if name != "json" {
+			return nil, fmt.Errorf("invalid format %q, expected \"json\" or a JSON schema", name)
+		}
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}, nil
+	}
+
+	if raw[0] != '{' || !json.Valid(raw) {
+		return nil, fmt.Errorf("invalid format, expected \"json\" or a JSON schema")
+	}
+
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   "response",
+			Schema: raw,
+		},
+	}, nil
+}
+
+// withFormatInstruction adds a system instruction describing the requested
+// format. OpenAI rejects JSON mode unless a message mentions JSON, which
+// Ollama does not require, and models without native structured output
+// support on OpenRouter only follow a schema they have been shown.
+func withFormatInstruction(messages []openai.ChatCompletionMessage, format *openai.ChatCompletionResponseFormat) []openai.ChatCompletionMessage {
+	if format == nil {
+		return messages
+	}
+
+	var instruction string
+	switch format.Type {
+	case openai.ChatCompletionResponseFormatTypeJSONObject:
+		for _, m := range messages {
+			if strings.Contains(strings.ToLower(m.Content), "json") {
+				return messages
+			}
+		}
+		instruction = "Respond with a JSON object."
+	case openai.ChatCompletionResponseFormatTypeJSONSchema:
+		schema, err := json.Marshal(format.JSONSchema.Schema)
+		if err != nil {
+			return messages
+		}
+		instruction = "Respond with a JSON object that matches this JSON schema: " + string(schema)
+	default:
+		return messages
+	}
+
+	out := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	out = append(out, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: instruction})
+	return append(out, messages...)
+}
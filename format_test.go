@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestResponseFormat(t *testing.T) {
+	schema := `{"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}`
+
+	tests := []struct {
+		name     string
+		format   string
+		wantType openai.ChatCompletionResponseFormatType
+		wantErr  bool
+	}{
+		{name: "absent", format: ``},
+		{name: "null", format: `null`},
+		{name: "empty string", format: `""`},
+		{name: "json", format: `"json"`, wantType: openai.ChatCompletionResponseFormatTypeJSONObject},
+		{name: "schema", format: schema, wantType: openai.ChatCompletionResponseFormatTypeJSONSchema},
+		{name: "unknown name", format: `"yaml"`, wantErr: true},
+		{name: "array", format: `["city"]`, wantErr: true},
+		{name: "invalid schema", format: `{"type": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := responseFormat(json.RawMessage(tt.format))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantType == "" {
+				if got != nil {
+					t.Errorf("got %+v, want no response format", got)
+				}
+				return
+			}
+			if got == nil || got.Type != tt.wantType {
+				t.Fatalf("got %+v, want type %s", got, tt.wantType)
+			}
+			if tt.wantType != openai.ChatCompletionResponseFormatTypeJSONSchema {
+				return
+			}
+			if got.JSONSchema == nil || got.JSONSchema.Name == "" {
+				t.Fatalf("schema format without a named schema: %+v", got)
+			}
+			data, err := json.Marshal(got.JSONSchema.Schema)
+			if err != nil || !jsonEqual(t, data, []byte(schema)) {
+				t.Errorf("schema = %s, want %s", data, schema)
+			}
+		})
+	}
+}
+
+func TestWithFormatInstruction(t *testing.T) {
+	schemaFormat, _ := responseFormat(json.RawMessage(`{"type": "object"}`))
+	jsonFormat, _ := responseFormat(json.RawMessage(`"json"`))
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "Name a city."}
+	userJSON := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "Name a city as JSON."}
+
+	tests := []struct {
+		name        string
+		messages    []openai.ChatCompletionMessage
+		format      *openai.ChatCompletionResponseFormat
+		instruction string
+	}{
+		{name: "no format", messages: []openai.ChatCompletionMessage{user}},
+		{name: "json", messages: []openai.ChatCompletionMessage{user}, format: jsonFormat, instruction: "Respond with a JSON object."},
+		{name: "json already asked for", messages: []openai.ChatCompletionMessage{userJSON}, format: jsonFormat},
+		{name: "schema", messages: []openai.ChatCompletionMessage{userJSON}, format: schemaFormat, instruction: `{"type":"object"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withFormatInstruction(tt.messages, tt.format)
+			if tt.instruction == "" {
+				if len(got) != len(tt.messages) {
+					t.Errorf("got %d messages, want the %d given", len(got), len(tt.messages))
+				}
+				return
+			}
+			if len(got) != len(tt.messages)+1 || got[0].Role != openai.ChatMessageRoleSystem || !strings.Contains(got[0].Content, tt.instruction) {
+				t.Errorf("got %+v, want a system message containing %q first", got, tt.instruction)
+			}
+		})
+	}
+}
+
+// jsonEqual reports whether two JSON documents hold the same value
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
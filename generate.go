@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// infillSystemPrompt instructs chat models to behave like a FIM code model
+const infillSystemPrompt = "You are a code completion engine. The user sends the code before the cursor in <prefix> and the code after it in <suffix>. Reply with only the text that belongs at the cursor, without explanations or markdown fences."
+
+// generateRequest is the body of an Ollama /api/generate request
+type generateRequest struct {
+	Model     string          `json:"model"`
+	Prompt    string          `json:"prompt"`
+	System    string          `json:"system"`
+	Template  string          `json:"template"`
+	Format    json.RawMessage `json:"format"`
+	Images    []string        `json:"images"`
+	Suffix    string          `json:"suffix"`
+	Raw       bool            `json:"raw"`
+	Stream    *bool           `json:"stream"`
+	Options   *ollamaOptions  `json:"options"`
+	KeepAlive *keepAlive      `json:"keep_alive"`
+	// Provider overrides the configured OpenRouter provider preferences
+	Provider *ProviderPreferences `json:"provider"`
+}
+
+// textStream yields generated text from a chat or a legacy completion stream
+type textStream interface {
+	Recv() (text, finishReason string, err error)
+	// Usage reports the token usage seen so far, if upstream sent any
+	Usage() openai.Usage
+	Close() error
+}
+
+type chatTextStream struct {
+	stream *openai.ChatCompletionStream
+	usage  openai.Usage
+}
+
+func (s *chatTextStream) Recv() (string, string, error) {
+	resp, err := s.stream.Recv()
+	if err == nil && resp.Usage != nil {
+		s.usage = *resp.Usage
+	}
+	if err != nil || len(resp.Choices) == 0 {
+		return "", "", err
+	}
+	return resp.Choices[0].Delta.Content, string(resp.Choices[0].FinishReason), nil
+}
+
+func (s *chatTextStream) Usage() openai.Usage {
+	return s.usage
+}
+
+func (s *chatTextStream) Close() error {
+	return s.stream.Close()
+}
+
+type completionTextStream struct {
+	stream *openai.CompletionStream
+	usage  openai.Usage
+}
+
+func (s *completionTextStream) Recv() (string, string, error) {
+	resp, err := s.stream.Recv()
+	if err == nil && resp.Usage.TotalTokens > 0 {
+		s.usage = resp.Usage
+	}
+	if err != nil || len(resp.Choices) == 0 {
+		return "", "", err
+	}
+	return resp.Choices[0].Text, resp.Choices[0].FinishReason, nil
+}
+
+func (s *completionTextStream) Usage() openai.Usage {
+	return s.usage
+}
+
+func (s *completionTextStream) Close() error {
+	return s.stream.Close()
+}
+
+// Complete sends a legacy (non-chat) completion request
+func (o *OpenrouterProvider) Complete(ctx context.Context, req openai.CompletionRequest) (openai.CompletionResponse, error) {
+	req.Stream = false
+	return o.client.CreateCompletion(ctx, req)
+}
+
+// CompleteStream sends a streaming legacy completion request
+func (o *OpenrouterProvider) CompleteStream(ctx context.Context, req openai.CompletionRequest) (*openai.CompletionStream, error) {
+	req.Stream = true
+	return o.client.CreateCompletionStream(ctx, req)
+}
+
+// promptTemplateData is what a client-supplied prompt template can refer to,
+// following Ollama's template variables
+type promptTemplateData struct {
+	System   string
+	Prompt   string
+	Suffix   string
+	Response string
+}
+
+// generateMessages turns a generate request into chat messages. Prompts with
+// a suffix are phrased as a fill-in-the-middle task; a template, if given,
+// is rendered into a single user message since it already includes the
+// system prompt.
+func generateMessages(request generateRequest) ([]openai.ChatCompletionMessage, error) {
+	if request.Raw {
+		return []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: request.Prompt},
+		}, nil
+	}
+
+	if request.Suffix != "" {
+		return []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: infillSystemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: "<prefix>" + request.Prompt + "</prefix><suffix>" + request.Suffix + "</suffix>"},
+		}, nil
+	}
+
+	if request.Template != "" {
+		tmpl, err := template.New("prompt").Parse(request.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		var prompt strings.Builder
+		if err := tmpl.Execute(&prompt, promptTemplateData{System: request.System, Prompt: request.Prompt}); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt.String()}
+		withImages(&user, request.Images)
+		return []openai.ChatCompletionMessage{user}, nil
+	}
+
+	var messages []openai.ChatCompletionMessage
+	if request.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: request.System})
+	}
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: request.Prompt}
+	withImages(&user, request.Images)
+	return append(messages, user), nil
+}
+
+// completionRequest converts a chat request for raw prompts, which are
+// already templated by the client and go to the completions endpoint as is
+func completionRequest(req *openai.ChatCompletionRequest, suffix string) openai.CompletionRequest {
+	prompt := ""
+	if len(req.Messages) > 0 {
+		prompt = req.Messages[len(req.Messages)-1].Content
+	}
+	return openai.CompletionRequest{
+		Model:            req.Model,
+		Prompt:           prompt,
+		Suffix:           suffix,
+		MaxTokens:        req.MaxTokens,
+		Stop:             req.Stop,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		User:             req.User,
+	}
+}
+
+// handleGenerate serves /api/generate
+func (s *Server) handleGenerate(c *gin.Context) {
+	log := requestLogger(c)
+
+	var request generateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	if err := request.Provider.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Streaming is the default, as for /api/chat
+	streamRequested := request.Stream == nil || *request.Stream
+
+	fullModelName, err := s.resolveModel(request.Model)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	s.models.Touch(request.Model, fullModelName, keepAliveDuration(request.KeepAlive))
+
+	// An empty prompt only loads or unloads the model, as for /api/chat
+	if request.Prompt == "" && request.Suffix == "" && len(request.Images) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"model":       request.Model,
+			"created_at":  time.Now().Format(time.RFC3339),
+			"response":    "",
+			"done":        true,
+			"done_reason": loadDoneReason(request.KeepAlive),
+		})
+		return
+	}
+
+	// Virtual models bring their own system prompt and default options
+	if vm, ok := s.virtual.Get(request.Model); ok {
+		if request.System == "" {
+			request.System = vm.System
+		}
+		request.Options = request.Options.withDefaults(vm.Parameters)
+	}
+	profile, hasProfile := s.modelProfile(request.Model, fullModelName)
+	if hasProfile {
+		if request.System == "" {
+			request.System = profile.System
+		}
+		request.Options = request.Options.withDefaults(profile.Options)
+	}
+
+	messages, err := generateMessages(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format, err := responseFormat(request.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ex := s.newExchange(c, request.Model, &openai.ChatCompletionRequest{
+		Model:          fullModelName,
+		Messages:       withFormatInstruction(messages, format),
+		Stream:         streamRequested,
+		ResponseFormat: format,
+	})
+	request.Options.applyChat(ex)
+	s.applyProviderPreferences(ex, request.Provider, profile)
+
+	chain := s.newInterceptorChain(ex)
+	if err := chain.Request(); err != nil {
+		log.Warn("Request rejected by interceptor", "Error", err)
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		c.JSON(rejectionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deterministic prompts asked before are answered from the cache. Raw
+	// prompts go to the completions API, whose answers aren't cached.
+	if !request.Raw {
+		if s.cache.Lookup(ex); ex.cached != nil {
+			s.serveCached(c, chain, streamRequested, func(content string) gin.H {
+				return gin.H{"model": ex.Model, "response": content, "context": []int{}}
+			})
+			return
+		}
+	}
+
+	defer ex.startTimeouts(s.config.Timeouts, streamRequested)()
+	ctx := ex.upstreamContext()
+	ex.markSent()
+	if !streamRequested {
+		s.generateOnce(ctx, c, chain, request)
+		return
+	}
+
+	var stream textStream
+	err = s.withFallbacks(c, ex, func() error {
+		if request.Raw {
+			cs, err := s.provider.CompleteStream(ctx, completionRequest(ex.Request, request.Suffix))
+			stream = &completionTextStream{stream: cs}
+			return err
+		}
+		cs, err := s.provider.ChatStream(ctx, *ex.Request)
+		stream = &chatTextStream{stream: cs}
+		return err
+	})
+	if err != nil {
+		err = ex.timedOut(err)
+		log.Error("Failed to create stream", "Error", err)
+		chain.Complete(failedOutcome(err))
+		status, message := upstreamError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	defer stream.Close()
+
+	s.generateStream(c, chain, stream)
+}
+
+// generateOnce handles a non-streaming generate request
+func (s *Server) generateOnce(ctx context.Context, c *gin.Context, chain *interceptorChain, request generateRequest) {
+	ex := chain.ex
+
+	var text, finishReason string
+	var usage openai.Usage
+	if request.Raw {
+		var resp openai.CompletionResponse
+		err := s.withFallbacks(c, ex, func() (err error) {
+			resp, err = s.provider.Complete(ctx, completionRequest(ex.Request, request.Suffix))
+			return err
+		})
+		if err == nil && len(resp.Choices) == 0 {
+			err = errors.New("No response from model")
+		}
+		if err != nil {
+			err = ex.timedOut(err)
+			requestLogger(c).Error("Failed to get completion", "Error", err)
+			chain.Complete(failedOutcome(err))
+			status, message := upstreamError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		text, finishReason, usage = resp.Choices[0].Text, resp.Choices[0].FinishReason, resp.Usage
+	} else {
+		var resp openai.ChatCompletionResponse
+		err := s.withFallbacks(c, ex, func() (err error) {
+			resp, err = s.provider.Chat(ctx, *ex.Request)
+			return err
+		})
+		if err == nil && len(resp.Choices) == 0 {
+			err = errors.New("No response from model")
+		}
+		if err != nil {
+			err = ex.timedOut(err)
+			requestLogger(c).Error("Failed to get chat response", "Error", err)
+			chain.Complete(failedOutcome(err))
+			status, message := upstreamError(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		text, finishReason, usage = resp.Choices[0].Message.Content, string(resp.Choices[0].FinishReason), resp.Usage
+	}
+
+	text, err := chain.Response(text)
+	if err == nil {
+		var tail string
+		tail, err = chain.Flush()
+		text += tail
+	}
+	if err != nil {
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error(), Usage: usage})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	chain.Complete(Outcome{Status: OutcomeSuccess, FinishReason: finishReason, Usage: usage})
+
+	response := gin.H{
+		"model":       ex.Model,
+		"created_at":  time.Now().Format(time.RFC3339),
+		"response":    text,
+		"done":        true,
+		"done_reason": ollamaDoneReason(finishReason),
+		"context":     []int{},
+	}
+	ex.addTimings(response, usage)
+	c.JSON(http.StatusOK, response)
+}
+
+// generateStream relays a generate stream to the client
+func (s *Server) generateStream(c *gin.Context, chain *interceptorChain, stream textStream) {
+	log := requestLogger(c)
+	ex := chain.ex
+
+	sw, ok := newStreamWriter(c, s.wantsSSE(c))
+	if !ok {
+		log.Error("Expected http.ResponseWriter to be an http.Flusher")
+		return
+	}
+
+	var lastFinishReason string
+	for {
+		text, finishReason, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && ex.ctx.Err() != nil {
+			// The client went away; the upstream request is cancelled with it
+			log.Info("Client disconnected, stream aborted")
+			chain.Complete(Outcome{Status: OutcomeError, Error: errClientDisconnected})
+			return
+		}
+		if err != nil {
+			err = ex.timedOut(err)
+			log.Error("Backend stream error", "Error", err)
+			chain.Complete(failedOutcome(err))
+			_, message := upstreamError(err)
+			sw.Error(message)
+			return
+		}
+		if finishReason != "" {
+			lastFinishReason = finishReason
+		}
+		if text != "" {
+			ex.markToken()
+		}
+
+		text, err = chain.Response(text)
+		if err != nil {
+			chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+			sw.Error(err.Error())
+			return
+		}
+		if text == "" {
+			continue
+		}
+
+		if err := sw.Write(gin.H{
+			"model":      ex.Model,
+			"created_at": time.Now().Format(time.RFC3339),
+			"response":   text,
+			"done":       false,
+		}); err != nil {
+			log.Error("Error marshaling intermediate response JSON", "Error", err)
+			return
+		}
+	}
+
+	if lastFinishReason == "" {
+		lastFinishReason = "stop"
+	}
+
+	finalText, err := chain.Flush()
+	if err != nil {
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		sw.Error(err.Error())
+		return
+	}
+	usage := stream.Usage()
+	chain.Complete(Outcome{Status: OutcomeSuccess, FinishReason: lastFinishReason, Usage: usage})
+
+	finalResponse := gin.H{
+		"model":       ex.Model,
+		"created_at":  time.Now().Format(time.RFC3339),
+		"response":    finalText,
+		"done":        true,
+		"done_reason": ollamaDoneReason(lastFinishReason),
+		"context":     []int{},
+	}
+	ex.addTimings(finalResponse, usage)
+	if err := sw.Write(finalResponse); err != nil {
+		log.Error("Error marshaling final response JSON", "Error", err)
+	}
+}
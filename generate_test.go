@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestGenerateDoneReason(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		if req.Stream {
+			streamChunks(w, contentChunk("Hi"), finishChunk(openai.FinishReasonToolCalls))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: req.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hi"},
+				FinishReason: openai.FinishReasonToolCalls,
+			}},
+		})
+	})
+	s := newTestServer(t, upstream, DefaultConfig())
+
+	for _, stream := range []bool{false, true} {
+		w := serve(t, s, http.MethodPost, "/api/generate", map[string]any{"model": "gpt-4o", "prompt": "Hi", "stream": stream})
+		if w.Code != http.StatusOK {
+			t.Fatalf("stream %v: status %d: %s", stream, w.Code, w.Body.String())
+		}
+		var last map[string]any
+		if stream {
+			lines := decodeNDJSON(t, w)
+			last = lines[len(lines)-1]
+		} else {
+			last = decodeJSON(t, w)
+		}
+		// Reported like /api/chat does
+		if last["done_reason"] != "stop" {
+			t.Errorf("stream %v: done_reason = %v, want stop", stream, last["done_reason"])
+		}
+	}
+}
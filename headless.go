@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// isHeadlessCommand reports whether args ask for the proxy to run without
+// the system tray, via the "serve" subcommand or the --headless flag
+func isHeadlessCommand(args []string) bool {
+	return len(args) == 2 && (args[1] == "serve" || args[1] == "--headless")
+}
+
+// newHeadlessServer creates the server for headless mode from config.json
+func newHeadlessServer() (*Server, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		slog.Error("Failed to load config, using defaults", "error", err)
+		config = DefaultConfig()
+	}
+
+	apiKey, err := resolveAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(apiKey, config), nil
+}
+
+// runHeadless runs the proxy server in the foreground without a tray icon
+// until it fails or the process receives SIGINT or SIGTERM. SIGHUP reloads
+// the configuration. Under systemd, readiness is reported with sd_notify.
+func runHeadless() error {
+	server, err := newHeadlessServer()
+	if err != nil {
+		return err
+	}
+	server.OnStateChange = func(state ServerState, detail string) {
+		switch state {
+		case ServerStarted:
+			sdNotify("READY=1\nSTATUS=Running")
+		case ServerDegraded:
+			sdNotify("STATUS=Degraded: " + detail)
+		}
+	}
+	server.OnNotice = func(title, message string) {
+		slog.Warn(title, "detail", message)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				sdNotify("RELOADING=1")
+				reloadHeadless(server)
+				sdNotify("READY=1")
+				continue
+			}
+			slog.Info("Shutting down", "signal", sig.String())
+			sdNotify("STOPPING=1")
+			server.Stop()
+			return nil
+		case err := <-errCh:
+			server.Stop()
+			return err
+		}
+	}
+}
+
+// reloadHeadless applies config.json to the running server again
+func reloadHeadless(server *Server) {
+	config, err := LoadConfig()
+	if err != nil {
+		slog.Error("Failed to reload config", "error", err)
+		return
+	}
+	if err := server.Reload(config); err != nil {
+		slog.Error("Failed to reload config", "error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ServerState is the health of a server as reported to OnStateChange
+type ServerState string
+
+const (
+	// ServerStarted means the server accepts connections and upstream
+	// requests succeed
+	ServerStarted ServerState = "started"
+	// ServerDegraded means the server runs but upstream requests keep
+	// failing, e.g. because the key was revoked or OpenRouter is down
+	ServerDegraded ServerState = "degraded"
+	// ServerFailed means the server could not start or stopped on an error
+	ServerFailed ServerState = "failed"
+	// ServerStopped means the server was stopped
+	ServerStopped ServerState = "stopped"
+)
+
+// degradedAfter is how many upstream failures in a row mark the server as
+// degraded; a single success marks it healthy again
+const degradedAfter = 3
+
+// healthTracker follows the outcomes of upstream requests to tell when the
+// server is degraded, and when the key or the credits stopped working. It
+// is shared by the generations of a server.
+type healthTracker struct {
+	mu       sync.Mutex
+	failures int
+	degraded bool
+	// changed is called when the server becomes degraded or recovers
+	changed func(state ServerState, detail string)
+	notices *notices
+}
+
+func newHealthTracker(changed func(state ServerState, detail string), n *notices) *healthTracker {
+	return &healthTracker{changed: changed, notices: n}
+}
+
+// Record takes note of how a request to upstream ended
+func (h *healthTracker) Record(outcome Outcome) {
+	switch outcome.UpstreamStatus {
+	case http.StatusUnauthorized:
+		h.notices.Send("auth", "OpenRouter rejected the API key", outcome.Error)
+	case http.StatusPaymentRequired:
+		h.notices.Send("credits", "OpenRouter credits used up", outcome.Error)
+	}
+
+	h.mu.Lock()
+	var state ServerState
+	switch {
+	case outcome.Status == OutcomeSuccess:
+		h.notices.Reset("auth")
+		h.notices.Reset("credits")
+		h.failures = 0
+		if h.degraded {
+			h.degraded = false
+			state = ServerStarted
+		}
+	case outcome.Status == OutcomeError && outcome.Error != errClientDisconnected:
+		h.failures++
+		if h.failures >= degradedAfter && !h.degraded {
+			h.degraded = true
+			state = ServerDegraded
+		}
+	}
+	h.mu.Unlock()
+
+	if state != "" {
+		h.changed(state, outcome.Error)
+	}
+}
+
+// notices passes events worth a desktop notification to OnNotice, each
+// only once until it is reset. It is shared by the generations of a server.
+type notices struct {
+	mu   sync.Mutex
+	sent map[string]bool
+	send func(title, message string)
+}
+
+func newNotices(send func(title, message string)) *notices {
+	return &notices{sent: map[string]bool{}, send: send}
+}
+
+// Send passes on the event named key unless it was sent since the last
+// Reset of key
+func (n *notices) Send(key, title, message string) {
+	n.mu.Lock()
+	sent := n.sent[key]
+	n.sent[key] = true
+	n.mu.Unlock()
+	if !sent {
+		n.send(title, message)
+	}
+}
+
+// Reset lets the event named key be sent again
+func (n *notices) Reset(key string) {
+	n.mu.Lock()
+	delete(n.sent, key)
+	n.mu.Unlock()
+}
+
+// notice passes an event to OnNotice
+func (s *Server) notice(title, message string) {
+	if s.OnNotice != nil {
+		s.OnNotice(title, message)
+	}
+}
+
+// setState reports a change of the server's health to OnStateChange
+func (s *Server) setState(state ServerState, detail string) {
+	if s.OnStateChange != nil {
+		s.OnStateChange(state, detail)
+	}
+}
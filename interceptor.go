@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Exchange carries the state of a single chat request through the
+// interceptor chain
+type Exchange struct {
+	// Model is the model name the client asked for
+	Model string
+	// RequestID identifies the request in logs and usage records
+	RequestID string
+	// Client is the name of the client key the request was made with
+	Client string
+	// Request is the request that will be sent upstream; interceptors may
+	// modify it in place
+	Request *openai.ChatCompletionRequest
+	// Started is when the proxy received the request
+	Started time.Time
+	// ctx is the client request's context; it ends when the client goes away
+	ctx context.Context
+	// limit derives from ctx and also ends when the exchange times out; see
+	// startTimeouts
+	limit           context.Context
+	firstTokenTimer *time.Timer
+	// reasoning collects the model's reasoning when the client asked for it
+	reasoning *reasoningCollector
+	// sent and firstToken time the upstream call, see addTimings
+	sent       time.Time
+	firstToken time.Time
+	// cacheKey is set when the answer is to be cached, cached when it was
+	// found in the cache; see responseCache.Lookup
+	cacheKey string
+	cached   *cachedAnswer
+	// UpstreamHeader holds extra headers sent with the upstream request
+	UpstreamHeader http.Header
+	// UpstreamFields are added to the upstream JSON body, for OpenRouter
+	// parameters go-openai has no fields for (e.g. top_k)
+	UpstreamFields map[string]interface{}
+}
+
+// newExchange starts an exchange for a client request, attaching the
+// client's identity, request ID and trace context to the upstream request
+func (s *Server) newExchange(c *gin.Context, model string, req *openai.ChatCompletionRequest) *Exchange {
+	req.User = s.clientUser(c.Request.Header)
+	ex := &Exchange{
+		Model:          model,
+		RequestID:      requestID(c),
+		Client:         clientName(c),
+		Request:        req,
+		Started:        time.Now(),
+		ctx:            c.Request.Context(),
+		UpstreamHeader: s.forwardHeaders(c.Request.Header),
+	}
+	ex.UpstreamHeader.Set(requestIDHeader, ex.RequestID)
+	setTraceHeaders(c, ex.UpstreamHeader)
+	return ex
+}
+
+// upstreamContext returns the context for the upstream call, carrying the
+// exchange's extra headers and body fields. It is cancelled when the client
+// disconnects or the exchange times out, which aborts the upstream request.
+func (ex *Exchange) upstreamContext() context.Context {
+	ctx := ex.ctx
+	if ex.limit != nil {
+		ctx = ex.limit
+	}
+	ctx = withUpstreamHeader(ctx, ex.UpstreamHeader)
+	ctx = withReasoningCollector(ctx, ex.reasoning)
+	return withUpstreamFields(ctx, ex.UpstreamFields)
+}
+
+// setUpstreamField adds a field to the upstream JSON body
+func (ex *Exchange) setUpstreamField(name string, value interface{}) {
+	if ex.UpstreamFields == nil {
+		ex.UpstreamFields = map[string]interface{}{}
+	}
+	ex.UpstreamFields[name] = value
+}
+
+// Outcome statuses
+const (
+	OutcomeSuccess  = "success"
+	OutcomeError    = "error"
+	OutcomeRejected = "rejected"
+)
+
+// errClientDisconnected is the error of exchanges the client gave up on
+const errClientDisconnected = "client disconnected"
+
+// Outcome describes how an exchange ended
+type Outcome struct {
+	Status       string       `json:"status"`
+	Error        string       `json:"error,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	Usage        openai.Usage `json:"usage"`
+	DurationMs   int64        `json:"duration_ms"`
+	// UpstreamStatus is the HTTP status of a failed upstream call, if
+	// upstream answered
+	UpstreamStatus int `json:"upstream_status,omitempty"`
+}
+
+// Interceptor transforms a chat request on its way upstream and the
+// assistant's content on its way back to the client
+type Interceptor interface {
+	// InterceptRequest is called once before the request is sent upstream.
+	// Returning an error rejects the request.
+	InterceptRequest(ex *Exchange) error
+	// InterceptResponse is called for every piece of assistant content. For
+	// non-streaming responses it is called once with the complete content.
+	InterceptResponse(ex *Exchange, content string) (string, error)
+	// Flush is called after the last piece of content and returns anything
+	// the interceptor held back or wants to append.
+	Flush(ex *Exchange) (string, error)
+}
+
+// CompletionObserver is implemented by interceptors that want to know how an
+// exchange ended, e.g. to report usage
+type CompletionObserver interface {
+	Complete(ex *Exchange, outcome Outcome)
+}
+
+// InterceptorFactory creates the interceptor for a single request. It
+// returns nil when the interceptor is disabled for this server.
+type InterceptorFactory func(s *Server) Interceptor
+
+type registeredInterceptor struct {
+	name    string
+	factory InterceptorFactory
+}
+
+var interceptorRegistry []registeredInterceptor
+
+// RegisterInterceptor adds an interceptor to the chain. Requests pass through
+// interceptors in registration order, responses in reverse order.
+func RegisterInterceptor(name string, factory InterceptorFactory) {
+	interceptorRegistry = append(interceptorRegistry, registeredInterceptor{name: name, factory: factory})
+}
+
+func init() {
+	// Output filtering is registered first so it sees responses last, after
+	// PII placeholders have been restored
+	RegisterInterceptor("output-filter", newOutputFilterInterceptor)
+	// Over-budget requests are rejected before anything else runs
+	RegisterInterceptor("budget", newBudgetInterceptor)
+	RegisterInterceptor("sampling-clamps", newClampInterceptor)
+	RegisterInterceptor("secrets", newSecretsInterceptor)
+	RegisterInterceptor("pii", newPIIInterceptor)
+	RegisterInterceptor("plugins", newPluginInterceptor)
+	// The conversation is fitted to the context window once every
+	// transform that may lengthen it has run
+	RegisterInterceptor("context-window", newContextWindowInterceptor)
+	// Webhooks come last so the pre-request hook sees the request exactly as
+	// it will be sent upstream
+	RegisterInterceptor("webhook", newWebhookInterceptor)
+	// Transcripts record what the webhook let through, and see responses
+	// as upstream sent them
+	RegisterInterceptor("transcript", newTranscriptInterceptor)
+	// Shadow requests mirror the request as sent upstream
+	RegisterInterceptor("shadow", newShadowInterceptor)
+	// The cache keeps answers exactly as upstream sent them, to replay
+	// them through the interceptors above
+	RegisterInterceptor("cache", newCacheInterceptor)
+	RegisterInterceptor("usage", newUsageInterceptor)
+}
+
+// interceptorChain holds the interceptors active for one request
+type interceptorChain struct {
+	ex     *Exchange
+	active []Interceptor
+}
+
+// newInterceptorChain instantiates all registered interceptors for a request
+func (s *Server) newInterceptorChain(ex *Exchange) *interceptorChain {
+	chain := &interceptorChain{ex: ex}
+	for _, r := range interceptorRegistry {
+		if ic := r.factory(s); ic != nil {
+			chain.active = append(chain.active, ic)
+		}
+	}
+	return chain
+}
+
+// accountingInterceptors enforce budgets and record usage without looking
+// at content. They are the only ones run for requests the chain can't
+// transform, such as embeddings and the OpenAI passthrough.
+var accountingInterceptors = []string{"budget", "usage"}
+
+// newAccountingChain instantiates the accounting interceptors for a request
+func (s *Server) newAccountingChain(ex *Exchange) *interceptorChain {
+	chain := &interceptorChain{ex: ex}
+	for _, r := range interceptorRegistry {
+		if !slices.Contains(accountingInterceptors, r.name) {
+			continue
+		}
+		if ic := r.factory(s); ic != nil {
+			chain.active = append(chain.active, ic)
+		}
+	}
+	return chain
+}
+
+// Request runs all request interceptors in order
+func (c *interceptorChain) Request() error {
+	for _, ic := range c.active {
+		if err := ic.InterceptRequest(c.ex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Response runs a piece of content through all interceptors in reverse order
+func (c *interceptorChain) Response(content string) (string, error) {
+	return c.responseFrom(len(c.active)-1, content)
+}
+
+func (c *interceptorChain) responseFrom(i int, content string) (string, error) {
+	var err error
+	for ; i >= 0; i-- {
+		content, err = c.active[i].InterceptResponse(c.ex, content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// Flush collects held-back content from every interceptor. Content flushed
+// by one interceptor still passes through the interceptors after it.
+func (c *interceptorChain) Flush() (string, error) {
+	var out string
+	for i := len(c.active) - 1; i >= 0; i-- {
+		tail, err := c.active[i].Flush(c.ex)
+		if err != nil {
+			return "", err
+		}
+		if tail == "" {
+			continue
+		}
+		tail, err = c.responseFrom(i-1, tail)
+		if err != nil {
+			return "", err
+		}
+		out += tail
+	}
+	return out, nil
+}
+
+// Complete notifies every CompletionObserver of the outcome
+func (c *interceptorChain) Complete(outcome Outcome) {
+	outcome.DurationMs = time.Since(c.ex.Started).Milliseconds()
+	recordAccess(c.ex.ctx, c.ex.Model, outcome.Usage)
+	for _, ic := range c.active {
+		if observer, ok := ic.(CompletionObserver); ok {
+			observer.Complete(c.ex, outcome)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultKeepAlive is how long Ollama keeps a model loaded after a request
+const defaultKeepAlive = 5 * time.Minute
+
+// keepAlive is Ollama's keep_alive field: a duration string ("5m"), a
+// number of seconds, or a negative value for "forever"
+type keepAlive struct {
+	time.Duration
+}
+
+func (k *keepAlive) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		k.Duration = time.Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid keep_alive: %s", data)
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		k.Duration = time.Duration(n * float64(time.Second))
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid keep_alive: %w", err)
+	}
+	k.Duration = d
+	return nil
+}
+
+// keepAliveDuration returns the requested keep-alive or Ollama's default
+func keepAliveDuration(k *keepAlive) time.Duration {
+	if k == nil {
+		return defaultKeepAlive
+	}
+	return k.Duration
+}
+
+// loadedModel is a model the proxy reports as loaded in /api/ps
+type loadedModel struct {
+	Name      string
+	FullName  string
+	ExpiresAt time.Time
+}
+
+// modelTracker emulates Ollama's loaded-model bookkeeping. Nothing is
+// actually loaded; clients such as Home Assistant just expect models they
+// use to show up in /api/ps until their keep_alive expires.
+type modelTracker struct {
+	mu     sync.Mutex
+	models map[string]loadedModel
+}
+
+func newModelTracker() *modelTracker {
+	return &modelTracker{models: make(map[string]loadedModel)}
+}
+
+// Touch marks a model as used now. A zero keep-alive unloads it, a negative
+// one keeps it loaded forever.
+func (t *modelTracker) Touch(name, fullName string, keepAlive time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if keepAlive == 0 {
+		delete(t.models, name)
+		return
+	}
+
+	expires := time.Now().Add(keepAlive)
+	if keepAlive < 0 {
+		// Ollama reports "forever" as a date far in the future
+		expires = time.Date(2318, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t.models[name] = loadedModel{Name: name, FullName: fullName, ExpiresAt: expires}
+}
+
+// List returns the models whose keep-alive has not expired yet
+func (t *modelTracker) List() []loadedModel {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	out := make([]loadedModel, 0, len(t.models))
+	for name, m := range t.models {
+		if now.After(m.ExpiresAt) {
+			delete(t.models, name)
+			continue
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// loadDoneReason is the done_reason of a request that only loads or, with a
+// zero keep_alive, unloads a model
+func loadDoneReason(k *keepAlive) string {
+	if k != nil && k.Duration == 0 {
+		return "unload"
+	}
+	return "load"
+}
+
+// handlePs serves /api/ps with the models used recently
+func (s *Server) handlePs(c *gin.Context) {
+	loaded := s.models.List()
+
+	// Details come from the cached model list; without it they stay empty
+	details := map[string]Model{}
+	if len(loaded) > 0 {
+		if list, err := s.provider.GetModels(); err == nil {
+			for _, m := range list {
+				details[m.fullName] = m
+			}
+		}
+	}
+
+	models := make([]map[string]interface{}, 0, len(loaded))
+	for _, m := range loaded {
+		info := details[m.FullName]
+		models = append(models, map[string]interface{}{
+			"name":       m.Name,
+			"model":      m.Name,
+			"size":       info.Size,
+			"digest":     modelDigest(m.FullName),
+			"expires_at": m.ExpiresAt.Format(time.RFC3339),
+			"size_vram":  0,
+			"details":    info.Details,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
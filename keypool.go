@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APIKey is an OpenRouter key in the key pool
+type APIKey struct {
+	Key string `json:"key"`
+	// Weight is the key's share of requests relative to the other keys
+	// (default 1), e.g. to match rate limits or credit pools
+	Weight int `json:"weight,omitempty"`
+}
+
+const (
+	// keyHealthWindow is the number of recent requests the error rate of a
+	// key is computed over
+	keyHealthWindow = 20
+	// keyHealthMinSamples is the number of requests needed before a key can
+	// be considered unhealthy
+	keyHealthMinSamples = 5
+	// keyMaxErrorRate is the error rate above which a key is taken out of
+	// rotation
+	keyMaxErrorRate = 0.5
+	// keyCooldown is how long an unhealthy key stays out of rotation
+	keyCooldown = time.Minute
+)
+
+// pooledKey is a key with its recent request outcomes
+type pooledKey struct {
+	key    string
+	weight int
+	// current is the key's smooth weighted round-robin counter
+	current       int
+	results       []bool // ring buffer of recent outcomes, true = error
+	next          int
+	disabledUntil time.Time
+}
+
+// errorRate returns the share of failed requests in the window
+func (k *pooledKey) errorRate() (float64, int) {
+	if len(k.results) == 0 {
+		return 0, 0
+	}
+	failures := 0
+	for _, failed := range k.results {
+		if failed {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(k.results)), len(k.results)
+}
+
+// record adds an outcome to the ring buffer
+func (k *pooledKey) record(failed bool) {
+	if len(k.results) < keyHealthWindow {
+		k.results = append(k.results, failed)
+		return
+	}
+	k.results[k.next] = failed
+	k.next = (k.next + 1) % keyHealthWindow
+}
+
+// keyPool spreads upstream requests over several keys by weight, fails over
+// to another key when one hits its limits and takes keys with a high error
+// rate out of rotation for a while
+type keyPool struct {
+	mu   sync.Mutex
+	keys []*pooledKey
+}
+
+// newKeyPool builds a pool from the primary key and any additional keys. It
+// returns nil when there is only a single key. Keys listed more than once
+// keep the weight of their last entry.
+func newKeyPool(primary string, extra []APIKey) *keyPool {
+	if len(extra) == 0 {
+		return nil
+	}
+
+	pool := &keyPool{}
+	byKey := map[string]*pooledKey{}
+	add := func(key string, weight int) {
+		if key == "" {
+			return
+		}
+		if weight <= 0 {
+			weight = 1
+		}
+		if k, ok := byKey[key]; ok {
+			k.weight = weight
+			return
+		}
+		k := &pooledKey{key: key, weight: weight}
+		byKey[key] = k
+		pool.keys = append(pool.keys, k)
+	}
+
+	add(primary, 1)
+	for _, k := range extra {
+		add(k.Key, k.Weight)
+	}
+	return pool
+}
+
+// Pick chooses the next healthy key in weighted round-robin order, so keys
+// take turns in proportion to their weights. If every key is cooling down,
+// the one that recovers first is used.
+func (p *keyPool) Pick() *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.next(nil); k != nil {
+		return k
+	}
+	var soonest *pooledKey
+	for _, k := range p.keys {
+		if soonest == nil || k.disabledUntil.Before(soonest.disabledUntil) {
+			soonest = k
+		}
+	}
+	return soonest
+}
+
+// Failover takes a key that hit its rate or credit limit out of rotation
+// and returns another healthy key not in tried, or nil if there is none
+func (p *keyPool) Failover(failed *pooledKey, tried map[*pooledKey]bool) *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slog.Warn("API key hit its limits, failing over", "key", maskKey(failed.key), "cooldown", keyCooldown)
+	failed.disabledUntil = time.Now().Add(keyCooldown)
+	return p.next(tried)
+}
+
+// next runs smooth weighted round-robin over the healthy keys not in skip.
+// The caller must hold mu.
+func (p *keyPool) next(skip map[*pooledKey]bool) *pooledKey {
+	now := time.Now()
+	total := 0
+	var best *pooledKey
+	for _, k := range p.keys {
+		if now.Before(k.disabledUntil) || skip[k] {
+			continue
+		}
+		k.current += k.weight
+		total += k.weight
+		if best == nil || k.current > best.current {
+			best = k
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// Report records the outcome of a request made with k
+func (p *keyPool) Report(k *pooledKey, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k.record(failed)
+	rate, samples := k.errorRate()
+	if samples < keyHealthMinSamples || rate < keyMaxErrorRate || time.Now().Before(k.disabledUntil) {
+		return
+	}
+
+	slog.Warn("Taking unhealthy API key out of rotation",
+		"key", maskKey(k.key), "error_rate", rate, "cooldown", keyCooldown)
+	k.disabledUntil = time.Now().Add(keyCooldown)
+	// Start over after the cooldown so old failures don't disable it again
+	k.results = k.results[:0]
+	k.next = 0
+}
+
+// keyFailed reports whether an upstream answer counts against the key's
+// health: network errors, auth/credit problems, rate limits and server errors
+func keyFailed(resp *http.Response, err error) bool {
+	if err != nil {
+		// A client hanging up says nothing about the key
+		return !errors.Is(err, context.Canceled)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized,
+		resp.StatusCode == http.StatusPaymentRequired,
+		resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// keyExhausted reports whether an upstream status means the key itself is
+// out of requests or credits, so another key may succeed right away
+func keyExhausted(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusPaymentRequired
+}
+
+// maskKey shortens a key for logging
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "..." + key[len(key)-4:]
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LimitConfig caps the number of simultaneous upstream requests. Requests
+// over the cap wait in a FIFO queue.
+type LimitConfig struct {
+	// MaxConcurrent is the number of requests in flight; 0 disables the cap
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// MaxQueue bounds the waiting requests; more are rejected right away.
+	// 0 means no bound.
+	MaxQueue int `json:"max_queue,omitempty"`
+	// QueueTimeoutMs is how long a request may wait; 0 means no limit
+	QueueTimeoutMs int `json:"queue_timeout_ms,omitempty"`
+}
+
+// limitError rejects a request the limiter could not admit
+type limitError struct {
+	reason string
+}
+
+func (e *limitError) Error() string {
+	return "too many concurrent requests: " + e.reason
+}
+
+// requestLimiter admits at most a fixed number of requests at a time.
+// Blocked senders on a channel are woken in arrival order, which makes the
+// queue FIFO.
+type requestLimiter struct {
+	slots    chan struct{}
+	maxQueue int
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// newRequestLimiter returns nil when no cap is configured
+func newRequestLimiter(config LimitConfig) *requestLimiter {
+	if config.MaxConcurrent <= 0 {
+		return nil
+	}
+	return &requestLimiter{
+		slots:    make(chan struct{}, config.MaxConcurrent),
+		maxQueue: config.MaxQueue,
+		timeout:  time.Duration(config.QueueTimeoutMs) * time.Millisecond,
+	}
+}
+
+// Acquire waits for a slot and returns the function that frees it
+func (l *requestLimiter) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaser(), nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.maxQueue > 0 && l.waiting >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, &limitError{reason: "queue full"}
+	}
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaser(), nil
+	case <-timeout:
+		return nil, &limitError{reason: fmt.Sprintf("waited %s in queue", l.timeout)}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *requestLimiter) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.slots })
+	}
+}
+
+// releaseOnClose frees a limiter slot when the response body is closed, so
+// streamed answers hold their slot until they are done
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
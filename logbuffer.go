@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// recentLogSize is how many log lines are kept for the log viewer
+const recentLogSize = 1000
+
+// recentLogs keeps the latest log lines so the tray app can show them; when
+// launched as a desktop app, stderr goes nowhere
+var recentLogs = newLogBuffer(recentLogSize)
+
+// logBuffer is an io.Writer keeping the last lines written to it
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{lines: make([]string, size)}
+}
+
+// Write stores p, one entry per line. slog handlers write each record in a
+// single call.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+	return len(p), nil
+}
+
+// Lines returns the buffered lines, oldest first
+func (b *logBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	return append(append([]string(nil), b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// dumpToTempFile writes the buffered lines to a new temporary file and
+// returns its path
+func (b *logBuffer) dumpToTempFile() (string, error) {
+	f, err := os.CreateTemp("", "openrouter-proxy-*.log")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(strings.Join(b.Lines(), "\n") + "\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
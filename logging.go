@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Defaults for the rotating log file
+const (
+	defaultLogMaxSizeMB  = 10
+	defaultLogMaxBackups = 3
+)
+
+// LogConfig configures logging to a rotating file next to stderr
+type LogConfig struct {
+	// File is the path of the log file; empty disables file logging
+	File string `json:"file,omitempty"`
+	// MaxSizeMB is the size at which the file is rotated, 10 by default
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// MaxBackups is how many rotated files are kept, 3 by default
+	MaxBackups int `json:"max_backups,omitempty"`
+	// Level is "debug", "info", "warn" or "error"; "info" by default
+	Level string `json:"level,omitempty"`
+}
+
+// level returns the configured slog level
+func (c LogConfig) level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(c.Level))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// setupLogging sends log records to stderr, the tray's log viewer and, when
+// configured, a rotating log file
+func setupLogging(cfg LogConfig) {
+	writers := []io.Writer{os.Stderr, recentLogs}
+	if cfg.File != "" {
+		maxSize := cfg.MaxSizeMB
+		if maxSize <= 0 {
+			maxSize = defaultLogMaxSizeMB
+		}
+		maxBackups := cfg.MaxBackups
+		if maxBackups <= 0 {
+			maxBackups = defaultLogMaxBackups
+		}
+		writers = append(writers, &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+		})
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.MultiWriter(writers...), &slog.HandlerOptions{
+		Level: cfg.level(),
+	})))
+}
@@ -1,40 +1,162 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 )
 
 func main() {
-	// Set up logging
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})))
+	// Portable mode keeps the configuration next to the executable
+	args, portableErr := setupPortable(os.Args)
 
-	// Check if API key is provided as command-line argument
-	if len(os.Args) > 1 {
-		apiKey := os.Args[1]
-		err := SetAPIKey(apiKey)
+	// Flags and environment variables override config.json
+	args, flagErr := parseOverrideFlags(args)
+
+	// Set up logging; a broken config is reported once logging works
+	config, configErr := LoadConfig()
+	overrideErr := effectiveConfig(&config)
+	setupLogging(config.Log)
+	if configErr != nil {
+		slog.Error("Failed to load config", "error", configErr)
+	}
+	if err := errors.Join(portableErr, flagErr, overrideErr); err != nil {
+		slog.Error("Invalid settings", "error", err)
+		os.Exit(1)
+	}
+	warnUnknownOverrides()
+	if err := setupOutbound(config.Outbound); err != nil {
+		slog.Error("Failed to set up outbound connections", "error", err)
+	}
+
+	// Configuration bundle commands
+	if len(args) == 3 && (args[1] == "export" || args[1] == "import") {
+		if err := runBundleCommand(args[1], args[2]); err != nil {
+			slog.Error("Command failed", "command", args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Backend API key: set-key <backend> <key>
+	if len(args) == 4 && args[1] == "set-key" {
+		if err := SetBackendAPIKey(args[2], args[3]); err != nil {
+			slog.Error("Failed to save API key", "backend", args[2], "error", err)
+			os.Exit(1)
+		}
+		slog.Info("API key saved successfully", "backend", args[2])
+		return
+	}
+
+	// Profile API key: set-profile-key <profile> <key>
+	if len(args) == 4 && args[1] == "set-profile-key" {
+		if err := SetProfileAPIKey(args[2], args[3]); err != nil {
+			slog.Error("Failed to save API key", "profile", args[2], "error", err)
+			os.Exit(1)
+		}
+		slog.Info("API key saved successfully", "profile", args[2])
+		return
+	}
+
+	// Client key: add-client <name>
+	if len(args) == 3 && args[1] == "add-client" {
+		token, err := addClientKey(args[2])
 		if err != nil {
-			slog.Error("Failed to save API key", "error", err)
-			return
+			slog.Error("Failed to add client", "client", args[2], "error", err)
+			os.Exit(1)
+		}
+		fmt.Println(token)
+		return
+	}
+
+	// Background service: install-service or uninstall-service
+	if len(args) == 2 && (args[1] == "install-service" || args[1] == "uninstall-service") {
+		if err := runServiceCommand(args[1]); err != nil {
+			slog.Error("Command failed", "command", args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Headless mode for servers and containers without a desktop, also
+	// used by the installed service
+	if isHeadlessCommand(args) {
+		run := runHeadless
+		if isService() {
+			run = runService
+		}
+		if err := run(); err != nil {
+			slog.Error("Server failed", "error", err)
+			os.Exit(1)
 		}
-		slog.Info("API key saved successfully")
 		return
 	}
 
-	// Check if API key is provided as environment variable
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey != "" {
+	// Check if API key is provided as command-line argument
+	if len(args) > 1 {
+		apiKey := args[1]
+		if !checkAPIKey(apiKey) {
+			os.Exit(1)
+		}
 		err := SetAPIKey(apiKey)
 		if err != nil {
 			slog.Error("Failed to save API key", "error", err)
-		} else {
-			slog.Info("API key saved from environment variable")
+			return
 		}
+		slog.Info("API key saved successfully")
+		return
 	}
 
-	// Create and run the application
+	// Create and run the application. Like headless mode it takes the API
+	// key from --api-key or the environment before the stored one.
 	app := NewApp()
 	app.Run()
 }
+
+// checkAPIKey verifies a key before it is saved and reports the result. It
+// returns false only if OpenRouter rejected the key; a key that can't be
+// checked is saved anyway.
+func checkAPIKey(apiKey string) bool {
+	err := VerifyAPIKey(apiKey)
+	switch {
+	case errors.Is(err, ErrInvalidAPIKey):
+		slog.Error("OpenRouter rejected the API key, not saving it")
+		return false
+	case err != nil:
+		slog.Warn("Could not verify API key", "error", err)
+	default:
+		slog.Info("API key verified with OpenRouter")
+	}
+	return true
+}
+
+// runBundleCommand exports the configuration bundle to path or imports it
+// from path
+func runBundleCommand(command, path string) error {
+	if command == "import" {
+		if _, err := ImportBundle(path); err != nil {
+			return err
+		}
+		slog.Info("Configuration imported", "from", path)
+		return nil
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := ExportBundle(file, config); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	slog.Info("Configuration exported", "to", path)
+	return nil
+}
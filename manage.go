@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleCopy serves /api/copy by creating a virtual model named destination
+// that points at the source model
+func (s *Server) handleCopy(c *gin.Context) {
+	var request struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Source == "" || request.Destination == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and destination are required"})
+		return
+	}
+
+	// Copying a virtual model copies its definition
+	vm, ok := s.virtual.Get(request.Source)
+	if !ok {
+		if _, err := s.provider.GetModels(); err != nil {
+			requestLogger(c).Error("Error getting models", "Error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		fullName, found := s.provider.FindModel(request.Source)
+		if !found {
+			fullName, found = s.provider.FindModel(strings.TrimSuffix(request.Source, ":latest"))
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "model '" + request.Source + "' not found"})
+			return
+		}
+		vm = VirtualModel{From: fullName}
+	}
+
+	if err := s.virtual.Set(request.Destination, vm); err != nil {
+		requestLogger(c).Error("Error saving virtual model", "Error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleDelete serves /api/delete. Virtual models are deleted; OpenRouter
+// models are removed from the model filter so they no longer show up.
+func (s *Server) handleDelete(c *gin.Context) {
+	var request struct {
+		Model string `json:"model"`
+		Name  string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+	name := request.Model
+	if name == "" {
+		name = request.Name
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		return
+	}
+
+	deleted, err := s.virtual.Delete(name)
+	if err == nil && !deleted {
+		var models []Model
+		models, err = s.provider.GetModels()
+		if err == nil {
+			if fullName, ok := s.provider.FindModel(strings.TrimSuffix(name, ":latest")); ok {
+				deleted, err = s.removeFromFilter(fullName, models)
+			}
+		}
+	}
+	if err != nil {
+		requestLogger(c).Error("Error deleting model", "Error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model '" + name + "' not found"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// defaultModelCacheTTL is how long the model list is reused when the
+// configuration doesn't say
+const defaultModelCacheTTL = 5 * time.Minute
+
+// modelCacheTTL returns how long the model list is cached for the configured
+// seconds: 0 is the default and negative fetches it on every request
+func modelCacheTTL(seconds int) time.Duration {
+	if seconds == 0 {
+		return defaultModelCacheTTL
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetModels returns the cached model list while it is fresh, and fetches it
+// again once it is older than the cache TTL
+func (o *OpenrouterProvider) GetModels() ([]Model, error) {
+	o.mu.RLock()
+	models := o.models
+	fresh := time.Since(o.fetchedAt) < o.modelsTTL
+	o.mu.RUnlock()
+
+	if models != nil && fresh {
+		return models, nil
+	}
+	return o.RefreshModels()
+}
+
+// RefreshModels fetches the model list and caches it. If the API fails, the
+// last list fetched is served instead, stale but better than none.
+func (o *OpenrouterProvider) RefreshModels() ([]Model, error) {
+	models, err := o.fetchModels()
+	if err != nil {
+		o.mu.RLock()
+		stale := o.models
+		o.mu.RUnlock()
+		if stale == nil {
+			return nil, err
+		}
+		slog.Warn("Failed to refresh models, serving the cached list", "error", err)
+		return stale, nil
+	}
+
+	if models == nil {
+		models = []Model{}
+	}
+	o.mu.Lock()
+	o.models = models
+	o.fetchedAt = time.Now()
+	o.mu.Unlock()
+	return models, nil
+}
+
+// RefreshModels drops the cached model list of the running server and
+// fetches it again
+func (s *Server) RefreshModels() error {
+	gen := s.current.Load()
+	if gen == nil {
+		return errors.New("server is not running")
+	}
+	_, err := gen.provider.RefreshModels()
+	return err
+}
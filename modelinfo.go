@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// modelArchitectureInfo is the "architecture" object of OpenRouter's models
+// endpoint
+type modelArchitectureInfo struct {
+	Modality         string   `json:"modality"`
+	InputModalities  []string `json:"input_modalities"`
+	OutputModalities []string `json:"output_modalities"`
+	Tokenizer        string   `json:"tokenizer"`
+}
+
+// modelDigest returns a stable digest for a model ID. Clients use digests to
+// tell models apart, so they must not change between listings.
+func modelDigest(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// modelFamily returns the Ollama family of a model: its tokenizer, which
+// OpenRouter names after the model family ("Llama3", "Claude", "GPT", ...),
+// or else the vendor prefix of its ID
+func modelFamily(m openrouterModel) string {
+	if m.Architecture.Tokenizer != "" && m.Architecture.Tokenizer != "Other" {
+		return strings.ToLower(m.Architecture.Tokenizer)
+	}
+	if vendor, _, ok := strings.Cut(m.ID, "/"); ok {
+		return vendor
+	}
+	return ""
+}
+
+// parameterCountPattern finds sizes such as "70b", "8x7b" or "1.5b" in a
+// model ID
+var parameterCountPattern = regexp.MustCompile(`(?i)(?:^|[-_:/])(?:(\d+)x)?(\d+(?:\.\d+)?)b(?:$|[-_:.])`)
+
+// parameterCount estimates the number of parameters of a model from its ID.
+// It returns 0 when the ID doesn't say, as for most proprietary models.
+func parameterCount(id string) int64 {
+	match := parameterCountPattern.FindStringSubmatch(id)
+	if match == nil {
+		return 0
+	}
+	billions, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return 0
+	}
+	if match[1] != "" {
+		experts, _ := strconv.ParseFloat(match[1], 64)
+		billions *= experts
+	}
+	return int64(billions * 1e9)
+}
+
+// parameterSize formats a parameter count the way Ollama does, e.g. "70B"
+func parameterSize(count int64) string {
+	if count == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(count)/1e9, 'f', -1, 64) + "B"
+}
+
+// modelSize estimates the download size of a model as 4-bit weights, which
+// is what Ollama's default quantization would take
+func modelSize(count int64) int64 {
+	return count / 2
+}
+
+// modelModifiedAt returns the creation date of a model, or now if OpenRouter
+// doesn't report one
+func modelModifiedAt(m openrouterModel) string {
+	if m.Created == 0 {
+		return time.Now().Format(time.RFC3339)
+	}
+	return time.Unix(m.Created, 0).Format(time.RFC3339)
+}
+
+// modelDetails returns the Ollama details of a model
+func modelDetails(m openrouterModel) ModelDetails {
+	family := modelFamily(m)
+	var families []string
+	if family != "" {
+		families = []string{family}
+	}
+	return ModelDetails{
+		Format:        "gguf",
+		Family:        family,
+		Families:      families,
+		ParameterSize: parameterSize(parameterCount(m.ID)),
+	}
+}
+
+// modelCapabilities returns the Ollama capabilities of a model from its
+// modalities and supported parameters, which newer clients check to enable
+// tool calling, image input or thinking. Models without that metadata, such
+// as those of other backends, are assumed to chat and call tools.
+func modelCapabilities(m openrouterModel) []string {
+	if slices.Contains(m.Architecture.OutputModalities, "embeddings") {
+		return []string{"embedding"}
+	}
+	if m.SupportedParameters == nil && m.Architecture.InputModalities == nil {
+		return []string{"completion", "tools"}
+	}
+
+	capabilities := []string{"completion"}
+	if slices.Contains(m.SupportedParameters, "tools") {
+		capabilities = append(capabilities, "tools")
+	}
+	if slices.Contains(m.Architecture.InputModalities, "image") {
+		capabilities = append(capabilities, "vision")
+	}
+	if slices.Contains(m.SupportedParameters, "reasoning") || slices.Contains(m.SupportedParameters, "include_reasoning") {
+		capabilities = append(capabilities, "thinking")
+	}
+	return capabilities
+}
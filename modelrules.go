@@ -0,0 +1,58 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ModelRules filter the model list by OpenRouter pricing and metadata, on
+// top of the models-filter file. Unset rules are not applied.
+type ModelRules struct {
+	// MaxPromptPrice and MaxCompletionPrice are in USD per million tokens
+	MaxPromptPrice     *float64 `json:"max_prompt_price,omitempty"`
+	MaxCompletionPrice *float64 `json:"max_completion_price,omitempty"`
+	// MinContextLength is the smallest context window, in tokens
+	MinContextLength int `json:"min_context_length,omitempty"`
+	// FreeOnly keeps only models that cost nothing
+	FreeOnly bool `json:"free_only,omitempty"`
+	// Capabilities lists Ollama capabilities every model must have, e.g.
+	// ["vision"] or ["tools"]
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// pricePerMillion converts OpenRouter's per-token price to USD per million
+// tokens. Unknown prices read as 0.
+func pricePerMillion(price string) float64 {
+	p, _ := strconv.ParseFloat(price, 64)
+	return p * 1e6
+}
+
+// allows reports whether a model passes every rule. Models without metadata,
+// such as those of other backends, only pass when no rule needs it.
+func (r ModelRules) allows(m openrouterModel) bool {
+	prompt := pricePerMillion(m.Pricing.Prompt)
+	completion := pricePerMillion(m.Pricing.Completion)
+
+	if r.MaxPromptPrice != nil && prompt > *r.MaxPromptPrice {
+		return false
+	}
+	if r.MaxCompletionPrice != nil && completion > *r.MaxCompletionPrice {
+		return false
+	}
+	if r.MinContextLength > 0 && m.ContextLength < r.MinContextLength {
+		return false
+	}
+	if r.FreeOnly && !strings.HasSuffix(m.ID, ":free") && (m.Pricing.Prompt == "" || prompt != 0 || completion != 0) {
+		return false
+	}
+	if len(r.Capabilities) > 0 {
+		capabilities := modelCapabilities(m)
+		for _, c := range r.Capabilities {
+			if !slices.Contains(capabilities, c) {
+				return false
+			}
+		}
+	}
+	return true
+}
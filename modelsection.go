@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// ModelSection gathers the settings of one model under "models", keyed by
+// its full name, instead of spreading them over model_aliases,
+// model_profiles, fallbacks and sampling_clamps
+type ModelSection struct {
+	// Aliases are other names clients may use for the model
+	Aliases []string `json:"aliases,omitempty"`
+	// System, Options and Provider are the model's profile, as under
+	// model_profiles
+	ModelProfile
+	// Fallbacks are tried in order when the model fails
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// SamplingClamp limits the sampling parameters clients send
+	SamplingClamp *SamplingClamp `json:"sampling_clamp,omitempty"`
+}
+
+// hasProfile reports whether the section sets any profile setting
+func (m ModelSection) hasProfile() bool {
+	return m.System != "" || m.Options != nil || m.Provider != nil
+}
+
+// checkModelSections reports settings of the models section that contradict
+// the flat settings or each other
+func (c Config) checkModelSections() error {
+	names := slices.Collect(maps.Keys(c.Models))
+	sort.Strings(names)
+
+	aliasOf := map[string]string{}
+	for _, name := range names {
+		section := c.Models[name]
+		for _, alias := range section.Aliases {
+			if other, ok := aliasOf[alias]; ok {
+				return fmt.Errorf("models: alias %q is used by both %s and %s", alias, other, name)
+			}
+			if target, ok := c.ModelAliases[alias]; ok && target != name {
+				return fmt.Errorf("models.%s: alias %q already points to %s under model_aliases", name, alias, target)
+			}
+			aliasOf[alias] = name
+		}
+		if _, ok := c.ModelProfiles[name]; ok && section.hasProfile() {
+			return fmt.Errorf("models.%s: profile is also set under model_profiles", name)
+		}
+		if _, ok := c.Fallbacks[name]; ok && len(section.Fallbacks) > 0 {
+			return fmt.Errorf("models.%s: fallbacks are also set under fallbacks", name)
+		}
+		if _, ok := c.SamplingClamps[name]; ok && section.SamplingClamp != nil {
+			return fmt.Errorf("models.%s: sampling_clamp is also set under sampling_clamps", name)
+		}
+	}
+	return nil
+}
+
+// applyModelSections merges the models section into the flat settings the
+// server reads. The maps are copied, since they may be shared with the
+// caller's config.
+func applyModelSections(config *Config) {
+	if len(config.Models) == 0 {
+		return
+	}
+	aliases := maps.Clone(config.ModelAliases)
+	profiles := maps.Clone(config.ModelProfiles)
+	fallbacks := maps.Clone(config.Fallbacks)
+	clamps := maps.Clone(config.SamplingClamps)
+	if aliases == nil {
+		aliases = map[string]string{}
+	}
+	if profiles == nil {
+		profiles = map[string]ModelProfile{}
+	}
+	if fallbacks == nil {
+		fallbacks = map[string][]string{}
+	}
+	if clamps == nil {
+		clamps = map[string]SamplingClamp{}
+	}
+
+	for name, section := range config.Models {
+		for _, alias := range section.Aliases {
+			aliases[alias] = name
+		}
+		if section.hasProfile() {
+			profiles[name] = section.ModelProfile
+		}
+		if len(section.Fallbacks) > 0 {
+			fallbacks[name] = section.Fallbacks
+		}
+		if section.SamplingClamp != nil {
+			clamps[name] = *section.SamplingClamp
+		}
+	}
+
+	config.ModelAliases = aliases
+	config.ModelProfiles = profiles
+	config.Fallbacks = fallbacks
+	config.SamplingClamps = clamps
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// testPrompt is sent by TestModel; it asks for an answer short enough to
+// be cheap and to fit a notification
+const testPrompt = "Reply with one short sentence to confirm you are working."
+
+// modelTestTimeout bounds a model test, including a slow first token
+const modelTestTimeout = time.Minute
+
+// ModelTestResult is the outcome of a successful model test
+type ModelTestResult struct {
+	Latency time.Duration
+	Answer  string
+}
+
+// localRequest sends a request to the server itself, as a client on this
+// machine would, with the first access token if authentication is on
+func (s *Server) localRequest(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.localURL(path), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.config.AccessTokens) > 0 {
+		req.Header.Set("Authorization", "Bearer "+s.config.AccessTokens[0])
+	}
+
+	// The certificate may be self-signed, and it is our own server anyway
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&payload) == nil && payload.Error != "" {
+			return nil, fmt.Errorf("%s (HTTP %d)", payload.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// ListedModels returns the names of the models the server lists to
+// clients, sorted
+func (s *Server) ListedModels() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelTestTimeout)
+	defer cancel()
+	resp, err := s.localRequest(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Models))
+	for _, model := range list.Models {
+		names = append(names, model.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// TestModel sends a tiny chat to a model through the server's own API, so
+// the key, filter, aliases and connection to OpenRouter are all exercised,
+// and returns how long the answer took
+func (s *Server) TestModel(model string) (ModelTestResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelTestTimeout)
+	defer cancel()
+
+	request := map[string]any{
+		"model":    model,
+		"messages": []map[string]string{{"role": "user", "content": testPrompt}},
+		"stream":   false,
+		"options":  map[string]any{"num_predict": 64},
+	}
+	started := time.Now()
+	resp, err := s.localRequest(ctx, http.MethodPost, "/api/chat", request)
+	if err != nil {
+		return ModelTestResult{}, err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return ModelTestResult{}, err
+	}
+	// An empty answer still proves the path works; reasoning models may
+	// spend the few tokens allowed on thinking
+	return ModelTestResult{Latency: time.Since(started), Answer: strings.TrimSpace(answer.Message.Content)}, nil
+}
+
+// snippet shortens text to at most limit characters on one line
+func snippet(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+	return text
+}
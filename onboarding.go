@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ncruces/zenity"
+	"github.com/skratchdot/open-golang/open"
+)
+
+// openrouterKeysURL is where OpenRouter API keys are created
+const openrouterKeysURL = "https://openrouter.ai/settings/keys"
+
+// runOnboarding walks a first-time user through getting an API key, picking
+// the port and the models to show, then starts the server. Cancelling any
+// step leaves the app in the tray as before.
+func (a *App) runOnboarding() {
+	const title = "Welcome to OpenRouter Proxy"
+
+	err := zenity.Question("OpenRouter Proxy serves OpenRouter models to Ollama clients. It needs an OpenRouter API key.\n\nDon't have one yet? Create it on the OpenRouter website, then paste it in the next step.",
+		zenity.Title(title),
+		zenity.OKLabel("Continue"),
+		zenity.ExtraButton("Create a Key"),
+		zenity.CancelLabel("Later"))
+	if errors.Is(err, zenity.ErrExtraButton) {
+		if err := open.Run(openrouterKeysURL); err != nil {
+			slog.Error("Failed to open browser", "error", err)
+		}
+	} else if err != nil {
+		return
+	}
+
+	a.showAPIKeyDialog()
+	apiKey, err := GetAPIKey()
+	if err != nil || apiKey == "" {
+		return
+	}
+
+	port, ok := askPort(title, a.config.listenPort())
+	if !ok {
+		return
+	}
+	a.serverMutex.Lock()
+	a.config.Port = port
+	if err := SaveConfig(a.config); err != nil {
+		slog.Error("Failed to save config", "error", err)
+	}
+	filterPath := a.config.modelFilterPath()
+	a.serverMutex.Unlock()
+
+	if err := chooseFilterModels(title, apiKey, filterPath); err != nil {
+		slog.Error("Failed to set up model filter", "error", err)
+	}
+
+	a.startServer()
+	zenity.Info("The proxy is running. Point your Ollama clients at http://localhost:"+strconv.Itoa(port)+".", zenity.Title(title))
+}
+
+// askPort asks for the port to listen on until a valid one is entered. It
+// returns false if the dialog was cancelled.
+func askPort(title string, current int) (int, bool) {
+	for {
+		text, err := zenity.Entry("Port to listen on (Ollama clients expect 11434):",
+			zenity.Title(title),
+			zenity.EntryText(strconv.Itoa(current)))
+		if err != nil {
+			return 0, false
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(text))
+		if err == nil && port > 0 && port <= 65535 {
+			return port, true
+		}
+		zenity.Error("Please enter a port between 1 and 65535.", zenity.Title(title))
+	}
+}
+
+// chooseFilterModels lets the user pick the models clients see and adds them
+// to the model filter file. Picking none keeps every model visible.
+func chooseFilterModels(title, apiKey, filterPath string) error {
+	models, err := NewOpenrouterProvider(apiKey, nil, nil, RetryConfig{}, TimeoutConfig{}, nil).GetModels()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.fullName)
+	}
+	sort.Strings(names)
+
+	picked, err := zenity.ListMultiple("Pick the models your clients should see, or none to show all of them:",
+		names,
+		zenity.Title(title),
+		zenity.OKLabel("Continue"))
+	if errors.Is(err, zenity.ErrCanceled) || len(picked) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	for _, name := range picked {
+		if _, err := file.WriteString(shortModelName(name) + "\n"); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+)
+
+// stopList accepts Ollama's stop option as either a string or an array.
+// Empty and repeated sequences are dropped; upstream rejects empty ones.
+type stopList []string
+
+func (s *stopList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*s = stopList{single}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*s = nil
+	for _, stop := range many {
+		if stop != "" && !slices.Contains(*s, stop) {
+			*s = append(*s, stop)
+		}
+	}
+	return nil
+}
+
+// ollamaOptions is the subset of Ollama's model options that maps onto
+// OpenAI or OpenRouter request parameters
+type ollamaOptions struct {
+	NumPredict       *int     `json:"num_predict,omitempty"`
+	Stop             stopList `json:"stop,omitempty"`
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	MinP             *float32 `json:"min_p,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+	RepeatPenalty    *float32 `json:"repeat_penalty,omitempty"`
+}
+
+// withDefaults returns o with the options it doesn't set taken from d.
+// Either may be nil.
+func (o *ollamaOptions) withDefaults(d *ollamaOptions) *ollamaOptions {
+	if d == nil {
+		return o
+	}
+	merged := *d
+	if o == nil {
+		return &merged
+	}
+
+	if o.NumPredict != nil {
+		merged.NumPredict = o.NumPredict
+	}
+	if len(o.Stop) > 0 {
+		merged.Stop = o.Stop
+	}
+	if o.Temperature != nil {
+		merged.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		merged.TopP = o.TopP
+	}
+	if o.TopK != nil {
+		merged.TopK = o.TopK
+	}
+	if o.MinP != nil {
+		merged.MinP = o.MinP
+	}
+	if o.Seed != nil {
+		merged.Seed = o.Seed
+	}
+	if o.PresencePenalty != nil {
+		merged.PresencePenalty = o.PresencePenalty
+	}
+	if o.FrequencyPenalty != nil {
+		merged.FrequencyPenalty = o.FrequencyPenalty
+	}
+	if o.RepeatPenalty != nil {
+		merged.RepeatPenalty = o.RepeatPenalty
+	}
+	return &merged
+}
+
+// openaiTemperature converts a temperature for go-openai, which drops zero
+// values from the request
+func openaiTemperature(t float32) float32 {
+	if t == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return t
+}
+
+// applyChat copies the options onto the exchange's chat completion request.
+// Options OpenAI has no parameter for are sent as OpenRouter body fields.
+func (o *ollamaOptions) applyChat(ex *Exchange) {
+	if o == nil {
+		return
+	}
+	req := ex.Request
+	// Ollama uses -1 (infinite) and -2 (fill context) as special values
+	if o.NumPredict != nil && *o.NumPredict > 0 {
+		req.MaxTokens = *o.NumPredict
+	}
+	if len(o.Stop) > 0 {
+		req.Stop = o.Stop
+	}
+	if o.Temperature != nil {
+		req.Temperature = openaiTemperature(*o.Temperature)
+	}
+	if o.TopP != nil {
+		req.TopP = *o.TopP
+	}
+	if o.Seed != nil {
+		req.Seed = o.Seed
+	}
+	if o.PresencePenalty != nil {
+		req.PresencePenalty = *o.PresencePenalty
+	}
+	if o.FrequencyPenalty != nil {
+		req.FrequencyPenalty = *o.FrequencyPenalty
+	}
+
+	if o.TopK != nil {
+		ex.setUpstreamField("top_k", *o.TopK)
+	}
+	if o.MinP != nil {
+		ex.setUpstreamField("min_p", *o.MinP)
+	}
+	if o.RepeatPenalty != nil {
+		ex.setUpstreamField("repetition_penalty", *o.RepeatPenalty)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// OutboundConfig configures how the proxy reaches OpenRouter and other
+// services, for networks that require an HTTP proxy or inspect TLS
+type OutboundConfig struct {
+	// ProxyURL is the HTTP(S) proxy for outgoing calls, e.g.
+	// "http://proxy.corp:3128". Empty uses HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY from the environment.
+	ProxyURL string `json:"proxy_url,omitempty"`
+	// CACertFiles are PEM files with root certificates trusted in addition
+	// to the system's, such as a TLS-inspecting firewall's
+	CACertFiles []string `json:"ca_cert_files,omitempty"`
+}
+
+// outboundTransport is the transport all outgoing calls start from; see
+// setupOutbound
+var outboundTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// setupOutbound applies the outbound configuration to outboundTransport. It
+// must run before any outgoing call is made.
+func setupOutbound(cfg OutboundConfig) error {
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxy.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", cfg.ProxyURL)
+		}
+		outboundTransport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if len(cfg.CACertFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range cfg.CACertFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("reading CA certificates: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in %s", file)
+			}
+		}
+		outboundTransport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return nil
+}
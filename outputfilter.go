@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// errOutputBlocked is returned when model output contains a banned word
+var errOutputBlocked = errors.New("response blocked by output filter")
+
+// bannedWordWindow is how much previously streamed text is kept so banned
+// words split across chunks are still caught
+const bannedWordWindow = 64
+
+// RegexReplacement rewrites model output matching Pattern
+type RegexReplacement struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// OutputFilterConfig describes post-processing applied to model output
+type OutputFilterConfig struct {
+	// Replacements are applied in order to all output
+	Replacements []RegexReplacement `json:"replacements,omitempty"`
+	// BannedWords abort the response when any of them appears (case-insensitive)
+	BannedWords []string `json:"banned_words,omitempty"`
+	// Disclaimer is appended to the end of every response
+	Disclaimer string `json:"disclaimer,omitempty"`
+}
+
+type compiledReplacement struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// outputFilter is the compiled form of OutputFilterConfig
+type outputFilter struct {
+	replacements []compiledReplacement
+	banned       *regexp.Regexp
+	disclaimer   string
+}
+
+// newOutputFilter compiles the output filter config. It returns nil when
+// no filtering is configured.
+func newOutputFilter(cfg OutputFilterConfig) (*outputFilter, error) {
+	if len(cfg.Replacements) == 0 && len(cfg.BannedWords) == 0 && cfg.Disclaimer == "" {
+		return nil, nil
+	}
+
+	f := &outputFilter{disclaimer: cfg.Disclaimer}
+	for _, r := range cfg.Replacements {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output filter pattern %q: %w", r.Pattern, err)
+		}
+		f.replacements = append(f.replacements, compiledReplacement{re: re, replacement: r.Replacement})
+	}
+
+	var quoted []string
+	for _, word := range cfg.BannedWords {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) > 0 {
+		f.banned = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	return f, nil
+}
+
+// Disclaimer returns the text appended to the end of every response
+func (f *outputFilter) Disclaimer() string {
+	if f.disclaimer == "" {
+		return ""
+	}
+	return "\n\n" + f.disclaimer
+}
+
+func (f *outputFilter) replace(text string) string {
+	for _, r := range f.replacements {
+		text = r.re.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
+
+// outputFilterInterceptor applies an outputFilter to a response piece by
+// piece. Replacements only match within a single streamed chunk; banned
+// words are checked across chunk boundaries.
+type outputFilterInterceptor struct {
+	filter *outputFilter
+	tail   string
+}
+
+func newOutputFilterInterceptor(s *Server) Interceptor {
+	if s.output == nil {
+		return nil
+	}
+	return &outputFilterInterceptor{filter: s.output}
+}
+
+func (o *outputFilterInterceptor) InterceptRequest(ex *Exchange) error {
+	return nil
+}
+
+func (o *outputFilterInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	content = o.filter.replace(content)
+	if o.filter.banned != nil {
+		window := o.tail + content
+		if o.filter.banned.MatchString(window) {
+			return "", errOutputBlocked
+		}
+		if len(window) > bannedWordWindow {
+			window = window[len(window)-bannedWordWindow:]
+		}
+		o.tail = window
+	}
+	return content, nil
+}
+
+func (o *outputFilterInterceptor) Flush(ex *Exchange) (string, error) {
+	return o.filter.Disclaimer(), nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Every setting of config.json can be overridden without editing the file,
+// which is how containers are usually configured. A setting is named by its
+// JSON path joined with underscores, e.g. "port", "log_level" or
+// "rate_limit_requests_per_minute", and is overridden by the environment
+// variable OLLAMA_PROXY_LOG_LEVEL or the flag --log-level. Flags win over
+// the environment, which wins over the file. Overrides apply to the running
+// server only and are never saved to config.json.
+
+// overrideEnvPrefix starts the environment variables overriding settings
+const overrideEnvPrefix = "OLLAMA_PROXY_"
+
+// overrideAliases are short names for settings often overridden
+var overrideAliases = map[string]string{
+	"filter":  "last_used_model_filter",
+	"profile": "active_profile",
+}
+
+// apiKeyOverride names the override for the OpenRouter key, which is not
+// part of the config: OLLAMA_PROXY_API_KEY or --api-key
+const apiKeyOverride = "api_key"
+
+// flagOverrides holds the overrides given as flags, by setting name
+var flagOverrides = map[string]string{}
+
+// configSetting is a setting of Config that can be overridden
+type configSetting struct {
+	index []int
+	typ   reflect.Type
+}
+
+// configSettings returns the settings of Config by name. Nested structs are
+// flattened; everything else, including maps and lists, is one setting.
+func configSettings() map[string]configSetting {
+	settings := map[string]configSetting{}
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" || !field.IsExported() {
+				continue
+			}
+			name = prefix + name
+			fieldIndex := append(append([]int{}, index...), i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type, name+"_", fieldIndex)
+				continue
+			}
+			settings[name] = configSetting{index: fieldIndex, typ: field.Type}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "", nil)
+	for alias, name := range overrideAliases {
+		settings[alias] = settings[name]
+	}
+	return settings
+}
+
+// overrideEnvName returns the environment variable overriding a setting
+func overrideEnvName(name string) string {
+	return overrideEnvPrefix + strings.ToUpper(name)
+}
+
+// overrideValue returns the override of a setting, from a flag or the
+// environment
+func overrideValue(name string) (string, bool) {
+	if value, ok := flagOverrides[name]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(overrideEnvName(name)); ok {
+		return value, true
+	}
+	for alias, aliased := range overrideAliases {
+		if aliased == name {
+			if value, ok := os.LookupEnv(overrideEnvName(alias)); ok {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseOverrideFlags takes the override flags out of args and returns the
+// remaining arguments. Flags are given as --name=value or --name value;
+// boolean settings may leave out the value. Other flags are left alone.
+func parseOverrideFlags(args []string) ([]string, error) {
+	settings := configSettings()
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		name := strings.ReplaceAll(flag, "-", "_")
+		setting, known := settings[name]
+		if !strings.HasPrefix(arg, "--") || (!known && name != apiKeyOverride) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			switch {
+			case i+1 < len(args) && !strings.HasPrefix(args[i+1], "--"):
+				i++
+				value = args[i]
+			case known && setting.typ.Kind() == reflect.Bool:
+				value = "true"
+			default:
+				return nil, fmt.Errorf("flag --%s needs a value", flag)
+			}
+		}
+		if overrideAliases[name] != "" {
+			name = overrideAliases[name]
+		}
+		flagOverrides[name] = value
+	}
+	return rest, nil
+}
+
+// applyOverrides applies the overrides from flags and the environment to
+// config. Settings with invalid values are left as they are and reported
+// in the returned error.
+func applyOverrides(config *Config) error {
+	settings := configSettings()
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		if overrideAliases[name] == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	target := reflect.ValueOf(config).Elem()
+	for _, name := range names {
+		value, ok := overrideValue(name)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(target.FieldByIndex(settings[name].index), value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setConfigValue sets a setting from its text. Lists of strings are comma
+// separated; maps and other lists are given as JSON.
+func setConfigValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items).Convert(field.Type()))
+			return nil
+		}
+		fallthrough
+	default:
+		decoded := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+			return err
+		}
+		field.Set(decoded.Elem())
+	}
+	return nil
+}
+
+// warnUnknownOverrides reports environment variables with the override
+// prefix that don't name a setting, which are usually typos
+func warnUnknownOverrides() {
+	settings := configSettings()
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, overrideEnvPrefix) {
+			continue
+		}
+		setting := strings.ToLower(strings.TrimPrefix(name, overrideEnvPrefix))
+		if _, ok := settings[setting]; !ok && setting != apiKeyOverride {
+			slog.Warn("Unknown setting in environment, ignoring", "variable", name)
+		}
+	}
+}
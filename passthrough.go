@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// handleOpenAIModels serves /v1/models in the OpenAI format, with the model
+// filter and rules applied
+func (s *Server) handleOpenAIModels(c *gin.Context) {
+	models, err := s.provider.listModels(c.Request.Context())
+	if err != nil {
+		requestLogger(c).Error("Error getting models", "Error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+
+	data := make([]gin.H, 0, len(models))
+	for _, m := range models {
+		if !s.allowedByFilter(m.ID) || !s.config.ModelRules.allows(m) {
+			continue
+		}
+		owner, _, _ := strings.Cut(m.ID, "/")
+		data = append(data, gin.H{
+			"id":             m.ID,
+			"object":         "model",
+			"created":        m.Created,
+			"owned_by":       owner,
+			"context_length": m.ContextLength,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// handleOpenAIPassthrough forwards an OpenAI-style request under /v1 to the
+// same OpenRouter endpoint and relays the answer, streamed or not, as is.
+// Short model names are resolved like on the Ollama endpoints. Only the
+// accounting interceptors run: budgets and client quotas are enforced and
+// usage is recorded, but secret detection, PII masking and the other
+// content interceptors only apply to the Ollama endpoints.
+func (s *Server) handleOpenAIPassthrough(c *gin.Context) {
+	log := requestLogger(c)
+
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "Invalid JSON payload"}})
+		return
+	}
+
+	var model string
+	if err := json.Unmarshal(body["model"], &model); err != nil || model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "model is required"}})
+		return
+	}
+	fullModelName, err := s.resolveModel(model)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	body["model"], _ = json.Marshal(fullModelName)
+
+	// Streams only report usage when asked to
+	var stream bool
+	json.Unmarshal(body["stream"], &stream)
+	if _, ok := body["stream_options"]; stream && !ok {
+		body["stream_options"] = json.RawMessage(`{"include_usage":true}`)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+
+	ex := s.newExchange(c, model, &openai.ChatCompletionRequest{Model: fullModelName, Stream: stream})
+	chain := s.newAccountingChain(ex)
+	if err := chain.Request(); err != nil {
+		log.Warn("Request rejected by interceptor", "Error", err)
+		chain.Complete(Outcome{Status: OutcomeRejected, Error: err.Error()})
+		c.JSON(rejectionStatus(err), gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+
+	ctx := withUpstreamHeader(c.Request.Context(), ex.UpstreamHeader)
+	path := strings.TrimPrefix(c.Request.URL.Path, "/v1/")
+	resp, err := s.provider.Do(ctx, http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		log.Error("Upstream request failed", "Error", err)
+		chain.Complete(failedOutcome(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, name := range []string{"Content-Type", "Cache-Control"} {
+		if v := resp.Header.Get(name); v != "" {
+			c.Header(name, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	// Copy in small steps and flush each one so streamed answers aren't
+	// held back
+	usage := &relayedUsage{stream: stream}
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			usage.Write(buf[:n])
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				chain.Complete(Outcome{Status: OutcomeError, Error: errClientDisconnected, Usage: usage.Usage()})
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			switch {
+			case err != io.EOF:
+				log.Error("Error relaying upstream response", "Error", err)
+				chain.Complete(Outcome{Status: OutcomeError, Error: err.Error(), Usage: usage.Usage()})
+			case resp.StatusCode != http.StatusOK:
+				chain.Complete(Outcome{Status: OutcomeError, Error: fmt.Sprintf("HTTP %d", resp.StatusCode), UpstreamStatus: resp.StatusCode})
+			default:
+				chain.Complete(Outcome{Status: OutcomeSuccess, Usage: usage.Usage()})
+			}
+			return
+		}
+	}
+}
+
+// maxRelayedAnswer bounds the non-streamed answers relayedUsage reads the
+// usage from; larger ones are relayed without it
+const maxRelayedAnswer = 8 << 20
+
+// relayedUsage picks the token usage out of an upstream answer as it is
+// relayed: from the body of a plain answer, or from the stream event that
+// reports it
+type relayedUsage struct {
+	stream   bool
+	pending  []byte
+	overflow bool
+	usage    openai.Usage
+}
+
+// Write takes the next piece of the answer
+func (r *relayedUsage) Write(p []byte) {
+	if r.overflow {
+		return
+	}
+	r.pending = append(r.pending, p...)
+	if !r.stream {
+		if len(r.pending) > maxRelayedAnswer {
+			r.overflow, r.pending = true, nil
+		}
+		return
+	}
+	for {
+		i := bytes.IndexByte(r.pending, '\n')
+		if i < 0 {
+			return
+		}
+		r.parse(bytes.TrimPrefix(bytes.TrimSpace(r.pending[:i]), []byte("data:")))
+		r.pending = r.pending[i+1:]
+	}
+}
+
+// parse keeps the usage reported in a JSON document, if any
+func (r *relayedUsage) parse(data []byte) {
+	if !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+	var answer struct {
+		Usage *openai.Usage `json:"usage"`
+	}
+	if json.Unmarshal(data, &answer) == nil && answer.Usage != nil {
+		r.usage = *answer.Usage
+	}
+}
+
+// Usage returns the usage reported so far
+func (r *relayedUsage) Usage() openai.Usage {
+	if !r.stream && !r.overflow {
+		r.parse(r.pending)
+	}
+	return r.usage
+}
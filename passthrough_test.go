@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestPassthroughRecordsUsage(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		if req.Stream {
+			streamChunks(w, contentChunk("Hi"), finishChunk(openai.FinishReasonStop))
+			return
+		}
+		answerChat(w, req, "Hi")
+	})
+	s := newTestServer(t, upstream, DefaultConfig())
+
+	for _, stream := range []bool{false, true} {
+		w := serve(t, s, http.MethodPost, "/v1/chat/completions", map[string]any{
+			"model":    "gpt-4o",
+			"stream":   stream,
+			"messages": []map[string]string{{"role": "user", "content": "Hello"}},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("stream %v: status %d: %s", stream, w.Code, w.Body.String())
+		}
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("upstream got %d requests, want 2", len(requests))
+	}
+	if opts := requests[1].StreamOptions; opts == nil || !opts.IncludeUsage {
+		t.Errorf("streamed request stream_options = %+v, want usage included", opts)
+	}
+
+	report := s.usage.Report()
+	if len(report) != 1 || report[0].Model != "gpt-4o" {
+		t.Fatalf("usage report = %+v, want gpt-4o only", report)
+	}
+	if got := report[0].usageTotals; got.Requests != 2 || got.PromptTokens != 24 || got.CompletionTokens != 10 || got.Cost <= 0 {
+		t.Errorf("usage = %+v, want 2 requests with 24 prompt and 10 completion tokens and a cost", got)
+	}
+}
+
+func TestPassthroughBudget(t *testing.T) {
+	upstream := newStubUpstream(t, func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		answerChat(w, req, "Hi")
+	})
+	config := DefaultConfig()
+	config.Budget.DailyUSD = 0.00001
+	s := newTestServer(t, upstream, config)
+
+	request := map[string]any{
+		"model":    "gpt-4o",
+		"messages": []map[string]string{{"role": "user", "content": "Hello"}},
+	}
+	if w := serve(t, s, http.MethodPost, "/v1/chat/completions", request); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d: %s", w.Code, w.Body.String())
+	}
+	// The first answer cost more than the daily cap
+	w := serve(t, s, http.MethodPost, "/v1/chat/completions", request)
+	if w.Code != http.StatusPaymentRequired || !strings.Contains(w.Body.String(), "daily budget") {
+		t.Errorf("second request: status %d: %s, want 402 for the daily budget", w.Code, w.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Errorf("upstream got %d requests, want only the first", n)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxPlaceholderLen bounds how much streamed text is held back while waiting
+// for the rest of a placeholder that was split across chunks
+const maxPlaceholderLen = 24
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)|\d{2,4})[\s.\-]?\d{3,4}[\s.\-]?\d{3,4}\b`)
+)
+
+// piiMasker replaces personal data with placeholders before a request goes
+// upstream and puts the original values back into the response. A masker
+// holds the mapping for a single request and must not be shared.
+type piiMasker struct {
+	patterns     map[string]*regexp.Regexp
+	placeholders map[string]string // placeholder -> original
+	originals    map[string]string // original -> placeholder
+	counts       map[string]int
+	pending      string
+}
+
+// newPIIMasker creates a masker for emails, phone numbers and the given names
+func newPIIMasker(names []string) *piiMasker {
+	m := &piiMasker{
+		patterns: map[string]*regexp.Regexp{
+			"EMAIL": emailPattern,
+			"PHONE": phonePattern,
+		},
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counts:       make(map[string]int),
+	}
+
+	var quoted []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	if len(quoted) > 0 {
+		m.patterns["NAME"] = regexp.MustCompile(`\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	return m
+}
+
+// Mask replaces all detected personal data in text with placeholders
+func (m *piiMasker) Mask(text string) string {
+	// Order matters: emails contain things that look like phone numbers
+	for _, kind := range []string{"EMAIL", "PHONE", "NAME"} {
+		re, ok := m.patterns[kind]
+		if !ok {
+			continue
+		}
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			if placeholder, ok := m.originals[match]; ok {
+				return placeholder
+			}
+			m.counts[kind]++
+			placeholder := fmt.Sprintf("[%s_%d]", kind, m.counts[kind])
+			m.originals[match] = placeholder
+			m.placeholders[placeholder] = match
+			return placeholder
+		})
+	}
+	return text
+}
+
+// MaskMessages masks the text of every message in place
+func (m *piiMasker) MaskMessages(messages []openai.ChatCompletionMessage) {
+	for i := range messages {
+		messages[i].Content = m.Mask(messages[i].Content)
+		for j := range messages[i].MultiContent {
+			messages[i].MultiContent[j].Text = m.Mask(messages[i].MultiContent[j].Text)
+		}
+	}
+}
+
+// Restore replaces placeholders in a complete response with the original values
+func (m *piiMasker) Restore(text string) string {
+	for placeholder, original := range m.placeholders {
+		text = strings.ReplaceAll(text, placeholder, original)
+	}
+	return text
+}
+
+// RestoreChunk restores placeholders in a streamed chunk. A trailing partial
+// placeholder is held back until the next chunk (or Flush) completes it.
+func (m *piiMasker) RestoreChunk(chunk string) string {
+	text := m.pending + chunk
+	m.pending = ""
+
+	if idx := strings.LastIndex(text, "["); idx >= 0 && !strings.Contains(text[idx:], "]") && len(text)-idx < maxPlaceholderLen {
+		m.pending = text[idx:]
+		text = text[:idx]
+	}
+
+	return m.Restore(text)
+}
+
+// Flush returns any text still held back by RestoreChunk
+func (m *piiMasker) Flush() string {
+	text := m.Restore(m.pending)
+	m.pending = ""
+	return text
+}
+
+// piiInterceptor wires a per-request piiMasker into the interceptor chain
+type piiInterceptor struct {
+	masker *piiMasker
+}
+
+func newPIIInterceptor(s *Server) Interceptor {
+	if !s.config.PIIMasking {
+		return nil
+	}
+	return &piiInterceptor{masker: newPIIMasker(s.config.PIINames)}
+}
+
+func (p *piiInterceptor) InterceptRequest(ex *Exchange) error {
+	p.masker.MaskMessages(ex.Request.Messages)
+	return nil
+}
+
+func (p *piiInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return p.masker.RestoreChunk(content), nil
+}
+
+func (p *piiInterceptor) Flush(ex *Exchange) (string, error) {
+	return p.masker.Flush(), nil
+}
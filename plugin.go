@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WASM plugins implement request/response transforms in a sandbox. A plugin
+// module must export its memory and
+//
+//	alloc(size i32) -> ptr i32
+//
+// plus at least one of
+//
+//	transform_request(ptr i32, len i32) -> i64
+//	transform_response(ptr i32, len i32) -> i64
+//
+// Each transform receives a JSON document at ptr/len and returns the location
+// of its JSON answer packed as (ptr << 32 | len). Returning 0 leaves the input
+// unchanged. Answers may set "error" to reject the request or response.
+//
+// transform_request receives {"model": ..., "request": {...}} and may answer
+// with {"request": {...}}; transform_response receives {"model": ...,
+// "content": ...} and may answer with {"content": ...}.
+
+// pluginMessage is the JSON document exchanged with plugins
+type pluginMessage struct {
+	Model   string                        `json:"model,omitempty"`
+	Request *openai.ChatCompletionRequest `json:"request,omitempty"`
+	Content *string                       `json:"content,omitempty"`
+	Error   string                        `json:"error,omitempty"`
+}
+
+// pluginRuntime holds the compiled WASM plugins for a server
+type pluginRuntime struct {
+	runtime wazero.Runtime
+	modules []*wasmPlugin
+}
+
+// wasmPlugin is a single compiled plugin module
+type wasmPlugin struct {
+	name     string
+	compiled wazero.CompiledModule
+	runtime  wazero.Runtime
+}
+
+// loadPlugins compiles the given WASM files. It returns nil when no
+// plugins are configured.
+func loadPlugins(paths []string) (*pluginRuntime, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	pr := &pluginRuntime{runtime: r}
+	for _, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			r.Close(ctx)
+			return nil, fmt.Errorf("failed to read plugin %s: %w", path, err)
+		}
+
+		compiled, err := r.CompileModule(ctx, code)
+		if err != nil {
+			r.Close(ctx)
+			return nil, fmt.Errorf("failed to compile plugin %s: %w", path, err)
+		}
+
+		pr.modules = append(pr.modules, &wasmPlugin{
+			name:     filepath.Base(path),
+			compiled: compiled,
+			runtime:  r,
+		})
+	}
+
+	return pr, nil
+}
+
+// Close releases all compiled plugins
+func (pr *pluginRuntime) Close() {
+	pr.runtime.Close(context.Background())
+}
+
+// call runs one transform export with a fresh module instance so plugins
+// cannot keep state between calls
+func (p *wasmPlugin) call(export string, in pluginMessage) (*pluginMessage, error) {
+	ctx := context.Background()
+
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	defer mod.Close(ctx)
+
+	fn := mod.ExportedFunction(export)
+	if fn == nil {
+		return nil, nil
+	}
+	alloc := mod.ExportedFunction("alloc")
+	if alloc == nil {
+		return nil, fmt.Errorf("plugin %s does not export alloc", p.name)
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: alloc: %w", p.name, err)
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, data) {
+		return nil, fmt.Errorf("plugin %s: input out of memory range", p.name)
+	}
+
+	res, err = fn.Call(ctx, api.EncodeU32(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %s: %w", p.name, export, err)
+	}
+	if res[0] == 0 {
+		return nil, nil
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	out, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: output out of memory range", p.name)
+	}
+
+	var msg pluginMessage
+	if err := json.Unmarshal(out, &msg); err != nil {
+		return nil, fmt.Errorf("plugin %s returned invalid JSON: %w", p.name, err)
+	}
+	if msg.Error != "" {
+		return nil, errors.New(msg.Error)
+	}
+
+	return &msg, nil
+}
+
+// pluginInterceptor runs every loaded plugin as part of the interceptor chain
+type pluginInterceptor struct {
+	plugins []*wasmPlugin
+}
+
+func newPluginInterceptor(s *Server) Interceptor {
+	if s.plugins == nil {
+		return nil
+	}
+	return &pluginInterceptor{plugins: s.plugins.modules}
+}
+
+func (pi *pluginInterceptor) InterceptRequest(ex *Exchange) error {
+	for _, p := range pi.plugins {
+		msg, err := p.call("transform_request", pluginMessage{Model: ex.Model, Request: ex.Request})
+		if err != nil {
+			return err
+		}
+		if msg != nil && msg.Request != nil {
+			msg.Request.Stream = ex.Request.Stream
+			*ex.Request = *msg.Request
+		}
+	}
+	return nil
+}
+
+func (pi *pluginInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	for i := len(pi.plugins) - 1; i >= 0; i-- {
+		msg, err := pi.plugins[i].call("transform_response", pluginMessage{Model: ex.Model, Content: &content})
+		if err != nil {
+			return "", err
+		}
+		if msg != nil && msg.Content != nil {
+			content = *msg.Content
+		}
+	}
+	return content, nil
+}
+
+func (pi *pluginInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// portableFlag turns on portable mode, see setupPortable
+const portableFlag = "--portable"
+
+// portableDir is the directory of the executable in portable mode, which
+// holds the configuration instead of ~/.openrouter-proxy; "" otherwise
+var portableDir string
+
+// setupPortable turns on portable mode, for running from a USB stick or a
+// project directory, when args contain --portable or a config file lies
+// next to the executable. Everything kept in the config directory, the
+// encrypted key included, is then kept next to the executable and the OS
+// keyring is not used. It returns args without the flag.
+func setupPortable(args []string) ([]string, error) {
+	rest := slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == portableFlag })
+	requested := len(rest) != len(args)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return rest, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return rest, err
+	}
+	dir := filepath.Dir(exe)
+
+	found := slices.ContainsFunc(configFileNames, func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	})
+	if !requested && !found {
+		return rest, nil
+	}
+	portableDir = dir
+
+	// The config file is what marks the directory as portable next time
+	if !found {
+		if err := SaveConfig(DefaultConfig()); err != nil {
+			return rest, err
+		}
+	}
+	return rest, nil
+}
+
+// modelFilterPath returns the path of the model filter file. In portable
+// mode a relative path is relative to the executable rather than the
+// working directory.
+func (c Config) modelFilterPath() string {
+	if portableDir != "" && !filepath.IsAbs(c.LastUsedModelFilter) {
+		return filepath.Join(portableDir, c.LastUsedModelFilter)
+	}
+	return c.LastUsedModelFilter
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// wsaeaddrinuse is Windows' error for an address in use, which doesn't
+// match syscall.EADDRINUSE there
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// Owners of a port the proxy could not listen on, as far as they can be told
+const (
+	portOwnerOllama = "Ollama"
+	portOwnerProxy  = "another OpenRouter Proxy"
+)
+
+// portInUseError is returned by Server.Start when the port is taken, most
+// often by Ollama itself listening on its default port
+type portInUseError struct {
+	Port int
+	// Owner names what listens on the port, or is empty if unknown
+	Owner string
+}
+
+func (e *portInUseError) Error() string {
+	owner := "another program"
+	if e.Owner != "" {
+		owner = e.Owner
+	}
+	return fmt.Sprintf("port %d is already in use by %s; stop it or set another port", e.Port, owner)
+}
+
+// isAddrInUse reports whether err is the failure to listen on an address
+// that is already taken
+func isAddrInUse(err error) bool {
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == syscall.EADDRINUSE || errno == wsaeaddrinuse)
+}
+
+// portOwner tells what listens on a local port by asking it like an Ollama
+// client would. Both Ollama and the proxy answer; only the proxy sets a
+// request ID.
+func portOwner(port int) string {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	switch {
+	case !strings.Contains(string(body), "Ollama is running"):
+		return ""
+	case resp.Header.Get(requestIDHeader) != "":
+		return portOwnerProxy
+	default:
+		return portOwnerOllama
+	}
+}
+
+// freePort returns the first port after port that can be listened on, or 0
+// if none of the next few can
+func freePort(port int) int {
+	for candidate := port + 1; candidate <= min(port+20, 65535); candidate++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", candidate))
+		if err == nil {
+			listener.Close()
+			return candidate
+		}
+	}
+	return 0
+}
+
+// canQuitOllama reports whether quitOllama works on this platform. On Linux
+// Ollama usually runs as a system service, which needs root to stop.
+func canQuitOllama() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// quitOllama quits the Ollama desktop app so its port becomes free
+func quitOllama() error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", `quit app "Ollama"`)
+	case "windows":
+		cmd = exec.Command("taskkill", "/IM", "ollama app.exe", "/IM", "ollama.exe", "/F")
+	default:
+		return errors.New("quitting Ollama is not supported on " + runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+// ModelProfile holds defaults merged into every request for a model.
+// Anything the client or a virtual model sets wins.
+type ModelProfile struct {
+	// System is used as the system prompt when the request has none
+	System string `json:"system,omitempty"`
+	// Options are default Ollama options, e.g. temperature or num_predict
+	// for max_tokens
+	Options *ollamaOptions `json:"options,omitempty"`
+	// Provider is sent as OpenRouter's provider routing preferences, e.g.
+	// {"order": ["anthropic"], "allow_fallbacks": false}
+	Provider *ProviderPreferences `json:"provider,omitempty"`
+}
+
+// modelProfile returns the profile for a model, looked up by the name the
+// client used, the full model name or the name without the vendor prefix
+func (s *Server) modelProfile(model, fullName string) (ModelProfile, bool) {
+	for _, name := range []string{model, fullName, shortModelName(fullName)} {
+		if profile, ok := s.config.ModelProfiles[name]; ok {
+			return profile, true
+		}
+	}
+	return ModelProfile{}, false
+}
@@ -2,37 +2,151 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
+// Provider is an upstream that serves chat, completion and embedding
+// requests for a set of models
+type Provider interface {
+	Chat(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	ChatStream(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
+	Complete(ctx context.Context, req openai.CompletionRequest) (openai.CompletionResponse, error)
+	CompleteStream(ctx context.Context, req openai.CompletionRequest) (*openai.CompletionStream, error)
+	Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, openai.Usage, error)
+
+	GetModels() ([]Model, error)
+	RefreshModels() ([]Model, error)
+	GetModelDetails(modelName string) (map[string]interface{}, error)
+	GetFullModelName(alias string) (string, error)
+	FindModel(alias string) (string, bool)
+	ContextLength(fullName string, fallback int) int
+	Cost(fullName string, usage openai.Usage) float64
+
+	// Do and listModels give raw access to OpenRouter for the OpenAI
+	// compatible passthrough
+	Do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error)
+	listModels(ctx context.Context) ([]openrouterModel, error)
+	// preferModels sets how FindModel breaks ties between matching models
+	preferModels(prefer func(fullName string) bool)
+}
+
+// openrouterBaseURL is the OpenAI-compatible endpoint of OpenRouter; tests
+// point it at a stub
+var openrouterBaseURL = "https://openrouter.ai/api/v1/"
+
+// OpenrouterProvider talks to OpenRouter, or to any other OpenAI-compatible
+// API when used as a backend
 type OpenrouterProvider struct {
 	client     *openai.Client
-	modelNames []string // Shared storage for model names
+	httpClient *http.Client
+	apiKey     string
+	baseURL    string
+
+	mu         sync.RWMutex
+	modelNames []string                   // Shared storage for model names
+	metadata   map[string]openrouterModel // OpenRouter metadata by full model name
+	prefer     func(fullName string) bool // breaks ties in FindModel
+
+	// models caches the model list for modelsTTL after fetchedAt
+	models    []Model
+	fetchedAt time.Time
+	modelsTTL time.Duration
+}
+
+// openrouterModel is an entry of OpenRouter's models endpoint, which carries
+// more metadata than the OpenAI-compatible fields go-openai decodes
+type openrouterModel struct {
+	ID            string                `json:"id"`
+	Name          string                `json:"name"`
+	Created       int64                 `json:"created"`
+	ContextLength int                   `json:"context_length"`
+	Description   string                `json:"description"`
+	Architecture  modelArchitectureInfo `json:"architecture"`
+	// SupportedParameters lists the request parameters the model accepts,
+	// e.g. "tools" or "reasoning"
+	SupportedParameters []string `json:"supported_parameters"`
+	Pricing             struct {
+		Prompt     string `json:"prompt"`
+		Completion string `json:"completion"`
+	} `json:"pricing"`
 }
 
-func NewOpenrouterProvider(apiKey string) *OpenrouterProvider {
+func NewOpenrouterProvider(apiKey string, extraKeys []APIKey, headers map[string]string, retry RetryConfig, timeouts TimeoutConfig, limiter *requestLimiter) *OpenrouterProvider {
+	return newCompatibleProvider(openrouterBaseURL, apiKey, &upstreamTransport{
+		base:    upstreamBaseTransport(timeouts),
+		headers: headers,
+		keys:    newKeyPool(apiKey, extraKeys),
+		retry:   retry,
+		limiter: limiter,
+	})
+}
+
+// newCompatibleProvider creates a provider for the OpenAI-compatible API at
+// baseURL that sends its requests through transport
+func newCompatibleProvider(baseURL, apiKey string, transport *upstreamTransport) *OpenrouterProvider {
 	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = "https://openrouter.ai/api/v1/" // Custom endpoint if needed
+	config.BaseURL = baseURL
+	httpClient := &http.Client{Transport: transport}
+	config.HTTPClient = httpClient
 	return &OpenrouterProvider{
 		client:     openai.NewClientWithConfig(config),
+		httpClient: httpClient,
+		apiKey:     apiKey,
+		baseURL:    config.BaseURL,
 		modelNames: []string{},
+		metadata:   map[string]openrouterModel{},
 	}
 }
 
-func (o *OpenrouterProvider) Chat(messages []openai.ChatCompletionMessage, modelName string) (openai.ChatCompletionResponse, error) {
-	// Create a chat completion request
-	req := openai.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
-		Stream:   false,
+// Do sends a raw request to the API, path being relative to the
+// API base URL. It goes through the same transport as the OpenAI client.
+func (o *OpenrouterProvider) Do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, body)
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return o.httpClient.Do(req)
+}
+
+// listModels fetches the model list with OpenRouter's extended metadata
+func (o *OpenrouterProvider) listModels(ctx context.Context) ([]openrouterModel, error) {
+	resp, err := o.Do(ctx, http.MethodGet, "models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing models failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []openrouterModel `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Data, nil
+}
+
+func (o *OpenrouterProvider) Chat(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	req.Stream = false
 
 	// Call the OpenAI API to get a complete response
-	resp, err := o.client.CreateChatCompletion(context.Background(), req)
+	resp, err := o.client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		return openai.ChatCompletionResponse{}, err
 	}
@@ -41,16 +155,13 @@ func (o *OpenrouterProvider) Chat(messages []openai.ChatCompletionMessage, model
 	return resp, nil
 }
 
-func (o *OpenrouterProvider) ChatStream(messages []openai.ChatCompletionMessage, modelName string) (*openai.ChatCompletionStream, error) {
-	// Create a chat completion request
-	req := openai.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
-		Stream:   true,
-	}
+func (o *OpenrouterProvider) ChatStream(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
+	req.Stream = true
+	// Ask for a final usage chunk so streamed requests can be costed too
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
 	// Call the OpenAI API to get a streaming response
-	stream, err := o.client.CreateChatCompletionStream(context.Background(), req)
+	stream, err := o.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -75,95 +186,214 @@ type Model struct {
 	Size       int64        `json:"size,omitempty"`
 	Digest     string       `json:"digest,omitempty"`
 	Details    ModelDetails `json:"details,omitempty"`
-}
 
-func (o *OpenrouterProvider) GetModels() ([]Model, error) {
-	currentTime := time.Now().Format(time.RFC3339)
+	// fullName is the upstream model ID, including the vendor prefix
+	fullName string
+	// meta is the model's entry in the upstream model list
+	meta openrouterModel
+}
 
-	// Fetch models from the OpenAI API
-	modelsResponse, err := o.client.ListModels(context.Background())
+// fetchModels lists the models of the API and replaces the model names and
+// metadata lookups use
+func (o *OpenrouterProvider) fetchModels() ([]Model, error) {
+	// Fetch models from the OpenRouter API
+	apiModels, err := o.listModels(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	// Clear shared model storage
-	o.modelNames = []string{}
+	modelNames := []string{}
+	metadata := make(map[string]openrouterModel, len(apiModels))
 
 	var models []Model
-	for _, apiModel := range modelsResponse.Models {
+	for _, apiModel := range apiModels {
 		// Split model name
 		parts := strings.Split(apiModel.ID, "/")
 		name := parts[len(parts)-1]
 
 		// Store name in shared storage
-		o.modelNames = append(o.modelNames, apiModel.ID)
+		modelNames = append(modelNames, apiModel.ID)
+		metadata[apiModel.ID] = apiModel
 
 		// Create model struct
 		model := Model{
 			Name:       name,
 			Model:      name,
-			ModifiedAt: currentTime,
-			Size:       0, // Stubbed size
-			Digest:     name,
-			Details: ModelDetails{
-				ParentModel:       "",
-				Format:            "gguf",
-				Family:            "claude",
-				Families:          []string{"claude"},
-				ParameterSize:     "175B",
-				QuantizationLevel: "Q4_K_M",
-			},
+			ModifiedAt: modelModifiedAt(apiModel),
+			Size:       modelSize(parameterCount(apiModel.ID)),
+			Digest:     modelDigest(apiModel.ID),
+			fullName:   apiModel.ID,
+			meta:       apiModel,
+			Details:    modelDetails(apiModel),
 		}
 		models = append(models, model)
 	}
 
+	// Replace shared model storage
+	o.mu.Lock()
+	o.modelNames = modelNames
+	o.metadata = metadata
+	o.mu.Unlock()
+
 	return models, nil
 }
 
+// defaultContextLength is reported for models whose context length is unknown
+const defaultContextLength = 200000
+
+// modelArchitecture is reported as general.architecture for every model.
+// Clients look up "<architecture>.context_length" and friends, so it has
+// to be a plain identifier.
+const modelArchitecture = "llama"
+
 func (o *OpenrouterProvider) GetModelDetails(modelName string) (map[string]interface{}, error) {
-	// Stub response; replace with actual model details if available
-	currentTime := time.Now().Format(time.RFC3339)
+	fullName, err := o.GetFullModelName(modelName)
+	if err != nil {
+		return nil, err
+	}
+	contextLength := o.ContextLength(fullName, defaultContextLength)
+
+	o.mu.RLock()
+	m, ok := o.metadata[fullName]
+	o.mu.RUnlock()
+	if !ok {
+		m = openrouterModel{ID: fullName}
+	}
+
+	// Keys follow Ollama's GGUF metadata naming, which IDE integrations
+	// such as JetBrains AI Assistant read to size their prompts
+	modelInfo := map[string]interface{}{
+		"general.architecture":                      modelArchitecture,
+		"general.basename":                          modelName,
+		"general.file_type":                         15,
+		"general.quantization_version":              2,
+		modelArchitecture + ".context_length":       contextLength,
+		modelArchitecture + ".embedding_length":     8192,
+		modelArchitecture + ".block_count":          80,
+		modelArchitecture + ".attention.head_count": 64,
+	}
+	if m.Name != "" {
+		modelInfo["general.name"] = m.Name
+	}
+	if m.Description != "" {
+		modelInfo["general.description"] = m.Description
+	}
+	if params := parameterCount(fullName); params > 0 {
+		modelInfo["general.parameter_count"] = params
+	}
+
 	return map[string]interface{}{
-		"license":    "STUB License",
-		"system":     "STUB SYSTEM",
-		"modifiedAt": currentTime,
-		"details": map[string]interface{}{
-			"format":             "gguf",
-			"parameter_size":     "200B",
-			"quantization_level": "Q4_K_M",
-		},
-		"model_info": map[string]interface{}{
-			"architecture":    "STUB",
-			"context_length":  200000,
-			"parameter_count": 200_000_000_000,
-		},
+		"license":      "",
+		"system":       "",
+		"modelfile":    "FROM " + modelName,
+		"parameters":   "",
+		"template":     "{{ .Prompt }}",
+		"modified_at":  modelModifiedAt(m),
+		"details":      modelDetails(m),
+		"capabilities": modelCapabilities(m),
+		"model_info":   modelInfo,
 	}, nil
 }
 
 func (o *OpenrouterProvider) GetFullModelName(alias string) (string, error) {
 	// If modelNames is empty or not populated yet, try to get models first
-	if len(o.modelNames) == 0 {
+	o.mu.RLock()
+	empty := len(o.modelNames) == 0
+	o.mu.RUnlock()
+	if empty {
 		_, err := o.GetModels()
 		if err != nil {
 			return "", fmt.Errorf("failed to get models: %w", err)
 		}
 	}
 
-	// First try exact match
-	for _, fullName := range o.modelNames {
-		if fullName == alias {
-			return fullName, nil
+	if fullName, ok := o.FindModel(alias); ok {
+		return fullName, nil
+	}
+
+	// If no match found, just use the alias as is
+	// This allows direct use of model names that might not be in the list
+	return strings.TrimSuffix(alias, ":latest"), nil
+}
+
+// FindModel looks a model up in the last fetched model list. Names are
+// matched the way Ollama clients write them: without a ":latest" tag, in
+// any case, and without the vendor prefix ("gpt-4o" for "openai/gpt-4o").
+// When several models match equally well, one the preference function
+// accepts wins.
+func (o *OpenrouterProvider) FindModel(alias string) (string, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	alias = strings.TrimSuffix(alias, ":latest")
+	lower := strings.ToLower(alias)
+	// Matchers from the most to the least exact
+	matchers := []func(fullName string) bool{
+		func(fullName string) bool { return fullName == alias },
+		func(fullName string) bool { return strings.ToLower(fullName) == lower },
+		func(fullName string) bool { return strings.HasSuffix(fullName, "/"+alias) },
+		func(fullName string) bool { return strings.HasSuffix(strings.ToLower(fullName), "/"+lower) },
+		func(fullName string) bool { return strings.HasSuffix(fullName, alias) },
+	}
+	for _, match := range matchers {
+		var found []string
+		for _, fullName := range o.modelNames {
+			if match(fullName) {
+				found = append(found, fullName)
+			}
+		}
+		if len(found) > 0 {
+			return o.preferred(found), true
 		}
 	}
 
-	// Then try suffix match
-	for _, fullName := range o.modelNames {
-		if strings.HasSuffix(fullName, alias) {
-			return fullName, nil
+	return "", false
+}
+
+// preferred picks the first model the preference function accepts, or the
+// first model. The caller must hold mu.
+func (o *OpenrouterProvider) preferred(fullNames []string) string {
+	if o.prefer != nil {
+		for _, fullName := range fullNames {
+			if o.prefer(fullName) {
+				return fullName
+			}
 		}
 	}
+	return fullNames[0]
+}
 
-	// If no match found, just use the alias as is
-	// This allows direct use of model names that might not be in the list
-	return alias, nil
+// preferModels sets the function that breaks ties between models matching
+// a name, e.g. to favour the models the filter lets through
+func (o *OpenrouterProvider) preferModels(prefer func(fullName string) bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prefer = prefer
+}
+
+// ContextLength returns the context length of a model in tokens, or fallback
+// if it is not known
+func (o *OpenrouterProvider) ContextLength(fullName string, fallback int) int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if m, ok := o.metadata[fullName]; ok && m.ContextLength > 0 {
+		return m.ContextLength
+	}
+	return fallback
+}
+
+// Cost returns the price in USD of the given usage on a model, based on
+// OpenRouter's per-token pricing. Unknown models cost 0.
+func (o *OpenrouterProvider) Cost(fullName string, usage openai.Usage) float64 {
+	o.mu.RLock()
+	m, ok := o.metadata[fullName]
+	o.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	prompt, _ := strconv.ParseFloat(m.Pricing.Prompt, 64)
+	completion, _ := strconv.ParseFloat(m.Pricing.Completion, 64)
+	return float64(usage.PromptTokens)*prompt + float64(usage.CompletionTokens)*completion
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// JetBrains AI Assistant and similar IDE plugins call /api/show for the
+// model picked in the settings, older versions with "name" and newer ones
+// with "model", and size their prompts from the GGUF-style model_info: the
+// context length is read from "<general.architecture>.context_length".
+func TestShowModelInfoForIDEs(t *testing.T) {
+	s := newTestServer(t, newStubUpstream(t, nil), DefaultConfig())
+
+	tests := []struct {
+		request       map[string]string
+		contextLength float64
+		parameters    float64
+		parameterSize string
+	}{
+		{map[string]string{"name": "gpt-4o:latest"}, 128000, 0, ""},
+		{map[string]string{"model": "openai/gpt-4o"}, 128000, 0, ""},
+		{map[string]string{"model": "llama-3.1-70b-instruct:latest"}, 131072, 70e9, "70B"},
+	}
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodPost, "/api/show", tt.request)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /api/show %v: status %d: %s", tt.request, w.Code, w.Body.String())
+		}
+		body := decodeJSON(t, w)
+		info, ok := body["model_info"].(map[string]any)
+		if !ok {
+			t.Fatalf("POST /api/show %v: no model_info", tt.request)
+		}
+
+		architecture, _ := info["general.architecture"].(string)
+		if architecture == "" {
+			t.Fatalf("%v: general.architecture missing: %v", tt.request, info)
+		}
+		if got := info[architecture+".context_length"]; got != tt.contextLength {
+			t.Errorf("%v: %s.context_length = %v, want %v", tt.request, architecture, got, tt.contextLength)
+		}
+		for _, key := range []string{"general.basename", "general.file_type", "general.quantization_version", architecture + ".embedding_length", architecture + ".block_count", architecture + ".attention.head_count"} {
+			if _, ok := info[key]; !ok {
+				t.Errorf("%v: model_info lacks %s", tt.request, key)
+			}
+		}
+		if got, _ := info["general.parameter_count"].(float64); got != tt.parameters {
+			t.Errorf("%v: general.parameter_count = %v, want %v", tt.request, got, tt.parameters)
+		}
+
+		details := body["details"].(map[string]any)
+		if got, _ := details["parameter_size"].(string); got != tt.parameterSize {
+			t.Errorf("%v: details.parameter_size = %q, want %q", tt.request, got, tt.parameterSize)
+		}
+		for _, field := range []string{"modelfile", "template", "parameters", "modified_at"} {
+			if _, ok := body[field]; !ok {
+				t.Errorf("%v: response lacks %s", tt.request, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+// ProviderPreferences are OpenRouter's provider routing options, sent as the
+// "provider" field of a request
+type ProviderPreferences struct {
+	// Order lists provider names to try first, e.g. ["anthropic", "openai"]
+	Order []string `json:"order,omitempty"`
+	// AllowFallbacks lets OpenRouter use other providers when the ones in
+	// Order are unavailable; OpenRouter's default is true
+	AllowFallbacks *bool `json:"allow_fallbacks,omitempty"`
+	// Ignore lists providers that must never serve the request
+	Ignore []string `json:"ignore,omitempty"`
+	// Quantizations restricts providers to these quantization levels, e.g.
+	// ["fp8", "bf16"]
+	Quantizations []string `json:"quantizations,omitempty"`
+	// DataCollection is "deny" to exclude providers that may store or train
+	// on prompts, or "allow"
+	DataCollection string `json:"data_collection,omitempty"`
+}
+
+// validate rejects values OpenRouter would not accept
+func (p *ProviderPreferences) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.DataCollection {
+	case "", "allow", "deny":
+		return nil
+	}
+	return fmt.Errorf("provider.data_collection must be \"allow\" or \"deny\", not %q", p.DataCollection)
+}
+
+// isZero reports whether no preference is set
+func (p *ProviderPreferences) isZero() bool {
+	return p == nil || (len(p.Order) == 0 && p.AllowFallbacks == nil && len(p.Ignore) == 0 &&
+		len(p.Quantizations) == 0 && p.DataCollection == "")
+}
+
+// withDefaults returns p with the preferences it doesn't set taken from d.
+// Either may be nil.
+func (p *ProviderPreferences) withDefaults(d *ProviderPreferences) *ProviderPreferences {
+	if d == nil {
+		return p
+	}
+	merged := *d
+	if p == nil {
+		return &merged
+	}
+
+	if len(p.Order) > 0 {
+		merged.Order = p.Order
+	}
+	if p.AllowFallbacks != nil {
+		merged.AllowFallbacks = p.AllowFallbacks
+	}
+	if len(p.Ignore) > 0 {
+		merged.Ignore = p.Ignore
+	}
+	if len(p.Quantizations) > 0 {
+		merged.Quantizations = p.Quantizations
+	}
+	if p.DataCollection != "" {
+		merged.DataCollection = p.DataCollection
+	}
+	return &merged
+}
+
+// applyProviderPreferences sends the provider preferences of a request,
+// filled in from the model's profile and then the global configuration
+func (s *Server) applyProviderPreferences(ex *Exchange, requested *ProviderPreferences, profile ModelProfile) {
+	prefs := requested.withDefaults(profile.Provider).withDefaults(&s.config.Provider)
+	if !prefs.isZero() {
+		ex.setUpstreamField("provider", prefs)
+	}
+}
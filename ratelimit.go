@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitConfig limits how fast each client may send requests, with a
+// token bucket per client IP or access token
+type RateLimitConfig struct {
+	// RequestsPerMinute is the sustained rate; 0 disables rate limiting
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// Burst is how many requests may arrive at once; defaults to
+	// RequestsPerMinute
+	Burst int `json:"burst,omitempty"`
+	// By is "ip" (the default) or "token" to limit each access token
+	// separately, falling back to the IP for requests without one
+	By string `json:"by,omitempty"`
+}
+
+// rateBucketsPruneEvery is how many calls to Take pass between sweeps of
+// idle buckets
+const rateBucketsPruneEvery = 1000
+
+// rateBucketIdle is how long a bucket must be unused before a sweep drops it.
+// A dropped bucket comes back full, which only errs on the generous side.
+const rateBucketIdle = 10 * time.Minute
+
+// tokenBucket holds the tokens left for one key
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateBuckets is a set of token buckets keyed by client
+type rateBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	calls   int
+}
+
+func newRateBuckets() *rateBuckets {
+	return &rateBuckets{buckets: map[string]*tokenBucket{}}
+}
+
+// Take removes a token from the bucket of key, which holds up to burst tokens
+// and gains perMinute tokens a minute. If the bucket is empty it returns
+// false and how long until the next token.
+func (r *rateBuckets) Take(key string, perMinute, burst int) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.calls++
+	if r.calls%rateBucketsPruneEvery == 0 {
+		for k, b := range r.buckets {
+			if now.Sub(b.updated) > rateBucketIdle {
+				delete(r.buckets, k)
+			}
+		}
+	}
+
+	if burst <= 0 {
+		burst = perMinute
+	}
+	perSecond := float64(perMinute) / 60
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), updated: now}
+		r.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, rounded up to
+// whole seconds
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// rateLimitKey returns the bucket key of a request: its access token, hashed
+// so it isn't kept in memory as is, or its IP. Forwarding headers are
+// ignored since any client can set them.
+func rateLimitKey(r *http.Request, by string) string {
+	if by == "token" {
+		if token := clientToken(r); token != "" {
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimitMiddleware answers clients over the configured rate with 429 and
+// a Retry-After header
+func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := s.rateLimit()
+		if cfg.RequestsPerMinute <= 0 || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		if allowed, wait := s.rates.Take(rateLimitKey(c.Request, cfg.By), cfg.RequestsPerMinute, cfg.Burst); !allowed {
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// thinkOption is Ollama's "think" flag: a boolean, or an effort level
+// ("low", "medium", "high") for models that support one
+type thinkOption struct {
+	Enabled bool
+	Effort  string
+}
+
+func (t *thinkOption) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Enabled); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &t.Effort); err != nil {
+		return fmt.Errorf("think must be a boolean or an effort level")
+	}
+	t.Enabled = t.Effort != ""
+	return nil
+}
+
+// upstreamReasoning returns OpenRouter's "reasoning" request parameter for
+// the flag. Models can't always be stopped from reasoning, but its output
+// can be excluded.
+func (t *thinkOption) upstreamReasoning() map[string]interface{} {
+	switch {
+	case !t.Enabled:
+		return map[string]interface{}{"exclude": true}
+	case t.Effort != "":
+		return map[string]interface{}{"effort": t.Effort}
+	default:
+		return map[string]interface{}{"enabled": true}
+	}
+}
+
+type reasoningKey struct{}
+
+// reasoningCollector gathers the reasoning text OpenRouter returns next to
+// the content (as message.reasoning or delta.reasoning), which go-openai
+// does not decode. It watches the raw upstream response on its way to the
+// OpenAI client.
+type reasoningCollector struct {
+	mu   sync.Mutex
+	text strings.Builder
+}
+
+// withReasoningCollector makes the upstream transport report reasoning to rc
+func withReasoningCollector(ctx context.Context, rc *reasoningCollector) context.Context {
+	if rc == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, reasoningKey{}, rc)
+}
+
+// Take returns the reasoning collected so far and resets the collector. For
+// streams it is called after every received chunk and returns that chunk's
+// reasoning. A nil collector has none.
+func (rc *reasoningCollector) Take() string {
+	if rc == nil {
+		return ""
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	text := rc.text.String()
+	rc.text.Reset()
+	return text
+}
+
+func (rc *reasoningCollector) add(text string) {
+	if text == "" {
+		return
+	}
+	rc.mu.Lock()
+	rc.text.WriteString(text)
+	rc.mu.Unlock()
+}
+
+// watch hooks rc into an upstream response. Complete responses are read
+// right away; streams are wrapped so events are inspected as they are read.
+func (rc *reasoningCollector) watch(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &reasoningStreamReader{body: resp.Body, lines: bufio.NewReader(resp.Body), rc: rc}
+		return nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	var body struct {
+		Choices []struct {
+			Message struct {
+				Reasoning string `json:"reasoning"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(data, &body) == nil && len(body.Choices) > 0 {
+		rc.add(body.Choices[0].Message.Reasoning)
+	}
+	return nil
+}
+
+// reasoningStreamReader passes an SSE stream through one line per Read.
+// go-openai reads the stream with a bufio.Reader that only fills up when it
+// runs out of lines, so when it hands out a chunk, exactly the events up to
+// that chunk have been inspected and Take lines up with the chunk.
+type reasoningStreamReader struct {
+	body    io.ReadCloser
+	lines   *bufio.Reader
+	rc      *reasoningCollector
+	pending []byte
+	err     error
+}
+
+func (r *reasoningStreamReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.pending, r.err = r.lines.ReadBytes('\n')
+		r.inspect(r.pending)
+		if len(r.pending) == 0 {
+			return 0, r.err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *reasoningStreamReader) inspect(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Reasoning string `json:"reasoning"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &chunk) == nil && len(chunk.Choices) > 0 {
+		r.rc.add(chunk.Choices[0].Delta.Reasoning)
+	}
+}
+
+func (r *reasoningStreamReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RefusalRetryConfig retries refused or empty answers once on another model
+type RefusalRetryConfig struct {
+	// FallbackModel is the OpenRouter model used for the retry; retries are
+	// disabled when it is empty
+	FallbackModel string `json:"fallback_model,omitempty"`
+	// Patterns are phrases that mark an answer as a refusal (case
+	// insensitive). defaultRefusalPatterns is used when empty.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// defaultRefusalPatterns match the stock refusals of the major providers
+var defaultRefusalPatterns = []string{
+	"i can't help with that",
+	"i cannot help with that",
+	"i can't assist with that",
+	"i cannot assist with that",
+	"i'm not able to help with that",
+	"i am unable to provide",
+	"violates our content policy",
+	"against my content policy",
+}
+
+// maxRefusalLength bounds the answers checked against refusal patterns. Hard
+// refusals are short; longer answers that merely quote a phrase are not.
+const maxRefusalLength = 300
+
+// isRefusal reports whether an answer is empty, content-filtered or a
+// refusal matching one of the patterns
+func (cfg RefusalRetryConfig) isRefusal(content, finishReason string) bool {
+	if finishReason == string(openai.FinishReasonContentFilter) {
+		return true
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return true
+	}
+	if len(content) > maxRefusalLength {
+		return false
+	}
+
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = defaultRefusalPatterns
+	}
+	content = strings.ToLower(content)
+	for _, p := range patterns {
+		if strings.Contains(content, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayRetryRefusal reports whether a refused answer to the request would be
+// retried, i.e. a fallback model is set and has not been tried yet
+func (s *Server) mayRetryRefusal(ex *Exchange) bool {
+	cfg := s.config.RefusalRetry
+	return cfg.FallbackModel != "" && ex.Request.Model != cfg.FallbackModel
+}
+
+// retryRefusal switches the request to the fallback model if the answer was
+// a refusal and the fallback has not been tried yet. It returns true if the
+// request should be sent again.
+func (s *Server) retryRefusal(c *gin.Context, ex *Exchange, content, finishReason string) bool {
+	cfg := s.config.RefusalRetry
+	if !s.mayRetryRefusal(ex) || !cfg.isRefusal(content, finishReason) {
+		return false
+	}
+
+	requestLogger(c).Warn("Model refused, retrying with fallback model",
+		"model", ex.Request.Model, "fallback", cfg.FallbackModel, "finish_reason", finishReason)
+	ex.Request.Model = cfg.FallbackModel
+	return true
+}
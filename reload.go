@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// reloadReleaseDelay is how long a replaced generation is kept when
+// requests have no time limit
+const reloadReleaseDelay = time.Hour
+
+// Reload applies a new configuration without stopping the server. A new
+// generation of the server is set up for it, sharing usage, rate limits and
+// loaded models with the running one, and takes over new requests; those in
+// flight finish on the old one. The listen port and TLS settings only change
+// on restart. If the new configuration can't be set up, the running one
+// stays in place.
+func (s *Server) Reload(config Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.current.Load()
+	if current == nil {
+		return errors.New("server is not running")
+	}
+
+	next := NewServer(s.apiKey, config)
+	if next.config.listenPort() != s.config.listenPort() || next.config.TLS != s.config.TLS {
+		slog.Warn("Listen port and TLS changes take effect after a restart")
+	}
+	next.config.Port = s.config.Port
+	next.config.TLS = s.config.TLS
+
+	next.models = s.models
+	next.usage = s.usage
+	next.usageDB = s.usageDB
+	next.drain = s.drain
+	next.rates = s.rates
+	next.recent = s.recent
+	next.health = s.health
+	next.notices = s.notices
+	next.restarts = s.restarts
+	next.OnConfigChange = s.OnConfigChange
+	next.OnStateChange = s.OnStateChange
+	next.OnNotice = s.OnNotice
+	if err := next.setup(); err != nil {
+		return err
+	}
+	s.current.Store(next)
+
+	// Requests in flight may still use the old generation, so it is only
+	// released once the longest request would have timed out
+	wait := current.config.Timeouts.total(true)
+	if wait <= 0 {
+		wait = reloadReleaseDelay
+	}
+	time.AfterFunc(wait, current.release)
+
+	slog.Info("Configuration reloaded")
+	return nil
+}
+
+// running returns the generation of the server taking new requests, or nil
+// if the server isn't running
+func (s *Server) running() *Server {
+	return s.current.Load()
+}
+
+// release frees what a generation set up for its own configuration: its
+// plugins, transcript log, shadow requests and cache. Everything else is
+// shared between generations.
+func (s *Server) release() {
+	if s.plugins != nil {
+		s.plugins.Close()
+	}
+	if s.transcripts != nil {
+		s.transcripts.Close()
+	}
+	if s.shadow != nil {
+		s.shadow.Close()
+	}
+	if s.cache != nil {
+		s.cache.Close()
+	}
+}
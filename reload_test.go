@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReloadReleasesOldGeneration(t *testing.T) {
+	upstream := newStubUpstream(t, nil)
+	config := DefaultConfig()
+	config.Timeouts.StreamSeconds = 1
+	config.Transcripts = TranscriptConfig{Enabled: true, Dir: t.TempDir()}
+	config.Shadow = ShadowConfig{Model: "deepseek/deepseek-r1", File: t.TempDir() + "/shadow.jsonl"}
+	config.Cache = CacheConfig{Enabled: true}
+	s := newTestServer(t, upstream, config)
+
+	if err := s.Reload(config); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if s.running() == s {
+		t.Fatal("the reloaded generation isn't running")
+	}
+
+	// Released once the longest request would have timed out
+	deadline := time.Now().Add(5 * time.Second)
+	for !transcriptsClosed(s.transcripts) || s.shadow.ctx.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("old transcript and shadow logs still open")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if transcriptsClosed(s.running().transcripts) {
+		t.Error("the running generation's transcript log was closed")
+	}
+}
+
+func transcriptsClosed(t *transcriptLog) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// requestIDHeader carries the request ID in requests and responses
+	requestIDHeader = "X-Request-Id"
+	// maxRequestIDLen bounds client-supplied request IDs
+	maxRequestIDLen = 128
+
+	requestIDKey = "request_id"
+	loggerKey    = "logger"
+)
+
+// newRequestID returns a random 128-bit hex ID
+func newRequestID() string {
+	return randomHex(16)
+}
+
+// requestIDMiddleware assigns every request an ID, reusing the client's
+// X-Request-Id when present, echoes it in the response and attaches a
+// logger that includes it
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Set(loggerKey, slog.Default().With("request_id", id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestID returns the ID assigned to the current request
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// requestLogger returns the logger for the current request
+func requestLogger(c *gin.Context) *slog.Logger {
+	if logger, ok := c.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
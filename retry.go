@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryConfig controls how upstream calls that failed with a transient
+// error (429, 502, 503, 504) are retried
+type RetryConfig struct {
+	// MaxRetries is how often a call is retried; 0 disables retries
+	MaxRetries int `json:"max_retries"`
+	// InitialDelayMs is the delay before the first retry. It doubles with
+	// every retry and is jittered.
+	InitialDelayMs int `json:"initial_delay_ms,omitempty"`
+	// MaxDelayMs caps the delay, including one asked for with Retry-After
+	MaxDelayMs int `json:"max_delay_ms,omitempty"`
+}
+
+const (
+	defaultRetryInitialDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay     = 10 * time.Second
+	// maxRetries bounds RetryConfig.MaxRetries; more retries only keep a
+	// client waiting on an upstream that is down
+	maxRetries = 10
+)
+
+// validate rejects retry settings out of range
+func (r RetryConfig) validate() error {
+	if r.MaxRetries < 0 || r.MaxRetries > maxRetries {
+		return fmt.Errorf("retry.max_retries must be between 0 and %d", maxRetries)
+	}
+	hour := int(time.Hour / time.Millisecond)
+	if r.InitialDelayMs < 0 || r.InitialDelayMs > hour || r.MaxDelayMs < 0 || r.MaxDelayMs > hour {
+		return fmt.Errorf("retry delays must be between 0 and %d ms", hour)
+	}
+	return nil
+}
+
+// isTransientStatus reports whether an upstream status is worth retrying
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns how long to wait before retry number attempt (counting
+// from 0). A Retry-After header on resp takes precedence over the backoff.
+func (r RetryConfig) delay(attempt int, resp *http.Response) time.Duration {
+	initial := defaultRetryInitialDelay
+	if r.InitialDelayMs > 0 {
+		initial = time.Duration(r.InitialDelayMs) * time.Millisecond
+	}
+	maxDelay := defaultRetryMaxDelay
+	if r.MaxDelayMs > 0 {
+		maxDelay = time.Duration(r.MaxDelayMs) * time.Millisecond
+	}
+
+	if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		return min(d, maxDelay)
+	}
+
+	// Double until the cap is reached, so a large attempt can't overflow
+	d := initial
+	for i := 0; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	// Jitter between half and the full delay so clients that failed
+	// together don't retry together
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendWithRetries sends req, retrying transient failures with backoff.
+// Requests whose body can't be replayed are sent once.
+func (t *upstreamTransport) sendWithRetries(req *http.Request, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.send(req, header)
+		if err != nil || attempt >= t.retry.MaxRetries || !isTransientStatus(resp.StatusCode) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		delay := t.retry.delay(attempt, resp)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		slog.Warn("Upstream call failed, retrying", "url", req.URL.String(), "status", resp.StatusCode, "attempt", attempt+1, "delay", delay)
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelayLargeAttempt(t *testing.T) {
+	r := RetryConfig{InitialDelayMs: 500, MaxDelayMs: 10_000}
+	resp := &http.Response{Header: http.Header{}}
+	for _, attempt := range []int{0, 1, 5, 40, 63, 64, 1000} {
+		d := r.delay(attempt, resp)
+		if d <= 0 || d > 10*time.Second {
+			t.Errorf("delay(%d) = %v, want within (0, 10s]", attempt, d)
+		}
+	}
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	tests := []struct {
+		config RetryConfig
+		valid  bool
+	}{
+		{RetryConfig{MaxRetries: 2}, true},
+		{RetryConfig{MaxRetries: maxRetries, InitialDelayMs: 100, MaxDelayMs: 60_000}, true},
+		{RetryConfig{MaxRetries: -1}, false},
+		{RetryConfig{MaxRetries: 100}, false},
+		{RetryConfig{MaxRetries: 2, InitialDelayMs: -1}, false},
+		{RetryConfig{MaxRetries: 2, MaxDelayMs: 1 << 62}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tt.config, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Secret detection modes
+const (
+	SecretActionOff   = "off"
+	SecretActionBlock = "block"
+	SecretActionMask  = "mask"
+)
+
+// secretMask replaces detected credentials when masking is enabled
+const secretMask = "[REDACTED]"
+
+// secretPattern describes a kind of credential we look for in prompts
+type secretPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var secretPatterns = []secretPattern{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret key", regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}[=:]\s*['"]?[0-9a-zA-Z/+]{40}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )*PRIVATE KEY-----`)},
+	{"bearer token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`)},
+}
+
+// findSecrets returns the names of all credential kinds found in text
+func findSecrets(text string) []string {
+	var found []string
+	for _, p := range secretPatterns {
+		if p.re.MatchString(text) {
+			found = append(found, p.name)
+		}
+	}
+	return found
+}
+
+// maskSecrets replaces every detected credential in text
+func maskSecrets(text string) string {
+	for _, p := range secretPatterns {
+		text = p.re.ReplaceAllString(text, secretMask)
+	}
+	return text
+}
+
+// secretsInterceptor applies the configured secret detection mode to outgoing
+// messages. In block mode the request is rejected, in mask mode the messages
+// are redacted in place.
+type secretsInterceptor struct {
+	mode string
+}
+
+func newSecretsInterceptor(s *Server) Interceptor {
+	mode := s.config.SecretDetection
+	if mode == "" || mode == SecretActionOff {
+		return nil
+	}
+	return &secretsInterceptor{mode: mode}
+}
+
+func (si *secretsInterceptor) InterceptRequest(ex *Exchange) error {
+	messages := ex.Request.Messages
+	for i := range messages {
+		msg := &messages[i]
+		if si.mode == SecretActionMask {
+			msg.Content = maskSecrets(msg.Content)
+			for j := range msg.MultiContent {
+				msg.MultiContent[j].Text = maskSecrets(msg.MultiContent[j].Text)
+			}
+			continue
+		}
+
+		found := findSecrets(msg.Content)
+		for _, part := range msg.MultiContent {
+			found = append(found, findSecrets(part.Text)...)
+		}
+		if len(found) > 0 {
+			return fmt.Errorf("request blocked: message %d appears to contain a secret (%s)", i, strings.Join(found, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (si *secretsInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (si *secretsInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key storage backends, selected with the key_storage config setting
+const (
+	// KeyStorageAuto uses the OS keyring and falls back to the encrypted
+	// file when the keyring is unavailable
+	KeyStorageAuto    = "auto"
+	KeyStorageKeyring = "keyring"
+	KeyStorageFile    = "file"
+)
+
+// passphraseEnv names the environment variable holding the passphrase for
+// the encrypted key file. Without it the key is derived from the machine.
+const passphraseEnv = "OPENROUTER_PROXY_PASSPHRASE"
+
+const (
+	saltSize  = 16
+	nonceSize = 24
+)
+
+// errSecretNotFound is returned when a secret is in neither store
+var errSecretNotFound = errors.New("secret not found")
+
+// keyStorage returns the configured key storage backend. Portable mode
+// always uses the encrypted file, which travels with the executable.
+func keyStorage() string {
+	if portableDir != "" {
+		return KeyStorageFile
+	}
+	config, _ := LoadConfig()
+	_ = effectiveConfig(&config)
+	if config.KeyStorage == "" {
+		return KeyStorageAuto
+	}
+	return config.KeyStorage
+}
+
+// getSecret reads a secret from the configured store
+func getSecret(account string) (string, error) {
+	storage := keyStorage()
+	if storage != KeyStorageFile {
+		secret, err := keyring.Get(appName, account)
+		if err == nil || storage == KeyStorageKeyring {
+			return secret, err
+		}
+	}
+	return readSecretFile(account)
+}
+
+// setSecret stores a secret in the configured store. In auto mode the
+// encrypted file is only used when the keyring fails.
+func setSecret(account, secret string) error {
+	storage := keyStorage()
+	if storage != KeyStorageFile {
+		err := keyring.Set(appName, account, secret)
+		if err == nil || storage == KeyStorageKeyring {
+			return err
+		}
+		slog.Warn("OS keyring unavailable, storing key in encrypted file", "error", err)
+	}
+	return writeSecretFile(account, secret)
+}
+
+// secretFilePath returns the path of the encrypted key file, next to
+// config.json
+func secretFilePath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "secrets.enc"), nil
+}
+
+// secretPassphrase returns the passphrase the file key is derived from:
+// the configured one, or properties of this machine and user so the file
+// is useless elsewhere
+func secretPassphrase() []byte {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return []byte(passphrase)
+	}
+	parts := []string{appName}
+	if host, err := os.Hostname(); err == nil {
+		parts = append(parts, host)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		parts = append(parts, home)
+	}
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id, err := os.ReadFile(path); err == nil {
+			parts = append(parts, strings.TrimSpace(string(id)))
+			break
+		}
+	}
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+// secretKey derives the secretbox key from the passphrase and salt
+func secretKey(salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(secretPassphrase(), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+// loadSecretFile reads the encrypted secrets, base64 encoded per account
+func loadSecretFile() (map[string]string, string, error) {
+	path, err := secretFilePath()
+	if err != nil {
+		return nil, "", err
+	}
+	secrets := map[string]string{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return secrets, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, "", err
+	}
+	return secrets, path, nil
+}
+
+// readSecretFile decrypts one secret from the encrypted file
+func readSecretFile(account string) (string, error) {
+	secrets, _, err := loadSecretFile()
+	if err != nil {
+		return "", err
+	}
+	encoded, ok := secrets[account]
+	if !ok {
+		return "", errSecretNotFound
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < saltSize+nonceSize {
+		return "", errors.New("corrupt secrets file")
+	}
+	key, err := secretKey(sealed[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[saltSize:saltSize+nonceSize])
+
+	secret, ok := secretbox.Open(nil, sealed[saltSize+nonceSize:], &nonce, key)
+	if !ok {
+		return "", errors.New("cannot decrypt secrets file: wrong passphrase or different machine")
+	}
+	return string(secret), nil
+}
+
+// writeSecretFile encrypts a secret into the encrypted file, which only
+// the current user can read
+func writeSecretFile(account, secret string) error {
+	secrets, path, err := loadSecretFile()
+	if err != nil {
+		return err
+	}
+
+	sealed := make([]byte, saltSize+nonceSize)
+	if _, err := rand.Read(sealed); err != nil {
+		return err
+	}
+	key, err := secretKey(sealed[:saltSize])
+	if err != nil {
+		return err
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[saltSize:])
+	sealed = secretbox.Seal(sealed, []byte(secret), &nonce, key)
+
+	secrets[account] = base64.StdEncoding.EncodeToString(sealed)
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -3,49 +3,195 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	openai "github.com/sashabaranov/go-openai"
 )
 
 // Server encapsulates the proxy server functionality
 type Server struct {
 	apiKey      string
 	modelFilter string
+	config      Config
 	router      *gin.Engine
 	httpServer  *http.Server
-	provider    *OpenrouterProvider
+	provider    Provider
 	filterMap   map[string]struct{}
+	filterMu    sync.RWMutex
+	configMu    sync.RWMutex // guards the settings the admin API changes
+	origins     []string
+	virtual     *virtualModels
+	output      *outputFilter
+	transcripts *transcriptLog
+	shadow      *shadowLog
+	cache       *responseCache
+	plugins     *pluginRuntime
+	models      *modelTracker
+	usage       *usageLedger
+	usageDB     *usageStore
+	drain       *drainer
+	rates       *rateBuckets
+	recent      *recentRequests
+	health      *healthTracker
+	notices     *notices
+	restarts    restartStats
 	stopCh      chan struct{}
+	stopOnce    sync.Once
 	wg          sync.WaitGroup
+
+	// current is the generation handling requests: the server itself until
+	// the configuration is reloaded, see Reload
+	current  atomic.Pointer[Server]
+	reloadMu sync.Mutex
+
+	// OnConfigChange, when set, is told about configuration changes made
+	// through the admin API, which are already saved
+	OnConfigChange func(update func(*Config))
+
+	// OnStateChange, when set, is told when the server starts accepting
+	// connections, becomes degraded or recovers, fails or is stopped. detail
+	// explains failures.
+	OnStateChange func(state ServerState, detail string)
+
+	// OnNotice, when set, is told about events a user should know about,
+	// such as a rejected API key or a budget running out
+	OnNotice func(title, message string)
 }
 
 // NewServer creates a new server instance
-func NewServer(apiKey, modelFilter string) *Server {
-	return &Server{
+func NewServer(apiKey string, config Config) *Server {
+	if err := effectiveConfig(&config); err != nil {
+		slog.Warn("Some settings could not be applied", "error", err)
+	}
+	applyModelSections(&config)
+	applyCompatibilityPreset(&config)
+	s := &Server{
 		apiKey:      apiKey,
-		modelFilter: modelFilter,
+		modelFilter: config.modelFilterPath(),
+		config:      config,
+		models:      newModelTracker(),
+		usage:       newUsageLedger(),
+		drain:       newDrainer(),
+		rates:       newRateBuckets(),
+		recent:      newRecentRequests(),
 		stopCh:      make(chan struct{}),
 	}
+	s.notices = newNotices(s.notice)
+	s.health = newHealthTracker(s.setState, s.notices)
+	return s
+}
+
+// Start starts the proxy server and blocks until it stops. It returns nil
+// after Stop, or the error that made the server fail.
+func (s *Server) Start() error {
+	err := s.run()
+	if err != nil {
+		s.setState(ServerFailed, err.Error())
+	}
+	return err
 }
 
-// Start starts the proxy server
-func (s *Server) Start() {
+// run does the work of Start
+func (s *Server) run() error {
 	s.wg.Add(1)
 	defer s.wg.Done()
 
+	if err := s.setup(); err != nil {
+		return err
+	}
+
+	// Open the usage database; usage is still tracked in memory without it.
+	// It is opened once setup succeeded, as from here on Stop closes it.
+	if dbPath, err := usageDBPath(); err == nil {
+		if s.usageDB, err = openUsageStore(dbPath); err != nil {
+			slog.Error("Error opening usage database", "Error", err)
+		}
+	}
+	s.current.Store(s)
+
+	// Create HTTP server. There is deliberately no write timeout: streamed
+	// answers from slow models can take minutes. Requests go to the router
+	// of the current generation, which changes when the config is reloaded.
+	s.httpServer = &http.Server{
+		Addr: fmt.Sprintf(":%d", s.config.listenPort()),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.current.Load().router.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	// Serve HTTPS when a certificate is configured
+	var certFile, keyFile string
+	var err error
+	if s.config.TLS.Enabled() {
+		certFile, keyFile, err = s.config.TLS.certificateFiles()
+		if err != nil {
+			slog.Error("Error loading TLS certificate", "Error", err)
+			return err
+		}
+	}
+
+	// Start the server. The port is bound first so that it is only
+	// reported started once connections are accepted.
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		if isAddrInUse(err) {
+			port := s.config.listenPort()
+			err = &portInUseError{Port: port, Owner: portOwner(port)}
+		}
+		slog.Error("Server error", "error", err)
+		return err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if certFile != "" {
+			err = s.httpServer.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = s.httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server error", "error", err)
+			errCh <- err
+		}
+	}()
+
+	slog.Info("Server started", "port", s.config.listenPort(), "tls", certFile != "")
+	s.setState(ServerStarted, "")
+
+	// Wait for stop signal or failure
+	select {
+	case <-s.stopCh:
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// setup prepares everything the server needs to handle requests for its
+// configuration, up to the router
+func (s *Server) setup() error {
 	// Initialize the provider
-	s.provider = NewOpenrouterProvider(s.apiKey)
+	provider, err := newProvider(s.upstreamAPIKey(), s.config)
+	if err != nil {
+		slog.Error("Error setting up backends", "Error", err)
+		return err
+	}
+	s.provider = provider
+	// Names matching several models resolve to one the filter shows
+	provider.preferModels(s.allowedByFilter)
 
 	// Load model filter
 	filter, err := s.loadModelFilter(s.modelFilter)
@@ -55,7 +201,7 @@ func (s *Server) Start() {
 			s.filterMap = make(map[string]struct{})
 		} else {
 			slog.Error("Error loading models filter", "Error", err)
-			return
+			return err
 		}
 	} else {
 		s.filterMap = filter
@@ -65,39 +211,86 @@ func (s *Server) Start() {
 		}
 	}
 
-	// Set up the router
-	s.router = gin.Default()
-	s.setupRoutes()
+	// Load virtual models
+	path, err := virtualModelsPath()
+	if err == nil {
+		s.virtual, err = loadVirtualModels(path)
+	}
+	if err != nil {
+		slog.Error("Error loading virtual models", "Error", err)
+		return err
+	}
 
-	// Create HTTP server
-	s.httpServer = &http.Server{
-		Addr:    ":11434",
-		Handler: s.router,
+	// Compile output filter rules
+	s.output, err = newOutputFilter(s.config.OutputFilter)
+	if err != nil {
+		slog.Error("Error loading output filter", "Error", err)
+		return err
 	}
 
-	// Start the server
-	go func() {
-		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			slog.Error("Server error", "error", err)
-		}
-	}()
+	// Open the transcript log
+	s.transcripts, err = newTranscriptLog(s.config.Transcripts)
+	if err != nil {
+		slog.Error("Error setting up transcripts", "Error", err)
+		return err
+	}
 
-	slog.Info("Server started on port 11434")
+	// Set up the response cache
+	s.cache, err = newResponseCache(s.config.Cache)
+	if err != nil {
+		slog.Error("Error setting up the response cache", "Error", err)
+		return err
+	}
 
-	// Wait for stop signal
-	<-s.stopCh
+	// Open the shadow comparison log
+	s.shadow, err = newShadowLog(s.config.Shadow)
+	if err != nil {
+		slog.Error("Error setting up shadow requests", "Error", err)
+		return err
+	}
+
+	// Compile WASM plugins
+	s.plugins, err = loadPlugins(s.config.Plugins)
+	if err != nil {
+		slog.Error("Error loading plugins", "Error", err)
+		return err
+	}
+
+	s.origins = s.corsOrigins()
+
+	// Set up the router
+	s.router = gin.New()
+	s.router.Use(gin.Recovery(), s.drainMiddleware(), requestIDMiddleware(), tracingMiddleware(), accessLogMiddleware(), s.corsMiddleware(), s.rateLimitMiddleware(), s.authMiddleware(), s.clientKeyMiddleware(), s.adminMiddleware())
+	s.setupRoutes()
+	return nil
 }
 
-// Stop stops the proxy server
+// Stop stops the proxy server. It is safe to call more than once.
 func (s *Server) Stop() {
+	s.stopOnce.Do(s.stop)
+}
+
+func (s *Server) stop() {
 	if s.httpServer != nil {
+		// The drain timeout may have been changed by a reload
+		gen := s.current.Load()
+		if gen == nil {
+			gen = s
+		}
+
+		// Let requests in flight finish, turning new ones away with 503
+		if left := s.drain.drain(drainTimeout(gen.config.DrainTimeoutSeconds)); left > 0 {
+			slog.Warn("Drain timeout reached, aborting requests", "requests", left)
+		}
+
 		// Create a context with timeout for shutdown
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Shutdown the server
+		// Shutdown the server, closing whatever outlived the drain
 		if err := s.httpServer.Shutdown(ctx); err != nil {
 			slog.Error("Server shutdown error", "error", err)
+			s.httpServer.Close()
 		}
 
 		// Signal the Start method to return
@@ -106,7 +299,13 @@ func (s *Server) Stop() {
 		// Wait for the Start method to complete
 		s.wg.Wait()
 
+		gen.release()
+		if s.usageDB != nil {
+			s.usageDB.Close()
+		}
+
 		slog.Info("Server stopped")
+		s.setState(ServerStopped, "")
 	}
 }
 
@@ -120,250 +319,138 @@ func (s *Server) setupRoutes() {
 	})
 
 	s.router.GET("/api/tags", func(c *gin.Context) {
-		models, err := s.provider.GetModels()
+		// ?refresh=1 bypasses the model list cache
+		list := s.provider.GetModels
+		if refresh, _ := strconv.ParseBool(c.Query("refresh")); refresh {
+			list = s.provider.RefreshModels
+		}
+		models, err := list()
 		if err != nil {
-			slog.Error("Error getting models", "Error", err)
+			requestLogger(c).Error("Error getting models", "Error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		filter := s.filterMap
 		// Construct a new array of model objects with extra fields
 		newModels := make([]map[string]interface{}, 0, len(models))
 		for _, m := range models {
 			// If filter is not empty, check if model is in filter
-			if len(filter) > 0 {
-				if _, ok := filter[m.Model]; !ok {
-					continue
-				}
+			if !s.allowedByFilter(m.fullName) || !s.config.ModelRules.allows(m.meta) {
+				continue
 			}
 			newModels = append(newModels, map[string]interface{}{
 				"name":        m.Name,
 				"model":       m.Model,
 				"modified_at": m.ModifiedAt,
-				"size":        270898672,
-				"digest":      "9077fe9d2ae1a4a41a868836b56b8163731a8fe16621397028c2c76f838c6907",
+				"size":        m.Size,
+				"digest":      m.Digest,
 				"details":     m.Details,
 			})
 		}
 
-		c.JSON(http.StatusOK, gin.H{"models": newModels})
-	})
-
-	s.router.POST("/api/show", func(c *gin.Context) {
-		var request map[string]string
-		if err := c.BindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
-			return
+		// Virtual models and aliases are listed with the details of the
+		// model behind them
+		addAlias := func(name, from string) {
+			target := Model{ModifiedAt: time.Now().Format(time.RFC3339), Digest: modelDigest(from)}
+			for _, m := range models {
+				if m.fullName == from || m.Model == shortModelName(from) {
+					target = m
+					break
+				}
+			}
+			newModels = append(newModels, map[string]interface{}{
+				"name":        name,
+				"model":       name,
+				"modified_at": target.ModifiedAt,
+				"size":        target.Size,
+				"digest":      target.Digest,
+				"details":     target.Details,
+			})
 		}
-
-		modelName := request["name"]
-		if modelName == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
-			return
+		for _, name := range s.virtual.Names() {
+			vm, _ := s.virtual.Get(name)
+			addAlias(name, vm.From)
 		}
-
-		details, err := s.provider.GetModelDetails(modelName)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		aliases := s.aliases()
+		for _, name := range s.aliasNames() {
+			addAlias(name, aliases[name])
+		}
+		for _, name := range s.splitNames() {
+			addAlias(name, s.config.ModelSplits[name][0].Model)
 		}
 
-		c.JSON(http.StatusOK, details)
+		c.JSON(http.StatusOK, gin.H{"models": newModels})
 	})
 
-	s.router.POST("/api/chat", func(c *gin.Context) {
+	s.router.GET("/api/version", s.handleVersion)
+	s.router.GET("/api/ps", s.handlePs)
+	s.router.GET("/api/usage", s.handleUsage)
+	s.router.GET("/api/stats", s.handleStats)
+	s.router.GET("/admin/export", s.handleExport)
+	s.router.GET("/dashboard", s.handleDashboard)
+	s.router.GET("/dashboard/api/state", s.handleDashboardState)
+	s.router.POST("/dashboard/api/filter", s.handleDashboardFilter)
+	s.router.DELETE("/dashboard/api/filter", s.handleDashboardFilter)
+	s.setupAdminRoutes()
+
+	s.router.POST("/api/show", func(c *gin.Context) {
 		var request struct {
-			Model    string                         `json:"model"`
-			Messages []openai.ChatCompletionMessage `json:"messages"`
-			Stream   *bool                          `json:"stream"`
+			Name  string `json:"name"`
+			Model string `json:"model"`
 		}
-
-		// Parse the JSON request
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
 			return
 		}
 
-		// Determine if streaming is requested (default true for /api/chat)
-		streamRequested := true
-		if request.Stream != nil {
-			streamRequested = *request.Stream
+		// Newer clients send "model", older ones "name"
+		modelName := request.Model
+		if modelName == "" {
+			modelName = request.Name
 		}
-
-		// Handle non-streaming response
-		if !streamRequested {
-			fullModelName, err := s.provider.GetFullModelName(request.Model)
-			if err != nil {
-				slog.Error("Error getting full model name", "Error", err)
-				// Ollama returns 404 for invalid model names
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Call Chat to get the complete response
-			response, err := s.provider.Chat(request.Messages, fullModelName)
-			if err != nil {
-				slog.Error("Failed to get chat response", "Error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Format the response according to Ollama's format
-			if len(response.Choices) == 0 {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "No response from model"})
-				return
-			}
-
-			// Extract the content from the response
-			content := ""
-			if len(response.Choices) > 0 && response.Choices[0].Message.Content != "" {
-				content = response.Choices[0].Message.Content
-			}
-
-			// Get finish reason, default to "stop" if not provided
-			finishReason := "stop"
-			if response.Choices[0].FinishReason != "" {
-				finishReason = string(response.Choices[0].FinishReason)
-			}
-
-			// Create Ollama-compatible response
-			ollamaResponse := map[string]interface{}{
-				"model":             fullModelName,
-				"created_at":        time.Now().Format(time.RFC3339),
-				"message": map[string]string{
-					"role":    "assistant",
-					"content": content,
-				},
-				"done":              true,
-				"finish_reason":     finishReason,
-				"total_duration":    response.Usage.TotalTokens * 10, // Approximate duration based on token count
-				"load_duration":     0,
-				"prompt_eval_count": response.Usage.PromptTokens,
-				"eval_count":        response.Usage.CompletionTokens,
-				"eval_duration":     response.Usage.CompletionTokens * 10, // Approximate duration based on token count
-			}
-
-			c.JSON(http.StatusOK, ollamaResponse)
+		if modelName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
 			return
 		}
 
-		slog.Info("Requested model", "model", request.Model)
-		fullModelName, err := s.provider.GetFullModelName(request.Model)
+		fullName, err := s.resolveModel(modelName)
 		if err != nil {
-			slog.Error("Error getting full model name", "Error", err, "model", request.Model)
-			// Ollama returns 404 for invalid model names
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		slog.Info("Using model", "fullModelName", fullModelName)
 
-		// Call ChatStream to get the stream
-		stream, err := s.provider.ChatStream(request.Messages, fullModelName)
+		details, err := s.provider.GetModelDetails(fullName)
 		if err != nil {
-			slog.Error("Failed to create stream", "Error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer stream.Close() // Ensure stream closure
-
-		// Set headers for Newline Delimited JSON
-		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
-
-		w := c.Writer
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			slog.Error("Expected http.ResponseWriter to be an http.Flusher")
-			return
-		}
-
-		var lastFinishReason string
-
-		// Stream responses back to the client
-		for {
-			response, err := stream.Recv()
-			if errors.Is(err, io.EOF) {
-				// End of stream from the backend provider
-				break
-			}
-			if err != nil {
-				slog.Error("Backend stream error", "Error", err)
-				// Try to send error in NDJSON format
-				errorMsg := map[string]string{"error": "Stream error: " + err.Error()}
-				errorJson, _ := json.Marshal(errorMsg)
-				fmt.Fprintf(w, "%s\n", string(errorJson))
-				flusher.Flush()
-				return
-			}
-
-			// Save finish reason if present in chunk
-			if len(response.Choices) > 0 && response.Choices[0].FinishReason != "" {
-				lastFinishReason = string(response.Choices[0].FinishReason)
-			}
-
-			// Build JSON response structure for intermediate chunks
-			responseJSON := map[string]interface{}{
-				"model":      fullModelName,
-				"created_at": time.Now().Format(time.RFC3339),
-				"message": map[string]string{
-					"role":    "assistant",
-					"content": response.Choices[0].Delta.Content,
-				},
-				"done": false,
-			}
-
-			// Marshal JSON
-			jsonData, err := json.Marshal(responseJSON)
-			if err != nil {
-				slog.Error("Error marshaling intermediate response JSON", "Error", err)
-				return
-			}
-
-			// Send JSON object followed by a newline
-			fmt.Fprintf(w, "%s\n", string(jsonData))
-
-			// Flush data to send it immediately
-			flusher.Flush()
+		if vm, ok := s.virtual.Get(modelName); ok {
+			details["modelfile"] = vm.modelfile()
+			details["system"] = vm.System
+			details["parameters"] = strings.Join(vm.parameterLines(), "\n")
 		}
 
-		// Set finish reason (default to 'stop')
-		if lastFinishReason == "" {
-			lastFinishReason = "stop"
-		}
+		c.JSON(http.StatusOK, details)
+	})
 
-		// Send final message with done=true
-		finalResponse := map[string]interface{}{
-			"model":             fullModelName,
-			"created_at":        time.Now().Format(time.RFC3339),
-			"message": map[string]string{
-				"role":    "assistant",
-				"content": "",
-			},
-			"done":              true,
-			"finish_reason":     lastFinishReason,
-			"total_duration":    0,
-			"load_duration":     0,
-			"prompt_eval_count": 0,
-			"eval_count":        0,
-			"eval_duration":     0,
-		}
+	s.router.POST("/api/pull", s.handlePull)
+	s.router.POST("/api/copy", s.handleCopy)
+	s.router.POST("/api/create", s.handleCreate)
+	s.router.DELETE("/api/delete", s.handleDelete)
 
-		finalJsonData, err := json.Marshal(finalResponse)
-		if err != nil {
-			slog.Error("Error marshaling final response JSON", "Error", err)
-			return
-		}
+	s.router.POST("/api/chat", s.handleChat)
+	s.router.POST("/api/generate", s.handleGenerate)
+	s.router.POST("/api/embed", s.handleEmbed)
+	s.router.POST("/api/embeddings", s.handleLegacyEmbeddings)
 
-		// Send final JSON object + newline
-		fmt.Fprintf(w, "%s\n", string(finalJsonData))
-		flusher.Flush()
-	})
+	// OpenAI dialect
+	s.router.GET("/v1/models", s.handleOpenAIModels)
+	s.router.POST("/v1/chat/completions", s.handleOpenAIPassthrough)
+	s.router.POST("/v1/completions", s.handleOpenAIPassthrough)
 }
 
 // loadModelFilter loads the model filter from a file
-func (s *Server) loadModelFilter(path string) (map[string]struct{}, error) {
-	file, err := os.Open(path)
+func (s *Server) loadModelFilter(filename string) (map[string]struct{}, error) {
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -373,10 +460,15 @@ func (s *Server) loadModelFilter(path string) (map[string]struct{}, error) {
 	filter := make(map[string]struct{})
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			filter[line] = struct{}{}
+		line := filterLineEntry(scanner.Text())
+		if line == "" {
+			continue
 		}
+		if _, err := path.Match(line, ""); err != nil {
+			slog.Warn("Ignoring invalid models-filter pattern", "pattern", line, "error", err)
+			continue
+		}
+		filter[line] = struct{}{}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -384,4 +476,4 @@ func (s *Server) loadModelFilter(path string) (map[string]struct{}, error) {
 	}
 
 	return filter, nil
-}
\ No newline at end of file
+}
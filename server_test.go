@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	// Keep the route list out of the test output
+	gin.SetMode(gin.TestMode)
+}
+
+// testModels is the model list the stub upstream serves, with the metadata
+// clients derive capabilities and context lengths from
+const testModels = `{"data": [
+	{
+		"id": "openai/gpt-4o",
+		"name": "OpenAI: GPT-4o",
+		"created": 1715558400,
+		"context_length": 128000,
+		"description": "GPT-4o is OpenAI's flagship model.",
+		"architecture": {"modality": "text+image->text", "input_modalities": ["text", "image"], "output_modalities": ["text"], "tokenizer": "GPT"},
+		"supported_parameters": ["tools", "tool_choice", "response_format", "structured_outputs"],
+		"pricing": {"prompt": "0.0000025", "completion": "0.00001"}
+	},
+	{
+		"id": "deepseek/deepseek-r1",
+		"name": "DeepSeek: R1",
+		"created": 1737331200,
+		"context_length": 64000,
+		"architecture": {"modality": "text->text", "input_modalities": ["text"], "output_modalities": ["text"], "tokenizer": "DeepSeek"},
+		"supported_parameters": ["reasoning", "include_reasoning"],
+		"pricing": {"prompt": "0.00000055", "completion": "0.00000219"}
+	},
+	{
+		"id": "meta-llama/llama-3.1-70b-instruct",
+		"name": "Meta: Llama 3.1 70B Instruct",
+		"created": 1721692800,
+		"context_length": 131072,
+		"architecture": {"modality": "text->text", "input_modalities": ["text"], "output_modalities": ["text"], "tokenizer": "Llama3"},
+		"supported_parameters": ["tools", "tool_choice"],
+		"pricing": {"prompt": "0.0000001", "completion": "0.00000028"}
+	}
+]}`
+
+// stubUpstream is a fake OpenRouter API. It lists testModels, answers
+// chat completions with the chat handler, keeping the requests it got, and
+// embeds every input as [index, 1] at 7 tokens each.
+type stubUpstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+}
+
+func newStubUpstream(t *testing.T, chat func(w http.ResponseWriter, req openai.ChatCompletionRequest)) *stubUpstream {
+	t.Helper()
+	stub := &stubUpstream{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, testModels)
+	})
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeChatRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, req)
+		stub.mu.Unlock()
+		chat(w, req)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var req openai.EmbeddingRequestStrings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := openai.EmbeddingResponse{Usage: openai.Usage{PromptTokens: 7 * len(req.Input), TotalTokens: 7 * len(req.Input)}}
+		for i := range req.Input {
+			resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: []float32{float32(i), 1}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// decodeChatRequest decodes a chat completion request. go-openai types the
+// JSON schema of response_format as a json.Marshaler, which can't be
+// decoded into, so it is kept as raw JSON.
+func decodeChatRequest(body io.Reader) (openai.ChatCompletionRequest, error) {
+	var decoded struct {
+		openai.ChatCompletionRequest
+		ResponseFormat *struct {
+			Type       openai.ChatCompletionResponseFormatType `json:"type"`
+			JSONSchema *struct {
+				Name   string          `json:"name"`
+				Schema json.RawMessage `json:"schema"`
+				Strict bool            `json:"strict"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+	req := decoded.ChatCompletionRequest
+	if format := decoded.ResponseFormat; format != nil {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: format.Type}
+		if schema := format.JSONSchema; schema != nil {
+			req.ResponseFormat.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+				Name: schema.Name, Schema: schema.Schema, Strict: schema.Strict,
+			}
+		}
+	}
+	return req, nil
+}
+
+// Requests returns the chat completion requests received so far
+func (s *stubUpstream) Requests() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionRequest{}, s.requests...)
+}
+
+// answerChat replies to a non-streaming chat completion with content
+func answerChat(w http.ResponseWriter, req openai.ChatCompletionRequest, content string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:    "gen-test",
+		Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: openai.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17},
+	})
+}
+
+// streamChunks replies to a streaming chat completion with the chunks as
+// server-sent events
+func streamChunks(w http.ResponseWriter, chunks ...openai.ChatCompletionStreamResponse) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	io.WriteString(w, "data: [DONE]\n\n")
+}
+
+// contentChunk is a streamed chunk carrying content
+func contentChunk(content string) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{
+		Delta: openai.ChatCompletionStreamChoiceDelta{Content: content},
+	}}}
+}
+
+// finishChunk is the last streamed chunk, with the finish reason and usage
+func finishChunk(reason openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{FinishReason: reason}},
+		Usage:   &openai.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17},
+	}
+}
+
+// newTestServer sets up a server for config against the stub upstream,
+// with its configuration directory in a temporary home. Requests are sent
+// to its router with serve.
+func newTestServer(t *testing.T, upstream *stubUpstream, config Config) *Server {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	config.LastUsedModelFilter = filepath.Join(home, "models-filter")
+
+	baseURL := openrouterBaseURL
+	openrouterBaseURL = upstream.URL + "/"
+	t.Cleanup(func() { openrouterBaseURL = baseURL })
+
+	s := NewServer("sk-or-test", config)
+	if err := s.setup(); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	s.current.Store(s)
+	return s
+}
+
+// serve sends a request with body, encoded as JSON unless nil, to the
+// server's router
+func serve(t *testing.T, s *Server, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveRequest(s, newJSONRequest(t, method, path, body))
+}
+
+// newJSONRequest builds a request with body, encoded as JSON unless nil
+func newJSONRequest(t *testing.T, method, path string, body any) *http.Request {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// serveRequest sends req to the server's router
+func serveRequest(s *Server, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON decodes a JSON response body, failing the test if it isn't
+// JSON
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, w.Body.String())
+	}
+	return body
+}
+
+// decodeNDJSON decodes a streamed NDJSON response, one object per line
+func decodeNDJSON(t *testing.T, w *httptest.ResponseRecorder) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("stream line is not JSON: %v\n%s", err, line)
+		}
+		lines = append(lines, obj)
+	}
+	return lines
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// Name and description the proxy is installed under as a service
+const (
+	serviceName        = "openrouter-proxy"
+	serviceDisplayName = "Ollama to OpenRouter Proxy"
+	serviceDescription = "Serves the Ollama API backed by OpenRouter"
+)
+
+// runServiceCommand installs or uninstalls the headless server as a
+// service that starts with the machine
+func runServiceCommand(command string) error {
+	if command == "uninstall-service" {
+		return uninstallService()
+	}
+	return installService()
+}
+
+// sdNotify sends a state change to systemd when it started the process
+// with Type=notify; otherwise it does nothing
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// Abstract sockets are given with a leading @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
@@ -0,0 +1,152 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// serviceUnit is the systemd user unit running the headless server. The
+// optional environment file can hold OPENROUTER_API_KEY, since the keyring
+// is usually locked when the service starts at boot.
+const serviceUnit = `[Unit]
+Description=%s
+
+[Service]
+Type=notify
+ExecStart=%s serve
+ExecReload=/bin/kill -HUP $MAINPID
+EnvironmentFile=-%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`
+
+// isService reports whether the process was started by the Windows service
+// manager, which is never the case here
+func isService() bool {
+	return false
+}
+
+// runService runs the server under the service manager; systemd runs it
+// like any other headless process
+func runService() error {
+	return runHeadless()
+}
+
+// serviceUnitPath returns where the systemd user unit is installed
+func serviceUnitPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", serviceName+".service"), nil
+}
+
+// serviceEnvPath returns the environment file the unit reads, next to
+// config.json
+func serviceEnvPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "service.env"), nil
+}
+
+// systemdQuote quotes an argument for a unit file's command line
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+	return `"` + arg + `"`
+}
+
+// systemctl runs systemctl for the user's service manager
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installService writes a systemd user unit for the headless server,
+// enables and starts it. Lingering is turned on so the service also runs
+// after a reboot without anyone logging in.
+func installService() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("services are only supported on Windows and Linux with systemd")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	unitPath, err := serviceUnitPath()
+	if err != nil {
+		return err
+	}
+	envPath, err := serviceEnvPath()
+	if err != nil {
+		return err
+	}
+
+	unit := fmt.Sprintf(serviceUnit, serviceDisplayName, systemdQuote(exe), envPath)
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0o644); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", serviceName+".service"); err != nil {
+		return err
+	}
+
+	if u, err := user.Current(); err == nil {
+		if out, err := exec.Command("loginctl", "enable-linger", u.Username).CombinedOutput(); err != nil {
+			slog.Warn("Could not enable lingering, the service starts only once you log in",
+				"error", err, "output", strings.TrimSpace(string(out)))
+		}
+	}
+
+	slog.Info("Service installed", "unit", unitPath, "environment", envPath)
+	return nil
+}
+
+// uninstallService stops and removes the systemd user unit
+func uninstallService() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("services are only supported on Windows and Linux with systemd")
+	}
+	unitPath, err := serviceUnitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("service is not installed: %w", err)
+	}
+	if err := systemctl("disable", "--now", serviceName+".service"); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	slog.Info("Service uninstalled", "unit", unitPath)
+	return nil
+}
@@ -0,0 +1,173 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// isService reports whether the process was started by the Windows service
+// manager
+func isService() bool {
+	service, err := svc.IsWindowsService()
+	return err == nil && service
+}
+
+// runService runs the headless server under the Windows service manager
+func runService() error {
+	return svc.Run(serviceName, proxyService{})
+}
+
+// proxyService runs the headless server as a Windows service. Stop and
+// shutdown stop the server, a parameter change reloads the configuration.
+type proxyService struct{}
+
+func (proxyService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	server, err := newHeadlessServer()
+	if err != nil {
+		slog.Error("Server failed", "error", err)
+		return true, 1
+	}
+	ready := make(chan struct{})
+	var readyOnce sync.Once
+	server.OnStateChange = func(state ServerState, detail string) {
+		if state == ServerStarted {
+			readyOnce.Do(func() { close(ready) })
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
+
+	running := svc.Status{
+		State:   svc.Running,
+		Accepts: svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange,
+	}
+	for {
+		select {
+		case <-ready:
+			status <- running
+			ready = nil
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.ParamChange:
+				reloadHeadless(server)
+			case svc.Stop, svc.Shutdown:
+				slog.Info("Shutting down", "request", "service stop")
+				status <- svc.Status{State: svc.StopPending}
+				server.Stop()
+				return false, 0
+			}
+		case err := <-errCh:
+			server.Stop()
+			if err != nil {
+				slog.Error("Server failed", "error", err)
+				return true, 1
+			}
+			return false, 0
+		}
+	}
+}
+
+// installService registers the headless server as a service that starts
+// with Windows, and starts it. The service runs as LocalSystem; its
+// environment points the user profile at the installing user's, so it uses
+// the same configuration.
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if existing, err := m.OpenService(serviceName); err == nil {
+		existing.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+	service, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, "serve")
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	err = key.SetStringsValue("Environment", []string{"USERPROFILE=" + home})
+	key.Close()
+	if err != nil {
+		return err
+	}
+	if err := service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, uint32((24 * time.Hour).Seconds())); err != nil {
+		slog.Warn("Could not set the service to restart on failure", "error", err)
+	}
+
+	// LocalSystem can't read this user's Credential Manager
+	if keyStorage() != KeyStorageFile && os.Getenv("OPENROUTER_API_KEY") == "" {
+		slog.Warn(`The service can't read your Credential Manager; set key_storage to "file" and save the API key again`)
+	}
+
+	if err := service.Start(); err != nil {
+		return fmt.Errorf("starting service: %w", err)
+	}
+	slog.Info("Service installed", "name", serviceName, "executable", exe)
+	return nil
+}
+
+// uninstallService stops and removes the Windows service
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer service.Close()
+
+	if _, err := service.Control(svc.Stop); err != nil {
+		slog.Warn("Could not stop the service", "error", err)
+	}
+	if err := service.Delete(); err != nil {
+		return err
+	}
+	slog.Info("Service uninstalled", "name", serviceName)
+	return nil
+}
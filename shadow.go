@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ShadowConfig mirrors requests to a second model to compare it with the
+// ones clients use, e.g. before switching to a cheaper model. Clients only
+// ever see the primary answer.
+type ShadowConfig struct {
+	// Model is the shadow model; empty disables mirroring
+	Model string `json:"model,omitempty"`
+	// SampleRate is the fraction of requests mirrored, all of them when 0
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// File is the JSONL file comparisons are appended to; defaults to
+	// "shadow.jsonl" in the config directory
+	File string `json:"file,omitempty"`
+}
+
+// shadowResult is one side of a comparison
+type shadowResult struct {
+	Model      string       `json:"model"`
+	Response   string       `json:"response"`
+	Error      string       `json:"error,omitempty"`
+	DurationMs int64        `json:"duration_ms"`
+	Usage      openai.Usage `json:"usage"`
+	Cost       float64      `json:"cost"`
+}
+
+// shadowEntry is one line of the comparison file
+type shadowEntry struct {
+	Time      time.Time    `json:"time"`
+	RequestID string       `json:"request_id"`
+	Model     string       `json:"model"`
+	Primary   shadowResult `json:"primary"`
+	Shadow    shadowResult `json:"shadow"`
+}
+
+// shadowLog appends comparisons to the shadow file
+type shadowLog struct {
+	mu     sync.Mutex
+	path   string
+	config ShadowConfig
+	// ctx ends on Close, aborting the mirrored requests in wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newShadowLog creates the comparison log for a configuration, or nil if
+// mirroring is disabled
+func newShadowLog(cfg ShadowConfig) (*shadowLog, error) {
+	if cfg.Model == "" {
+		return nil, nil
+	}
+
+	path := cfg.File
+	if path == "" {
+		configPath, err := GetConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(filepath.Dir(configPath), "shadow.jsonl")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &shadowLog{path: path, config: cfg, ctx: ctx, cancel: cancel}, nil
+}
+
+// start runs a mirrored request in the background, unless the log is
+// closed
+func (l *shadowLog) start(mirror func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		return
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		mirror()
+	}()
+}
+
+// Close aborts the mirrored requests still running and waits for them
+func (l *shadowLog) Close() {
+	l.mu.Lock()
+	l.cancel()
+	l.mu.Unlock()
+	l.wg.Wait()
+}
+
+// sampled decides whether a request is mirrored
+func (l *shadowLog) sampled() bool {
+	return l.config.SampleRate <= 0 || rand.Float64() < l.config.SampleRate
+}
+
+// Write appends an entry to the comparison file
+func (l *shadowLog) Write(entry shadowEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// shadowInterceptor keeps the request as sent upstream and the primary
+// answer, and mirrors the request once the primary exchange succeeded
+type shadowInterceptor struct {
+	s        *Server
+	log      *shadowLog
+	request  *openai.ChatCompletionRequest
+	fields   map[string]interface{}
+	response strings.Builder
+}
+
+func newShadowInterceptor(s *Server) Interceptor {
+	if s.shadow == nil || !s.shadow.sampled() {
+		return nil
+	}
+	return &shadowInterceptor{s: s, log: s.shadow}
+}
+
+func (si *shadowInterceptor) InterceptRequest(ex *Exchange) error {
+	request := *ex.Request
+	request.Messages = slices.Clone(ex.Request.Messages)
+	request.Stream = false
+	request.StreamOptions = nil
+	si.request = &request
+	si.fields = ex.UpstreamFields
+	return nil
+}
+
+func (si *shadowInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	si.response.WriteString(content)
+	return content, nil
+}
+
+func (si *shadowInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
+
+func (si *shadowInterceptor) Complete(ex *Exchange, outcome Outcome) {
+	// Only successful exchanges are worth comparing
+	if si.request == nil || ex.cached != nil || outcome.Status != OutcomeSuccess {
+		return
+	}
+	entry := shadowEntry{
+		Time:      ex.Started,
+		RequestID: ex.RequestID,
+		Model:     ex.Model,
+		Primary: shadowResult{
+			Model:      ex.Request.Model,
+			Response:   si.response.String(),
+			DurationMs: outcome.DurationMs,
+			Usage:      outcome.Usage,
+			Cost:       si.s.provider.Cost(ex.Request.Model, outcome.Usage),
+		},
+	}
+	si.log.start(func() { si.mirror(entry) })
+}
+
+// mirror sends the request to the shadow model and records the comparison.
+// It runs after the client got its answer, detached from its request, until
+// the log is closed.
+func (si *shadowInterceptor) mirror(entry shadowEntry) {
+	fullName, err := si.s.resolveModel(si.log.config.Model)
+	if err != nil {
+		slog.Error("Unknown shadow model", "model", si.log.config.Model, "error", err)
+		return
+	}
+	si.request.Model = fullName
+	entry.Shadow.Model = fullName
+
+	ctx := si.log.ctx
+	if timeout := si.s.config.Timeouts.total(false); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	response, err := si.s.provider.Chat(withUpstreamFields(ctx, si.fields), *si.request)
+	entry.Shadow.DurationMs = time.Since(started).Milliseconds()
+
+	outcome := Outcome{Status: OutcomeSuccess, DurationMs: entry.Shadow.DurationMs}
+	if err != nil {
+		entry.Shadow.Error = err.Error()
+		outcome = Outcome{Status: OutcomeError, Error: err.Error(), DurationMs: entry.Shadow.DurationMs}
+	} else {
+		entry.Shadow.Response = chatContent(response)
+		entry.Shadow.Usage = response.Usage
+		entry.Shadow.Cost = si.s.provider.Cost(fullName, response.Usage)
+		outcome.FinishReason = chatFinishReason(response)
+		outcome.Usage = response.Usage
+	}
+
+	// Shadow traffic is paid for like any other, so budgets must see it
+	si.s.usage.Record(si.log.config.Model, fullName, outcome, entry.Shadow.Cost)
+
+	slog.Info("Shadow request",
+		"request_id", entry.RequestID,
+		"primary", entry.Primary.Model,
+		"primary_ms", entry.Primary.DurationMs,
+		"primary_cost", entry.Primary.Cost,
+		"shadow", fullName,
+		"shadow_ms", entry.Shadow.DurationMs,
+		"shadow_cost", entry.Shadow.Cost,
+		"error", entry.Shadow.Error)
+	if err := si.log.Write(entry); err != nil {
+		slog.Error("Failed to write shadow comparison", "request_id", entry.RequestID, "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// SplitArm is one model of an A/B split
+type SplitArm struct {
+	Model string `json:"model"`
+	// Weight is the arm's share of requests relative to the other arms
+	// (default 1)
+	Weight int `json:"weight,omitempty"`
+}
+
+func (a SplitArm) weight() int {
+	if a.Weight <= 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// modelSplit returns the arms of the split for a requested model name. As
+// with aliases, "name" and "name:latest" are the same model.
+func (s *Server) modelSplit(name string) ([]SplitArm, bool) {
+	if arms, ok := s.config.ModelSplits[name]; ok && len(arms) > 0 {
+		return arms, true
+	}
+	base := strings.TrimSuffix(name, ":latest")
+	for split, arms := range s.config.ModelSplits {
+		if strings.TrimSuffix(split, ":latest") == base && len(arms) > 0 {
+			return arms, true
+		}
+	}
+	return nil, false
+}
+
+// pickArm picks the model of a split at random, by weight
+func pickArm(arms []SplitArm) string {
+	total := 0
+	for _, arm := range arms {
+		total += arm.weight()
+	}
+	n := rand.Intn(total)
+	for _, arm := range arms {
+		if n < arm.weight() {
+			return arm.Model
+		}
+		n -= arm.weight()
+	}
+	return arms[len(arms)-1].Model
+}
+
+// splitNames returns the names of the configured splits, sorted
+func (s *Server) splitNames() []string {
+	names := make([]string, 0, len(s.config.ModelSplits))
+	for name, arms := range s.config.ModelSplits {
+		if len(arms) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
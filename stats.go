@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverStats are the counters /api/stats reports since the server started
+type serverStats struct {
+	StartedAt     string `json:"started_at"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	InFlight      int    `json:"in_flight"`
+	usageTotals
+	TotalTokens int                     `json:"total_tokens"`
+	Models      map[string]*usageTotals `json:"models"`
+	restartStats
+}
+
+// restartStats tells how often the tray app's supervisor had to replace a
+// failed server since the user started it. A restarted server is a new
+// one, so the supervisor hands the count on before starting it.
+type restartStats struct {
+	Restarts    int    `json:"restarts"`
+	LastFailure string `json:"last_failure,omitempty"`
+	LastRestart string `json:"last_restart,omitempty"`
+}
+
+// Totals returns the sum of all requests in the ledger
+func (l *usageLedger) Totals() usageTotals {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var totals usageTotals
+	for _, m := range l.byModel {
+		totals.Requests += m.Requests
+		totals.Errors += m.Errors
+		totals.PromptTokens += m.PromptTokens
+		totals.CompletionTokens += m.CompletionTokens
+		totals.Cost += m.Cost
+	}
+	return totals
+}
+
+// Active returns the number of requests in flight
+func (d *drainer) Active() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// Stats returns the server's counters, as served by /api/stats
+func (s *Server) Stats() serverStats {
+	stats := serverStats{
+		StartedAt:     s.usage.since.Format(time.RFC3339),
+		UptimeSeconds: int64(time.Since(s.usage.since).Seconds()),
+		InFlight:      s.drain.Active(),
+		usageTotals:   s.usage.Totals(),
+		Models:        map[string]*usageTotals{},
+		restartStats:  s.restarts,
+	}
+	stats.TotalTokens = stats.PromptTokens + stats.CompletionTokens
+	for _, row := range s.usage.Report() {
+		totals := row.usageTotals
+		stats.Models[row.Model] = &totals
+	}
+	return stats
+}
+
+// handleStats serves /api/stats: lightweight JSON counters for the tray and
+// simple dashboards that don't run Prometheus
+func (s *Server) handleStats(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Stats())
+}
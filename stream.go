@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamWriter emits streamed response objects either as NDJSON (Ollama's
+// native format) or as server-sent events
+type streamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+}
+
+// newStreamWriter sets the response headers for a stream and returns a
+// writer for it. It returns false if the response cannot be streamed.
+func newStreamWriter(c *gin.Context, sse bool) (*streamWriter, bool) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	if sse {
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		// Set headers for Newline Delimited JSON
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	return &streamWriter{w: c.Writer, flusher: flusher, sse: sse}, true
+}
+
+// Write marshals v and sends it to the client immediately
+func (sw *streamWriter) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if sw.sse {
+		fmt.Fprintf(sw.w, "data: %s\n\n", data)
+	} else {
+		// Send JSON object followed by a newline
+		fmt.Fprintf(sw.w, "%s\n", data)
+	}
+
+	// Flush data to send it immediately
+	sw.flusher.Flush()
+	return nil
+}
+
+// Error sends an error object in the stream's format
+func (sw *streamWriter) Error(message string) {
+	sw.Write(map[string]string{"error": message})
+}
+
+// wantsSSE reports whether the client asked for server-sent events and the
+// server allows them
+func (s *Server) wantsSSE(c *gin.Context) bool {
+	return s.config.SSEOutput && strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default upstream timeouts, used for fields of TimeoutConfig left at 0
+const (
+	defaultConnectTimeout    = 10 * time.Second
+	defaultFirstTokenTimeout = 2 * time.Minute
+	defaultRequestTimeout    = 5 * time.Minute
+	defaultStreamTimeout     = 30 * time.Minute
+)
+
+// TimeoutConfig bounds upstream calls. Each field is in seconds; 0 means the
+// default and negative means no limit.
+type TimeoutConfig struct {
+	// ConnectSeconds bounds connecting to the upstream API, TLS included
+	ConnectSeconds int `json:"connect_seconds,omitempty"`
+	// FirstTokenSeconds bounds the wait for the first token of a stream
+	FirstTokenSeconds int `json:"first_token_seconds,omitempty"`
+	// RequestSeconds bounds a whole non-streaming request
+	RequestSeconds int `json:"request_seconds,omitempty"`
+	// StreamSeconds bounds a whole streaming request
+	StreamSeconds int `json:"stream_seconds,omitempty"`
+}
+
+// timeoutSeconds returns the duration for configured seconds: 0 is def and
+// negative is no limit, returned as 0
+func timeoutSeconds(seconds int, def time.Duration) time.Duration {
+	if seconds == 0 {
+		return def
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (t TimeoutConfig) connect() time.Duration {
+	return timeoutSeconds(t.ConnectSeconds, defaultConnectTimeout)
+}
+
+func (t TimeoutConfig) firstToken() time.Duration {
+	return timeoutSeconds(t.FirstTokenSeconds, defaultFirstTokenTimeout)
+}
+
+// total returns the limit for a whole request, streaming or not
+func (t TimeoutConfig) total(stream bool) time.Duration {
+	if stream {
+		return timeoutSeconds(t.StreamSeconds, defaultStreamTimeout)
+	}
+	return timeoutSeconds(t.RequestSeconds, defaultRequestTimeout)
+}
+
+// upstreamBaseTransport returns the transport upstream calls go out on: the
+// outbound one with connecting and the TLS handshake bounded
+func upstreamBaseTransport(t TimeoutConfig) http.RoundTripper {
+	transport := outboundTransport.Clone()
+	dialer := &net.Dialer{Timeout: t.connect(), KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = t.connect()
+	return transport
+}
+
+// timeoutError reports that an upstream call ran out of time
+type timeoutError struct {
+	what  string
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("upstream %s timed out after %s", e.what, e.after)
+}
+
+// startTimeouts bounds the exchange's upstream calls, fallbacks included, by
+// the configured total duration and, for streams, the wait for the first
+// token. The returned function releases the timers.
+func (ex *Exchange) startTimeouts(t TimeoutConfig, stream bool) func() {
+	ctx, cancel := context.WithCancelCause(ex.ctx)
+	ex.limit = ctx
+
+	var timers []*time.Timer
+	if total := t.total(stream); total > 0 {
+		timers = append(timers, time.AfterFunc(total, func() {
+			cancel(&timeoutError{what: "request", after: total})
+		}))
+	}
+	if first := t.firstToken(); stream && first > 0 {
+		ex.firstTokenTimer = time.AfterFunc(first, func() {
+			cancel(&timeoutError{what: "first token", after: first})
+		})
+		timers = append(timers, ex.firstTokenTimer)
+	}
+
+	return func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+		cancel(nil)
+	}
+}
+
+// timedOut returns the timeout behind an upstream error, if the exchange
+// ran out of time, and err otherwise
+func (ex *Exchange) timedOut(err error) error {
+	if ex.limit == nil {
+		return err
+	}
+	if cause, ok := context.Cause(ex.limit).(*timeoutError); ok {
+		return cause
+	}
+	return err
+}
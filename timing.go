@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// markSent records that the request is being sent upstream
+func (ex *Exchange) markSent() {
+	ex.sent = time.Now()
+}
+
+// markToken records the arrival of generated content; only the first call
+// counts
+func (ex *Exchange) markToken() {
+	if ex.firstToken.IsZero() {
+		ex.firstToken = time.Now()
+		if ex.firstTokenTimer != nil {
+			ex.firstTokenTimer.Stop()
+		}
+	}
+}
+
+// addTimings sets Ollama's token count and duration fields (in nanoseconds)
+// on a final response. Time spent in the proxy before the upstream call is
+// reported as load time, the wait for the first token as prompt evaluation
+// and the rest as generation. Without streamed tokens the whole upstream
+// call counts as generation.
+func (ex *Exchange) addTimings(response map[string]interface{}, usage openai.Usage) {
+	end := time.Now()
+	sent := ex.sent
+	if sent.IsZero() {
+		sent = ex.Started
+	}
+	firstToken := ex.firstToken
+	if firstToken.IsZero() {
+		firstToken = sent
+	}
+
+	response["total_duration"] = end.Sub(ex.Started).Nanoseconds()
+	response["load_duration"] = sent.Sub(ex.Started).Nanoseconds()
+	response["prompt_eval_count"] = usage.PromptTokens
+	response["prompt_eval_duration"] = firstToken.Sub(sent).Nanoseconds()
+	response["eval_count"] = usage.CompletionTokens
+	response["eval_duration"] = end.Sub(firstToken).Nanoseconds()
+}
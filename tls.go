@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TLSConfig serves the API over HTTPS
+type TLSConfig struct {
+	// CertFile and KeyFile are a PEM certificate and key pair
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// SelfSigned generates a self-signed certificate, kept in the config
+	// directory, when no pair is configured
+	SelfSigned bool `json:"self_signed,omitempty"`
+}
+
+// Enabled reports whether HTTPS is configured
+func (t TLSConfig) Enabled() bool {
+	return (t.CertFile != "" && t.KeyFile != "") || t.SelfSigned
+}
+
+// selfSignedValidity is how long a generated certificate is valid
+const selfSignedValidity = 2 * 365 * 24 * time.Hour
+
+// certificateFiles returns the certificate and key to serve, generating a
+// self-signed pair when needed
+func (t TLSConfig) certificateFiles() (string, string, error) {
+	if t.CertFile != "" && t.KeyFile != "" {
+		return t.CertFile, t.KeyFile, nil
+	}
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Dir(configPath)
+	certFile := filepath.Join(dir, "tls-cert.pem")
+	keyFile := filepath.Join(dir, "tls-key.pem")
+	if certificateValid(certFile) {
+		return certFile, keyFile, nil
+	}
+	if err := generateSelfSigned(certFile, keyFile); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// certificateValid reports whether the PEM certificate at path exists and
+// has not expired
+func certificateValid(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	return err == nil && time.Now().Before(cert.NotAfter)
+}
+
+// generateSelfSigned writes a self-signed certificate for localhost, the
+// host name and the machine's addresses
+func generateSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "OpenRouter Proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+	}
+	if host, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, ipnet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
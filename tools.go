@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ollamaMessage is a chat message in Ollama's format. Unlike OpenAI, Ollama
+// tool calls carry their arguments as a JSON object and have no IDs.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+}
+
+// ollamaToolCall is a single tool invocation requested by the model
+type ollamaToolCall struct {
+	Function ollamaToolCallFunction `json:"function"`
+}
+
+type ollamaToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// toOpenAIMessages converts Ollama messages to OpenAI messages. Images become
+// image_url content parts, tool call IDs are synthesized and tool results
+// are matched to the calls of the preceding assistant message, by name when
+// given and otherwise in order.
+func toOpenAIMessages(messages []ollamaMessage) ([]openai.ChatCompletionMessage, error) {
+	out := make([]openai.ChatCompletionMessage, 0, len(messages))
+	var pending []openai.ToolCall
+	callCount := 0
+
+	for i, m := range messages {
+		msg := openai.ChatCompletionMessage{Role: m.Role, Content: m.Content}
+		withImages(&msg, m.Images)
+
+		switch m.Role {
+		case openai.ChatMessageRoleAssistant:
+			pending = nil
+			for _, tc := range m.ToolCalls {
+				args, err := toolArgumentsString(tc.Function.Arguments)
+				if err != nil {
+					return nil, fmt.Errorf("message %d: %w", i, err)
+				}
+				callCount++
+				call := openai.ToolCall{
+					ID:   fmt.Sprintf("call_%d", callCount),
+					Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: args,
+					},
+				}
+				msg.ToolCalls = append(msg.ToolCalls, call)
+				pending = append(pending, call)
+			}
+
+		case openai.ChatMessageRoleTool:
+			for j, call := range pending {
+				if m.ToolName == "" || call.Function.Name == m.ToolName {
+					msg.ToolCallID = call.ID
+					msg.Name = call.Function.Name
+					pending = append(pending[:j], pending[j+1:]...)
+					break
+				}
+			}
+		}
+
+		out = append(out, msg)
+	}
+
+	return out, nil
+}
+
+// toolArgumentsString turns Ollama's argument object into OpenAI's JSON
+// string. Some clients already send a string, which is passed through.
+func toolArgumentsString(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "{}", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	if !json.Valid(raw) {
+		return "", fmt.Errorf("invalid tool call arguments")
+	}
+	return string(raw), nil
+}
+
+// toOllamaToolCalls converts OpenAI tool calls to Ollama's format
+func toOllamaToolCalls(calls []openai.ToolCall) []ollamaToolCall {
+	out := make([]ollamaToolCall, 0, len(calls))
+	for _, call := range calls {
+		args := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(args) {
+			// Keep malformed arguments visible to the client instead of failing
+			args, _ = json.Marshal(call.Function.Arguments)
+		}
+		if len(call.Function.Arguments) == 0 {
+			args = json.RawMessage("{}")
+		}
+		out = append(out, ollamaToolCall{
+			Function: ollamaToolCallFunction{Name: call.Function.Name, Arguments: args},
+		})
+	}
+	return out
+}
+
+// messageToolCalls returns the tool calls of a complete assistant message,
+// including a legacy function_call from models that still use one
+func messageToolCalls(msg openai.ChatCompletionMessage) []openai.ToolCall {
+	calls := msg.ToolCalls
+	if msg.FunctionCall != nil {
+		calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction, Function: *msg.FunctionCall})
+	}
+	return calls
+}
+
+// toolCallAccumulator reassembles tool calls from streamed deltas, which
+// deliver the name first and the arguments in fragments
+type toolCallAccumulator struct {
+	calls map[int]*openai.ToolCall
+}
+
+// Add merges a chunk's tool call deltas
+func (a *toolCallAccumulator) Add(deltas []openai.ToolCall) {
+	if a.calls == nil {
+		a.calls = make(map[int]*openai.ToolCall)
+	}
+	for i, d := range deltas {
+		index := i
+		if d.Index != nil {
+			index = *d.Index
+		}
+		call, ok := a.calls[index]
+		if !ok {
+			call = &openai.ToolCall{Type: openai.ToolTypeFunction}
+			a.calls[index] = call
+		}
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		// Some providers repeat the full name in every fragment
+		if d.Function.Name != call.Function.Name {
+			call.Function.Name += d.Function.Name
+		}
+		call.Function.Arguments += d.Function.Arguments
+	}
+}
+
+// AddFunctionCall merges a legacy function_call delta, which older models
+// still stream instead of tool calls, as the first tool call
+func (a *toolCallAccumulator) AddFunctionCall(fc *openai.FunctionCall) {
+	if fc == nil || (fc.Name == "" && fc.Arguments == "") {
+		return
+	}
+	index := 0
+	a.Add([]openai.ToolCall{{Index: &index, Type: openai.ToolTypeFunction, Function: *fc}})
+}
+
+// Take returns the accumulated calls in index order and resets the accumulator
+func (a *toolCallAccumulator) Take() []openai.ToolCall {
+	indexes := make([]int, 0, len(a.calls))
+	for i := range a.calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]openai.ToolCall, 0, len(indexes))
+	for _, i := range indexes {
+		calls = append(calls, *a.calls[i])
+	}
+	a.calls = nil
+	return calls
+}
+
+// Len returns the number of calls being accumulated
+func (a *toolCallAccumulator) Len() int {
+	return len(a.calls)
+}
+
+// ollamaDoneReason maps an OpenAI finish reason to Ollama's done_reason.
+// Ollama reports tool calls as a normal stop.
+func ollamaDoneReason(finishReason string) string {
+	switch finishReason {
+	case "", string(openai.FinishReasonToolCalls), string(openai.FinishReasonFunctionCall):
+		return "stop"
+	default:
+		return finishReason
+	}
+}
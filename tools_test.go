@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestToOpenAIMessages(t *testing.T) {
+	call := func(name, args string) ollamaToolCall {
+		return ollamaToolCall{Function: ollamaToolCallFunction{Name: name, Arguments: json.RawMessage(args)}}
+	}
+	openaiCall := func(id, name, args string) openai.ToolCall {
+		return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: args}}
+	}
+
+	tests := []struct {
+		name     string
+		messages []ollamaMessage
+		want     []openai.ChatCompletionMessage
+		wantErr  bool
+	}{
+		{
+			name:     "plain chat",
+			messages: []ollamaMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}},
+			want:     []openai.ChatCompletionMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}},
+		},
+		{
+			name: "tool results matched by name",
+			messages: []ollamaMessage{
+				{Role: "user", Content: "Weather and time in Paris?"},
+				{Role: "assistant", ToolCalls: []ollamaToolCall{call("get_weather", `{"city": "Paris"}`), call("get_time", `{"city": "Paris"}`)}},
+				{Role: "tool", ToolName: "get_time", Content: "14:00"},
+				{Role: "tool", ToolName: "get_weather", Content: "sunny"},
+			},
+			want: []openai.ChatCompletionMessage{
+				{Role: "user", Content: "Weather and time in Paris?"},
+				{Role: "assistant", ToolCalls: []openai.ToolCall{
+					openaiCall("call_1", "get_weather", `{"city": "Paris"}`),
+					openaiCall("call_2", "get_time", `{"city": "Paris"}`),
+				}},
+				{Role: "tool", Content: "14:00", ToolCallID: "call_2", Name: "get_time"},
+				{Role: "tool", Content: "sunny", ToolCallID: "call_1", Name: "get_weather"},
+			},
+		},
+		{
+			name: "tool results matched in order without names",
+			messages: []ollamaMessage{
+				{Role: "assistant", ToolCalls: []ollamaToolCall{call("add", `{"a": 1, "b": 2}`), call("add", `{"a": 3, "b": 4}`)}},
+				{Role: "tool", Content: "3"},
+				{Role: "tool", Content: "7"},
+			},
+			want: []openai.ChatCompletionMessage{
+				{Role: "assistant", ToolCalls: []openai.ToolCall{
+					openaiCall("call_1", "add", `{"a": 1, "b": 2}`),
+					openaiCall("call_2", "add", `{"a": 3, "b": 4}`),
+				}},
+				{Role: "tool", Content: "3", ToolCallID: "call_1", Name: "add"},
+				{Role: "tool", Content: "7", ToolCallID: "call_2", Name: "add"},
+			},
+		},
+		{
+			name: "arguments as a string or missing",
+			messages: []ollamaMessage{
+				{Role: "assistant", ToolCalls: []ollamaToolCall{call("search", `"{\"q\": \"go\"}"`), call("now", ``)}},
+			},
+			want: []openai.ChatCompletionMessage{
+				{Role: "assistant", ToolCalls: []openai.ToolCall{
+					openaiCall("call_1", "search", `{"q": "go"}`),
+					openaiCall("call_2", "now", `{}`),
+				}},
+			},
+		},
+		{
+			name: "images become content parts",
+			messages: []ollamaMessage{
+				{Role: "user", Content: "What is this?", Images: []string{"aGVsbG8="}},
+			},
+			want: []openai.ChatCompletionMessage{
+				{Role: "user", MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "What is this?"},
+					{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: imageURL("aGVsbG8=")}},
+				}},
+			},
+		},
+		{
+			name: "invalid arguments",
+			messages: []ollamaMessage{
+				{Role: "assistant", ToolCalls: []ollamaToolCall{call("broken", `{"a": `)}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toOpenAIMessages(tt.messages)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
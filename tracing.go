@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// W3C Trace Context headers (https://www.w3.org/TR/trace-context/)
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+
+	traceKey = "trace"
+)
+
+// traceContext is the trace context of one proxied request
+type traceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   string
+	State   string
+}
+
+// Traceparent formats the context for the traceparent header
+func (t traceContext) Traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// parseTraceparent parses a version 00 traceparent header
+func parseTraceparent(value string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[0]) != 2 {
+		return traceContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isLowerHex(traceID, 32) || !isLowerHex(spanID, 16) || !isLowerHex(flags, 2) {
+		return traceContext{}, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return traceContext{}, false
+	}
+	return traceContext{TraceID: traceID, SpanID: spanID, Flags: flags}, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracingMiddleware joins the caller's trace, or starts a new one, and gives
+// the proxy hop its own span ID. The trace ID is added to the request logger.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trace, ok := parseTraceparent(c.GetHeader(traceparentHeader))
+		if ok {
+			trace.State = c.GetHeader(tracestateHeader)
+		} else {
+			trace = traceContext{TraceID: randomHex(16), Flags: "00"}
+		}
+		trace.SpanID = randomHex(8)
+
+		c.Set(traceKey, trace)
+		c.Set(loggerKey, requestLogger(c).With("trace_id", trace.TraceID, "span_id", trace.SpanID))
+		c.Next()
+	}
+}
+
+// setTraceHeaders adds the request's trace context to upstream headers
+func setTraceHeaders(c *gin.Context, header http.Header) {
+	trace, ok := c.Value(traceKey).(traceContext)
+	if !ok {
+		return
+	}
+	header.Set(traceparentHeader, trace.Traceparent())
+	if trace.State != "" {
+		header.Set(tracestateHeader, trace.State)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TranscriptConfig enables logging every conversation to JSONL files, to
+// audit what clients send to the cloud
+type TranscriptConfig struct {
+	Enabled bool `json:"enabled"`
+	// Dir is where the daily files are written; defaults to "transcripts"
+	// in the config directory
+	Dir string `json:"dir,omitempty"`
+	// RedactSecrets masks credentials as secret detection does
+	RedactSecrets bool `json:"redact_secrets"`
+	// RedactPII masks emails and phone numbers
+	RedactPII bool `json:"redact_pii"`
+	// Redact lists extra regular expressions whose matches are masked
+	Redact []string `json:"redact,omitempty"`
+}
+
+// transcriptEntry is one line of a transcript file
+type transcriptEntry struct {
+	Time          time.Time                      `json:"time"`
+	RequestID     string                         `json:"request_id"`
+	Model         string                         `json:"model"`
+	UpstreamModel string                         `json:"upstream_model"`
+	Messages      []openai.ChatCompletionMessage `json:"messages"`
+	Response      string                         `json:"response"`
+	Outcome       Outcome                        `json:"outcome"`
+}
+
+// transcriptLog appends conversations to one file per day
+type transcriptLog struct {
+	mu     sync.Mutex
+	dir    string
+	redact []*regexp.Regexp
+	config TranscriptConfig
+	closed bool
+}
+
+// newTranscriptLog creates the transcript log for a configuration, or nil if
+// transcripts are disabled
+func newTranscriptLog(cfg TranscriptConfig) (*transcriptLog, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	dir := cfg.Dir
+	if dir == "" {
+		configPath, err := GetConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(filepath.Dir(configPath), "transcripts")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	t := &transcriptLog{dir: dir, config: cfg}
+	for _, pattern := range cfg.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transcript redaction pattern %q: %w", pattern, err)
+		}
+		t.redact = append(t.redact, re)
+	}
+	return t, nil
+}
+
+// redactText applies the configured redactions to text
+func (t *transcriptLog) redactText(text string) string {
+	if t.config.RedactSecrets {
+		text = maskSecrets(text)
+	}
+	if t.config.RedactPII {
+		text = emailPattern.ReplaceAllString(text, "[EMAIL]")
+		text = phonePattern.ReplaceAllString(text, "[PHONE]")
+	}
+	for _, re := range t.redact {
+		text = re.ReplaceAllString(text, secretMask)
+	}
+	return text
+}
+
+// redactMessages returns redacted copies of messages. Images are left out;
+// they would bloat the files.
+func (t *transcriptLog) redactMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, len(messages))
+	for i, m := range messages {
+		m.Content = t.redactText(m.Content)
+		if len(m.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+			for j, part := range m.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeImageURL {
+					part = openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: "[image]"}
+				}
+				part.Text = t.redactText(part.Text)
+				parts[j] = part
+			}
+			m.MultiContent = parts
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// Write appends an entry to the file of its day
+func (t *transcriptLog) Write(entry transcriptEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return os.ErrClosed
+	}
+
+	path := filepath.Join(t.dir, entry.Time.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close stops the log from writing; the files are only open while an entry
+// is appended
+func (t *transcriptLog) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
+
+// transcriptInterceptor records the request as sent upstream and the
+// response as received from upstream
+type transcriptInterceptor struct {
+	log      *transcriptLog
+	messages []openai.ChatCompletionMessage
+	response strings.Builder
+}
+
+func newTranscriptInterceptor(s *Server) Interceptor {
+	if s.transcripts == nil {
+		return nil
+	}
+	return &transcriptInterceptor{log: s.transcripts}
+}
+
+func (ti *transcriptInterceptor) InterceptRequest(ex *Exchange) error {
+	ti.messages = ti.log.redactMessages(ex.Request.Messages)
+	return nil
+}
+
+func (ti *transcriptInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	ti.response.WriteString(content)
+	return content, nil
+}
+
+func (ti *transcriptInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
+
+func (ti *transcriptInterceptor) Complete(ex *Exchange, outcome Outcome) {
+	// Requests rejected before this interceptor ran have nothing to record
+	if ti.messages == nil {
+		return
+	}
+	err := ti.log.Write(transcriptEntry{
+		Time:          ex.Started,
+		RequestID:     ex.RequestID,
+		Model:         ex.Model,
+		UpstreamModel: ex.Request.Model,
+		Messages:      ti.messages,
+		Response:      ti.log.redactText(ti.response.String()),
+		Outcome:       outcome,
+	})
+	if err != nil {
+		slog.Error("Failed to write transcript", "request_id", ex.RequestID, "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built from, set with
+// -ldflags "-X main.version=1.2.3"; development builds don't check for
+// updates
+var version = "dev"
+
+// latestReleaseURL is the GitHub API endpoint for the newest release, which
+// leaves out drafts and prereleases
+const latestReleaseURL = "https://api.github.com/repos/abhi-wan-kenobi/ollama-openrouter-proxy/releases/latest"
+
+// updateCheckInterval is how often the tray app looks for a new release
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckTimeout bounds a release check
+const updateCheckTimeout = 30 * time.Second
+
+// release is a GitHub release
+type release struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// latestRelease fetches the newest release from GitHub
+func latestRelease(ctx context.Context) (release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	// Like every outgoing call, through the configured proxy and CAs
+	client := &http.Client{Transport: outboundTransport, Timeout: updateCheckTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return release{}, fmt.Errorf("GitHub answered HTTP %d", resp.StatusCode)
+	}
+
+	var latest release
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		return release{}, err
+	}
+	return latest, nil
+}
+
+// CheckForUpdate returns the newest release if it is newer than this
+// binary, and false if there is none or this is a development build
+func CheckForUpdate(ctx context.Context) (release, bool, error) {
+	if version == "dev" {
+		return release{}, false, nil
+	}
+	latest, err := latestRelease(ctx)
+	if err != nil {
+		return release{}, false, err
+	}
+	return latest, newerVersion(latest.TagName, version), nil
+}
+
+// newerVersion reports whether version a is newer than b. Versions are
+// compared as dotted numbers; a leading "v" and suffixes such as "-rc1"
+// are ignored.
+func newerVersion(a, b string) bool {
+	pa, pb := versionNumbers(a), versionNumbers(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na = pa[i]
+		}
+		if i < len(pb) {
+			nb = pb[i]
+		}
+		if na != nb {
+			return na > nb
+		}
+	}
+	return false
+}
+
+// versionNumbers splits a version such as "v1.2.3-rc1" into its numbers
+func versionNumbers(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var numbers []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// blockedForwardHeaders are never forwarded from clients to the upstream API.
+// Authorization is only forwarded in BYOK mode.
+var blockedForwardHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Host":                {},
+	"Connection":          {},
+	"Content-Length":      {},
+	"Content-Type":        {},
+	"Transfer-Encoding":   {},
+}
+
+type upstreamHeaderKey struct{}
+
+// withUpstreamHeader attaches headers for the upstream request to ctx
+func withUpstreamHeader(ctx context.Context, header http.Header) context.Context {
+	if len(header) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, upstreamHeaderKey{}, header)
+}
+
+type upstreamFieldsKey struct{}
+
+// withUpstreamFields attaches extra JSON body fields for the upstream request
+// to ctx
+func withUpstreamFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, upstreamFieldsKey{}, fields)
+}
+
+// addBodyFields merges fields into the JSON object body of req
+func addBodyFields(req *http.Request, fields map[string]interface{}) error {
+	if req.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		body[k] = raw
+	}
+	if data, err = json.Marshal(body); err != nil {
+		return err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	return nil
+}
+
+// upstreamTransport adds static and per-request headers to every call made
+// by the OpenAI client, and picks the API key when there is a key pool
+type upstreamTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	keys    *keyPool
+	retry   RetryConfig
+	limiter *requestLimiter
+	// thirdParty marks a backend other than OpenRouter, which must not
+	// receive OpenRouter's body extensions or a client's OpenRouter key
+	thirdParty bool
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	header, _ := req.Context().Value(upstreamHeaderKey{}).(http.Header)
+	if t.thirdParty && header.Get("Authorization") != "" {
+		header = header.Clone()
+		header.Del("Authorization")
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	if fields, ok := req.Context().Value(upstreamFieldsKey{}).(map[string]interface{}); ok && !t.thirdParty {
+		if err := addBodyFields(req, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	release := func() {}
+	if t.limiter != nil {
+		var err error
+		if release, err = t.limiter.Acquire(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.sendWithRetries(req, header)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	recordUpstreamStatus(req.Context(), resp.StatusCode)
+	if rc, ok := req.Context().Value(reasoningKey{}).(*reasoningCollector); ok {
+		if err := rc.watch(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// send makes the upstream call with a key from the pool, if there is one
+func (t *upstreamTransport) send(req *http.Request, header http.Header) (*http.Response, error) {
+	// A client's own key (BYOK) bypasses the pool
+	if t.keys == nil || header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.keys.Pick()
+	tried := map[*pooledKey]bool{}
+	for {
+		tried[key] = true
+		req.Header.Set("Authorization", "Bearer "+key.key)
+		resp, err := t.base.RoundTrip(req)
+		t.keys.Report(key, keyFailed(resp, err))
+		if err != nil || !keyExhausted(resp.StatusCode) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		// Rate limited or out of credits: try the next key right away
+		next := t.keys.Failover(key, tried)
+		if next == nil {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		key = next
+	}
+}
+
+// forwardHeaders picks the configured client headers that should be passed
+// on to the upstream API
+func (s *Server) forwardHeaders(incoming http.Header) http.Header {
+	out := make(http.Header)
+	for _, name := range s.config.ForwardHeaders {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if _, blocked := blockedForwardHeaders[name]; blocked {
+			continue
+		}
+		if values := incoming.Values(name); len(values) > 0 {
+			out[name] = values
+		}
+	}
+
+	// Bring your own key: the client's own OpenRouter key replaces ours,
+	// unless what it sent is its access token for the proxy itself
+	if s.config.BYOK {
+		auth := incoming.Get("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok && !s.isAccessToken(token) {
+			out.Set("Authorization", auth)
+		}
+	}
+
+	return out
+}
+
+// clientUser identifies the end user behind a request for OpenAI's "user"
+// field. The configured header wins; otherwise the client's bearer token is
+// hashed so the token itself never leaves the proxy.
+func (s *Server) clientUser(incoming http.Header) string {
+	if s.config.UserHeader != "" {
+		if user := strings.TrimSpace(incoming.Get(s.config.UserHeader)); user != "" {
+			return user
+		}
+	}
+
+	if s.config.UserFromToken {
+		if token, ok := strings.CutPrefix(incoming.Get("Authorization"), "Bearer "); ok && token != "" {
+			sum := sha256.Sum256([]byte(token))
+			return "token-" + hex.EncodeToString(sum[:8])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// upstreamError maps an error from an upstream call to the HTTP status and
+// message an Ollama client should see. OpenRouter reports insufficient
+// credits, moderation blocks, unknown models, rate limits and unavailable
+// models with distinct statuses that are kept, with readable messages,
+// instead of a blanket 500.
+func upstreamError(err error) (int, string) {
+	var limitErr *limitError
+	var timeoutErr *timeoutError
+	switch {
+	case errors.As(err, &limitErr):
+		return http.StatusTooManyRequests, limitErr.Error()
+	case errors.As(err, &timeoutErr):
+		return http.StatusGatewayTimeout, timeoutErr.Error()
+	}
+
+	status, message := upstreamStatus(err)
+	switch status {
+	case http.StatusBadRequest:
+		return http.StatusBadRequest, message
+	case http.StatusUnauthorized:
+		return http.StatusBadGateway, "OpenRouter rejected the proxy's API key: " + message
+	case http.StatusPaymentRequired:
+		return http.StatusPaymentRequired, "insufficient OpenRouter credits: " + message
+	case http.StatusForbidden:
+		return http.StatusForbidden, "blocked by moderation: " + message
+	case http.StatusNotFound:
+		return http.StatusNotFound, "model not found: " + message
+	case http.StatusRequestTimeout:
+		return http.StatusGatewayTimeout, "model timed out: " + message
+	case http.StatusTooManyRequests:
+		return http.StatusTooManyRequests, "rate limited: " + message
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return http.StatusServiceUnavailable, "model unavailable: " + message
+	}
+	if status >= http.StatusInternalServerError {
+		return http.StatusBadGateway, message
+	}
+	return http.StatusInternalServerError, message
+}
+
+// upstreamStatus returns the HTTP status upstream answered a failed call
+// with, or 0 if it didn't answer, and its error message
+func upstreamStatus(err error) (int, string) {
+	status, message := 0, err.Error()
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+		if apiErr.Message != "" {
+			message = apiErr.Message
+		}
+		// Errors sent inside a stream carry the status only as their code
+		if code, ok := apiErr.Code.(float64); ok && status == 0 {
+			status = int(code)
+		}
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+	return status, message
+}
+
+// failedOutcome is the outcome of an exchange whose upstream call failed
+func failedOutcome(err error) Outcome {
+	status, _ := upstreamStatus(err)
+	return Outcome{Status: OutcomeError, Error: err.Error(), UpstreamStatus: status}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// usageTotals accumulates requests, tokens and cost
+type usageTotals struct {
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *usageTotals) add(outcome Outcome, cost float64) {
+	t.Requests++
+	if outcome.Status != OutcomeSuccess {
+		t.Errors++
+	}
+	t.PromptTokens += outcome.Usage.PromptTokens
+	t.CompletionTokens += outcome.Usage.CompletionTokens
+	t.Cost += cost
+}
+
+// modelUsage is the usage of one virtual model, i.e. the model name the
+// client asked for, broken down by the OpenRouter models it resolved to
+type modelUsage struct {
+	usageTotals
+	Upstream map[string]*usageTotals `json:"upstream"`
+}
+
+// usageLedger keeps usage per virtual model since the server started
+type usageLedger struct {
+	mu      sync.Mutex
+	since   time.Time
+	byModel map[string]*modelUsage
+}
+
+func newUsageLedger() *usageLedger {
+	return &usageLedger{
+		since:   time.Now(),
+		byModel: map[string]*modelUsage{},
+	}
+}
+
+// Record adds one finished request to the ledger
+func (l *usageLedger) Record(model, upstreamModel string, outcome Outcome, cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, ok := l.byModel[model]
+	if !ok {
+		m = &modelUsage{Upstream: map[string]*usageTotals{}}
+		l.byModel[model] = m
+	}
+	m.add(outcome, cost)
+
+	u, ok := m.Upstream[upstreamModel]
+	if !ok {
+		u = &usageTotals{}
+		m.Upstream[upstreamModel] = u
+	}
+	u.add(outcome, cost)
+}
+
+// TotalCost returns the cost of all requests in the ledger
+func (l *usageLedger) TotalCost() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var cost float64
+	for _, m := range l.byModel {
+		cost += m.Cost
+	}
+	return cost
+}
+
+// usageReport is one row of the /api/usage report
+type usageReport struct {
+	Model string `json:"model"`
+	modelUsage
+}
+
+// Report returns the usage of every virtual model, most expensive first
+func (l *usageLedger) Report() []usageReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := make([]usageReport, 0, len(l.byModel))
+	for name, m := range l.byModel {
+		row := usageReport{Model: name, modelUsage: modelUsage{usageTotals: m.usageTotals, Upstream: map[string]*usageTotals{}}}
+		for upstream, u := range m.Upstream {
+			totals := *u
+			row.Upstream[upstream] = &totals
+		}
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Cost != report[j].Cost {
+			return report[i].Cost > report[j].Cost
+		}
+		return report[i].Model < report[j].Model
+	})
+	return report
+}
+
+// defaultUsageDays is how many days of history /api/usage reports
+const defaultUsageDays = 30
+
+// handleUsage serves /api/usage: usage since the server started, and from
+// the usage database per day and model for the last ?days=N days and per
+// client key for the current month
+func (s *Server) handleUsage(c *gin.Context) {
+	response := gin.H{
+		"since":  s.usage.since.Format(time.RFC3339),
+		"models": s.usage.Report(),
+	}
+
+	if s.usageDB != nil {
+		days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultUsageDays)))
+		if err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive number"})
+			return
+		}
+		daily, err := s.usageDB.Daily(time.Now().AddDate(0, 0, 1-days))
+		if err != nil {
+			requestLogger(c).Error("Failed to read usage database", "Error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["daily"] = daily
+
+		clients, err := s.usageDB.Clients(monthStart(time.Now()))
+		if err != nil {
+			requestLogger(c).Error("Failed to read usage database", "Error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["clients"] = clients
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// usageInterceptor records the outcome of every request in the usage ledger
+// and, when available, the usage database
+type usageInterceptor struct {
+	ledger   *usageLedger
+	store    *usageStore
+	recent   *recentRequests
+	health   *healthTracker
+	provider Provider
+}
+
+func newUsageInterceptor(s *Server) Interceptor {
+	return &usageInterceptor{ledger: s.usage, store: s.usageDB, recent: s.recent, health: s.health, provider: s.provider}
+}
+
+func (u *usageInterceptor) InterceptRequest(ex *Exchange) error {
+	return nil
+}
+
+func (u *usageInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (u *usageInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
+
+func (u *usageInterceptor) Complete(ex *Exchange, outcome Outcome) {
+	// Rejected requests that never reached upstream cost nothing
+	if outcome.Status == OutcomeRejected && outcome.Usage.TotalTokens == 0 {
+		return
+	}
+	cost := u.provider.Cost(ex.Request.Model, outcome.Usage)
+	u.ledger.Record(ex.Model, ex.Request.Model, outcome, cost)
+	u.recent.Add(ex, outcome, cost)
+	u.health.Record(outcome)
+	if u.store != nil {
+		if err := u.store.Record(ex, outcome, cost); err != nil {
+			slog.Error("Failed to record usage", "request_id", ex.RequestID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// usageSchema creates the table every finished request is recorded in
+const usageSchema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id                INTEGER PRIMARY KEY,
+	time              TEXT NOT NULL,
+	day               TEXT NOT NULL,
+	request_id        TEXT NOT NULL,
+	client            TEXT NOT NULL DEFAULT '',
+	model             TEXT NOT NULL,
+	upstream_model    TEXT NOT NULL,
+	status            TEXT NOT NULL,
+	prompt_tokens     INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	cost              REAL NOT NULL,
+	duration_ms       INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS requests_day ON requests (day);
+`
+
+// usageDBPath returns the path of the usage database, next to config.json
+func usageDBPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "usage.db"), nil
+}
+
+// usageStore persists the usage of every request in SQLite so spending can
+// be reviewed across restarts
+type usageStore struct {
+	db *sql.DB
+}
+
+// openUsageStore opens the usage database at path, creating it if needed
+func openUsageStore(path string) (*usageStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; queue writes instead of failing them
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(usageSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateUsageStore(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &usageStore{db: db}, nil
+}
+
+// addedUsageColumns are the columns of the requests table that databases
+// created by older versions lack, with their definitions
+var addedUsageColumns = []struct{ name, definition string }{
+	{"client", "TEXT NOT NULL DEFAULT ''"},
+	{"duration_ms", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateUsageStore adds the columns databases created by older versions
+// lack
+func migrateUsageStore(db *sql.DB) error {
+	for _, column := range addedUsageColumns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('requests') WHERE name = ?`, column.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE requests ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record stores one finished request
+func (u *usageStore) Record(ex *Exchange, outcome Outcome, cost float64) error {
+	now := time.Now()
+	_, err := u.db.Exec(
+		`INSERT INTO requests (time, day, request_id, client, model, upstream_model, status, prompt_tokens, completion_tokens, cost, duration_ms)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		now.Format(time.RFC3339), now.Format(time.DateOnly), ex.RequestID, ex.Client, ex.Model, ex.Request.Model,
+		outcome.Status, outcome.Usage.PromptTokens, outcome.Usage.CompletionTokens, cost, outcome.DurationMs,
+	)
+	return err
+}
+
+// Spent returns the total cost of the requests since the given day
+func (u *usageStore) Spent(since time.Time) (float64, error) {
+	var cost float64
+	err := u.db.QueryRow(`SELECT COALESCE(SUM(cost), 0) FROM requests WHERE day >= ?`, since.Format(time.DateOnly)).Scan(&cost)
+	return cost, err
+}
+
+// dailyUsage is the usage of one model on one day
+type dailyUsage struct {
+	Day   string `json:"day"`
+	Model string `json:"model"`
+	usageTotals
+}
+
+// Daily returns the usage per day and model since the given day, newest
+// day first
+func (u *usageStore) Daily(since time.Time) ([]dailyUsage, error) {
+	rows, err := u.db.Query(
+		`SELECT day, model, COUNT(*), SUM(status != ?), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost)
+		 FROM requests WHERE day >= ? GROUP BY day, model ORDER BY day DESC, SUM(cost) DESC`,
+		OutcomeSuccess, since.Format(time.DateOnly),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []dailyUsage{}
+	for rows.Next() {
+		var d dailyUsage
+		if err := rows.Scan(&d.Day, &d.Model, &d.Requests, &d.Errors, &d.PromptTokens, &d.CompletionTokens, &d.Cost); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// ClientTokens returns the tokens used by a client since the given day
+func (u *usageStore) ClientTokens(client string, since time.Time) (int, error) {
+	var tokens int
+	err := u.db.QueryRow(
+		`SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0) FROM requests WHERE client = ? AND day >= ?`,
+		client, since.Format(time.DateOnly),
+	).Scan(&tokens)
+	return tokens, err
+}
+
+// clientUsage is the usage of one client key
+type clientUsage struct {
+	Client string `json:"client"`
+	usageTotals
+}
+
+// Clients returns the usage per client key since the given day, requests
+// made without a client key left out
+func (u *usageStore) Clients(since time.Time) ([]clientUsage, error) {
+	rows, err := u.db.Query(
+		`SELECT client, COUNT(*), SUM(status != ?), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost)
+		 FROM requests WHERE client != '' AND day >= ? GROUP BY client ORDER BY client`,
+		OutcomeSuccess, since.Format(time.DateOnly),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []clientUsage{}
+	for rows.Next() {
+		var cu clientUsage
+		if err := rows.Scan(&cu.Client, &cu.Requests, &cu.Errors, &cu.PromptTokens, &cu.CompletionTokens, &cu.Cost); err != nil {
+			return nil, err
+		}
+		clients = append(clients, cu)
+	}
+	return clients, rows.Err()
+}
+
+// Recent returns the last limit requests recorded, newest first. Errors
+// aren't stored, so only their status is known.
+func (u *usageStore) Recent(limit int) ([]recentRequest, error) {
+	rows, err := u.db.Query(
+		`SELECT time, request_id, client, model, upstream_model, status, prompt_tokens + completion_tokens, cost, duration_ms
+		 FROM requests ORDER BY id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []recentRequest{}
+	for rows.Next() {
+		var r recentRequest
+		var recorded string
+		if err := rows.Scan(&recorded, &r.RequestID, &r.Client, &r.Model, &r.UpstreamModel, &r.Status, &r.Tokens, &r.Cost, &r.DurationMs); err != nil {
+			return nil, err
+		}
+		r.Time, _ = time.Parse(time.RFC3339, recorded)
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// Close closes the database
+func (u *usageStore) Close() error {
+	return u.db.Close()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// VirtualModel is a local model name backed by an OpenRouter model, created
+// with /api/copy or /api/create
+type VirtualModel struct {
+	// From is the full name of the OpenRouter model
+	From string `json:"from"`
+	// System is used as the system prompt when the client sends none
+	System string `json:"system,omitempty"`
+	// Parameters are default options; options sent by the client win
+	Parameters *ollamaOptions `json:"parameters,omitempty"`
+}
+
+// withSystem prepends the model's system prompt unless the conversation
+// already has one
+func (vm VirtualModel) withSystem(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	return withSystemPrompt(messages, vm.System)
+}
+
+// withSystemPrompt prepends a system prompt unless it is empty or the
+// conversation already has one
+func withSystemPrompt(messages []openai.ChatCompletionMessage, system string) []openai.ChatCompletionMessage {
+	if system == "" {
+		return messages
+	}
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleSystem {
+			return messages
+		}
+	}
+	out := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	out = append(out, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: system})
+	return append(out, messages...)
+}
+
+// parameterLines renders the parameters as Modelfile PARAMETER values, one
+// "name value" per line as /api/show reports them
+func (vm VirtualModel) parameterLines() []string {
+	if vm.Parameters == nil {
+		return nil
+	}
+	data, err := json.Marshal(vm.Parameters)
+	if err != nil {
+		return nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil
+	}
+
+	var lines []string
+	for name, value := range params {
+		if stops, ok := value.([]interface{}); ok {
+			for _, stop := range stops {
+				lines = append(lines, fmt.Sprintf("%s %q", name, stop))
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %v", name, value))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// modelfile renders the virtual model as a Modelfile
+func (vm VirtualModel) modelfile() string {
+	var b strings.Builder
+	b.WriteString("FROM " + vm.From + "\n")
+	if vm.System != "" {
+		b.WriteString(`SYSTEM """` + vm.System + `"""` + "\n")
+	}
+	for _, line := range vm.parameterLines() {
+		b.WriteString("PARAMETER " + line + "\n")
+	}
+	return b.String()
+}
+
+// virtualModels is the persistent set of virtual models, kept in
+// models.json next to config.json
+type virtualModels struct {
+	mu     sync.RWMutex
+	path   string
+	models map[string]VirtualModel
+}
+
+// virtualModelsPath returns the path of the virtual models file
+func virtualModelsPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "models.json"), nil
+}
+
+// loadVirtualModels reads the virtual models file; a missing file is an
+// empty set
+func loadVirtualModels(path string) (*virtualModels, error) {
+	v := &virtualModels{path: path, models: map[string]VirtualModel{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &v.models); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Get looks up a virtual model. Ollama clients may add the default ":latest"
+// tag to names that were created without one.
+func (v *virtualModels) Get(name string) (VirtualModel, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if vm, ok := v.models[name]; ok {
+		return vm, true
+	}
+	vm, ok := v.models[strings.TrimSuffix(name, ":latest")]
+	return vm, ok
+}
+
+// Names returns the names of all virtual models, sorted
+func (v *virtualModels) Names() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	names := make([]string, 0, len(v.models))
+	for name := range v.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set creates or replaces a virtual model and saves the file
+func (v *virtualModels) Set(name string, vm VirtualModel) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.models[name] = vm
+	return v.save()
+}
+
+// Delete removes a virtual model and saves the file. It returns false if
+// there was no such model.
+func (v *virtualModels) Delete(name string) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.models[name]; !ok {
+		name = strings.TrimSuffix(name, ":latest")
+		if _, ok := v.models[name]; !ok {
+			return false, nil
+		}
+	}
+	delete(v.models, name)
+	return true, v.save()
+}
+
+// save writes the file. The caller must hold mu.
+func (v *virtualModels) save() error {
+	data, err := json.MarshalIndent(v.models, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(v.path, data, 0644)
+}
+
+// resolveModel maps the model name a client asked for to an OpenRouter
+// model, looking at virtual models first, then at A/B splits and the
+// configured aliases.
+// Unknown models are replaced by the default model when one is configured.
+func (s *Server) resolveModel(name string) (string, error) {
+	if vm, ok := s.virtual.Get(name); ok {
+		return vm.From, nil
+	}
+	if arms, ok := s.modelSplit(name); ok {
+		arm := pickArm(arms)
+		slog.Debug("Split model", "model", name, "arm", arm)
+		name = arm
+	}
+	if target, ok := s.modelAlias(name); ok {
+		name = target
+	}
+	fullName, err := s.provider.GetFullModelName(name)
+	defaultModel := s.defaultModel()
+	if err != nil || defaultModel == "" {
+		return fullName, err
+	}
+	if _, known := s.provider.FindModel(name); known {
+		return fullName, nil
+	}
+	slog.Warn("Unknown model, using the default model", "model", name, "default_model", defaultModel)
+	return s.provider.GetFullModelName(defaultModel)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// imageURL turns an Ollama image, which is plain base64 data, into a data
+// URL. Clients that already send a data or http(s) URL are passed through.
+func imageURL(image string) string {
+	if strings.HasPrefix(image, "data:") || strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		return image
+	}
+
+	// Sniff the type from the first bytes; 512 bytes are all DetectContentType
+	// reads, which takes at most 684 base64 characters
+	head := image
+	if len(head) > 684 {
+		head = head[:684]
+	}
+	mimeType := "image/jpeg"
+	if data, err := base64.StdEncoding.DecodeString(head[:len(head)/4*4]); err == nil {
+		if detected := http.DetectContentType(data); strings.HasPrefix(detected, "image/") {
+			mimeType = detected
+		}
+	}
+	return "data:" + mimeType + ";base64," + image
+}
+
+// withImages turns msg into multimodal content with its text followed by the
+// images, as OpenAI vision models expect
+func withImages(msg *openai.ChatCompletionMessage, images []string) {
+	if len(images) == 0 {
+		return
+	}
+
+	parts := make([]openai.ChatMessagePart, 0, len(images)+1)
+	if msg.Content != "" {
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: msg.Content})
+	}
+	for _, image := range images {
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: imageURL(image)},
+		})
+	}
+
+	// go-openai refuses messages with both Content and MultiContent
+	msg.Content = ""
+	msg.MultiContent = parts
+}
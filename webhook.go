@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultWebhookTimeout is used when WebhookConfig.TimeoutSeconds is unset
+const defaultWebhookTimeout = 10 * time.Second
+
+// WebhookConfig configures external HTTP hooks around every chat request
+type WebhookConfig struct {
+	// PreRequestURL receives the request before it is sent upstream. A
+	// non-2xx answer rejects the request; a 200 answer with a "request"
+	// object replaces the outgoing request.
+	PreRequestURL string `json:"pre_request_url,omitempty"`
+	// PostRequestURL receives the outcome and token usage after each request
+	PostRequestURL string `json:"post_request_url,omitempty"`
+	// Headers are added to every webhook call (e.g. for authentication)
+	Headers map[string]string `json:"headers,omitempty"`
+	// TimeoutSeconds bounds each webhook call
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// preRequestPayload is sent to the pre-request hook
+type preRequestPayload struct {
+	RequestID string                        `json:"request_id"`
+	Model     string                        `json:"model"`
+	Request   *openai.ChatCompletionRequest `json:"request"`
+}
+
+// preRequestReply is the optional body of the pre-request hook's answer
+type preRequestReply struct {
+	Request *openai.ChatCompletionRequest `json:"request,omitempty"`
+	Error   string                        `json:"error,omitempty"`
+}
+
+// postRequestPayload is sent to the post-request hook
+type postRequestPayload struct {
+	RequestID     string  `json:"request_id"`
+	Model         string  `json:"model"`
+	UpstreamModel string  `json:"upstream_model"`
+	Outcome       Outcome `json:"outcome"`
+}
+
+// webhookInterceptor calls the configured pre/post request hooks
+type webhookInterceptor struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func newWebhookInterceptor(s *Server) Interceptor {
+	cfg := s.config.Webhooks
+	if cfg.PreRequestURL == "" && cfg.PostRequestURL == "" {
+		return nil
+	}
+
+	timeout := defaultWebhookTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	return &webhookInterceptor{
+		config: cfg,
+		client: &http.Client{Timeout: timeout, Transport: outboundTransport},
+	}
+}
+
+func (wh *webhookInterceptor) InterceptRequest(ex *Exchange) error {
+	if wh.config.PreRequestURL == "" {
+		return nil
+	}
+
+	resp, err := wh.post(wh.config.PreRequestURL, preRequestPayload{RequestID: ex.RequestID, Model: ex.Model, Request: ex.Request})
+	if err != nil {
+		return fmt.Errorf("pre-request hook failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("pre-request hook failed: %w", err)
+	}
+
+	var reply preRequestReply
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &reply); err != nil {
+			return fmt.Errorf("pre-request hook returned invalid JSON: %w", err)
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if reply.Error != "" {
+			return fmt.Errorf("request rejected: %s", reply.Error)
+		}
+		return fmt.Errorf("request rejected by pre-request hook (status %d)", resp.StatusCode)
+	}
+
+	if reply.Request != nil {
+		// The hook may rewrite everything except whether we stream
+		reply.Request.Stream = ex.Request.Stream
+		*ex.Request = *reply.Request
+	}
+
+	return nil
+}
+
+func (wh *webhookInterceptor) InterceptResponse(ex *Exchange, content string) (string, error) {
+	return content, nil
+}
+
+func (wh *webhookInterceptor) Flush(ex *Exchange) (string, error) {
+	return "", nil
+}
+
+// Complete reports the outcome to the post-request hook without blocking
+// the client response
+func (wh *webhookInterceptor) Complete(ex *Exchange, outcome Outcome) {
+	if wh.config.PostRequestURL == "" {
+		return
+	}
+
+	payload := postRequestPayload{
+		RequestID:     ex.RequestID,
+		Model:         ex.Model,
+		UpstreamModel: ex.Request.Model,
+		Outcome:       outcome,
+	}
+	go func() {
+		resp, err := wh.post(wh.config.PostRequestURL, payload)
+		if err != nil {
+			slog.Error("Post-request hook failed", "Error", err, "request_id", ex.RequestID)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// post sends payload as JSON to url with the configured headers
+func (wh *webhookInterceptor) post(url string, payload interface{}) (*http.Response, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return wh.client.Do(req)
+}